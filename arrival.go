@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 到位等待参数
+const (
+	defaultArrivalTolerance = 0.02 // rad
+	defaultArrivalTimeout   = 5 * time.Second
+	arrivalPollInterval     = 50 * time.Millisecond
+)
+
+// ArrivalResult 到位检查结果
+type ArrivalResult struct {
+	Arrived   bool               `json:"arrived"`
+	Errors    map[string]float64 `json:"errors"`     // motor_id -> |目标-实测| rad
+	MaxError  float64            `json:"max_error"`  // 最大误差 rad
+	Worst     int                `json:"worst"`      // 误差最大的电机
+	NoReply   []int              `json:"no_reply"`   // 最后一次读取无响应的电机
+	ElapsedMs int64              `json:"elapsed_ms"` // 从开始等待到返回的时间
+	Polls     int                `json:"polls"`
+}
+
+// MoveAndWait 下发一组角度并等待所有关节到位（实测位置与目标之差不超过 tolerance），
+// 超过 timeout 仍未到位时返回错误和最后一次的误差
+func (b *BlackArmController) MoveAndWait(targets map[int]float32, tolerance float32, timeout time.Duration) (ArrivalResult, error) {
+	targets = copyTargets(targets)
+	if _, err := b.SetAngleGroup(targets); err != nil {
+		return ArrivalResult{}, err
+	}
+	return b.WaitArrival(targets, tolerance, timeout, nil, nil)
+}
+
+// WaitArrival 周期读取各关节负载端位置(mech_pos)，直到都在目标的 tolerance 以内或超时。
+// tolerance、timeout 不大于0时使用默认值；干运行没有反馈，直接视为到位。
+// 每次读取前检查急停、任务取消和 abort（另一条手臂失败），任一发生即停止等待并返回对应错误
+func (b *BlackArmController) WaitArrival(targets map[int]float32, tolerance float32, timeout time.Duration, job *Job, abort <-chan struct{}) (ArrivalResult, error) {
+	if tolerance <= 0 {
+		tolerance = defaultArrivalTolerance
+	}
+	if timeout <= 0 {
+		timeout = defaultArrivalTimeout
+	}
+
+	motorIDs := make([]int, 0, len(targets))
+	for motorID := range targets {
+		motorIDs = append(motorIDs, motorID)
+	}
+	sort.Ints(motorIDs)
+
+	start := time.Now()
+	if isCaptureTransport(b.Transport) {
+		log.Printf("[dry-run] %s 没有位置反馈，跳过到位检查", b.Interface)
+		return ArrivalResult{Arrived: true, Errors: map[string]float64{}}, nil
+	}
+
+	var res ArrivalResult
+	for {
+		if err := b.Latch.Check(); err != nil {
+			return res, err
+		}
+		if err := armStopped(job, abort); err != nil {
+			return res, err
+		}
+		reads := make([]paramRead, len(motorIDs))
+		for i, motorID := range motorIDs {
+			reads[i] = paramRead{Motor: motorID, Index: idxMechPos}
+		}
+		if err := b.readParams(reads); err != nil {
+			return res, err
+		}
+
+		res = ArrivalResult{Arrived: true, Errors: make(map[string]float64, len(reads)), Polls: res.Polls + 1}
+		for _, r := range reads {
+			if r.Err != nil {
+				res.Arrived = false
+				res.NoReply = append(res.NoReply, r.Motor)
+				continue
+			}
+			e := math.Abs(float64(targets[r.Motor]) - float64(r.Value))
+			res.Errors[strconv.Itoa(r.Motor)] = e
+			if e > res.MaxError {
+				res.MaxError = e
+				res.Worst = r.Motor
+			}
+			if e > float64(tolerance) {
+				res.Arrived = false
+			}
+		}
+		res.ElapsedMs = time.Since(start).Milliseconds()
+
+		if res.Arrived {
+			return res, nil
+		}
+		if time.Since(start) >= timeout {
+			if len(res.NoReply) > 0 {
+				return res, fmt.Errorf("%s 等待到位超时(%v): 关节 %v 无位置响应", b.Interface, timeout, res.NoReply)
+			}
+			return res, fmt.Errorf("%s 等待到位超时(%v): 关节 %d 误差 %.4f rad 超过容差 %.4f", b.Interface, timeout, res.Worst, res.MaxError, tolerance)
+		}
+		if err := armSleep(job, abort, arrivalPollInterval); err != nil {
+			return res, err
+		}
+	}
+}
+
+// waitForStep 角度组是否以到位代替固定等待
+func waitForStep(set JointAngleSet, seq *JointSequence) bool {
+	return set.WaitArrival || seq.WaitArrival
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaitArrivalStops(t *testing.T) {
+	closed := make(chan struct{})
+	close(closed)
+	later := make(chan struct{})
+	time.AfterFunc(120*time.Millisecond, func() { close(later) })
+	latched := &EStopLatch{}
+	latched.Engage("测试")
+
+	tests := []struct {
+		name  string
+		latch *EStopLatch
+		abort <-chan struct{}
+		want  error
+	}{
+		{"另一条手臂失败", nil, closed, errArmAborted},
+		{"急停锁定", latched, nil, nil},
+		{"等待中另一条手臂失败", nil, later, errArmAborted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 没有设备响应的传输：不中止时只能等到超时
+			transport := &replyTestTransport{subs: newSubscriberSet()}
+			controller := NewBlackArmController(transport, "can2", ArmConfig{ArmType: "left", MotorIDs: []int{61}})
+			controller.Latch = tt.latch
+
+			start := time.Now()
+			_, err := controller.WaitArrival(map[int]float32{61: 1}, 0.01, 2*time.Second, nil, tt.abort)
+			if err == nil {
+				t.Fatal("WaitArrival() 应返回错误")
+			}
+			if tt.want != nil && err != tt.want {
+				t.Errorf("WaitArrival() error = %v, want %v", err, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+				t.Errorf("%v 后才返回，应立即停止等待", elapsed)
+			}
+		})
+	}
+}
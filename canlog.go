@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 帧方向标记，写在candump日志行末（与 candump -x 的扩展信息一致）
+const (
+	canLogTX = "T"
+	canLogRX = "R"
+)
+
+// CanLogConfig CAN帧日志配置
+type CanLogConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Dir       string `yaml:"dir"`         // 日志目录，默认 canlogs
+	MaxSizeMB int    `yaml:"max_size_mb"` // 单个文件上限，默认 10MB
+	MaxFiles  int    `yaml:"max_files"`   // 保留的文件数，默认 10
+}
+
+// CANLogger 以 candump -l 格式追加记录帧，按大小滚动
+type CANLogger struct {
+	mu       sync.Mutex
+	dir      string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	writer   *bufio.Writer
+	size     int64
+}
+
+// NewCANLogger 创建帧日志
+func NewCANLogger(cfg CanLogConfig) (*CANLogger, error) {
+	l := &CANLogger{
+		dir:      cfg.Dir,
+		maxSize:  int64(cfg.MaxSizeMB) << 20,
+		maxFiles: cfg.MaxFiles,
+	}
+	if l.dir == "" {
+		l.dir = "canlogs"
+	}
+	if l.maxSize <= 0 {
+		l.maxSize = 10 << 20
+	}
+	if l.maxFiles <= 0 {
+		l.maxFiles = 10
+	}
+
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建CAN日志目录失败: %v", err)
+	}
+	if err := l.rotate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// rotate 关闭当前文件，新建日志文件并清理过旧的文件
+func (l *CANLogger) rotate() error {
+	if l.file != nil {
+		l.writer.Flush()
+		l.file.Close()
+	}
+
+	name := filepath.Join(l.dir, fmt.Sprintf("candump-%s.log", time.Now().Format("2006-01-02_150405.000")))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("创建CAN日志文件失败: %v", err)
+	}
+	l.file = f
+	l.writer = bufio.NewWriter(f)
+	l.size = 0
+	log.Printf("CAN帧日志写入 %s", name)
+
+	files, _ := filepath.Glob(filepath.Join(l.dir, "candump-*.log"))
+	sort.Strings(files)
+	for len(files) > l.maxFiles {
+		os.Remove(files[0])
+		files = files[1:]
+	}
+	return nil
+}
+
+// Log 记录一帧，接收的帧使用传输给出的接收时间（SocketCAN 为内核时间戳）
+func (l *CANLogger) Log(direction string, msg CANMessage) {
+	at := msg.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	line := formatCandumpLine(at, msg) + " " + direction + "\n"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			log.Printf("CAN日志滚动失败: %v", err)
+			return
+		}
+	}
+	n, _ := l.writer.WriteString(line)
+	l.size += int64(n)
+	// 立即落盘，演出出错时日志必须完整
+	l.writer.Flush()
+}
+
+// Close 关闭日志
+func (l *CANLogger) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.writer.Flush()
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// formatCandumpLine 格式化为 candump -l 行：(秒.微秒) 接口 ID#数据
+func formatCandumpLine(t time.Time, msg CANMessage) string {
+	return fmt.Sprintf("(%010d.%06d) %s %s#%s",
+		t.Unix(), t.Nanosecond()/1000, msg.Interface,
+		formatCANID(msg.ID, msg.Extended), strings.ToUpper(hex.EncodeToString(msg.Data)))
+}
+
+// RecordingTransport 记录经过的所有收发帧
+type RecordingTransport struct {
+	inner  CANTransport
+	logger *CANLogger
+}
+
+// NewRecordingTransport 为传输套上记录层
+func NewRecordingTransport(inner CANTransport, logger *CANLogger) *RecordingTransport {
+	return &RecordingTransport{inner: inner, logger: logger}
+}
+
+// Send 记录并发送
+func (t *RecordingTransport) Send(msg CANMessage) error {
+	t.logger.Log(canLogTX, msg)
+	return t.inner.Send(msg)
+}
+
+// SendBatch 记录并批量发送
+func (t *RecordingTransport) SendBatch(msgs []CANMessage) (BatchResult, error) {
+	for _, msg := range msgs {
+		t.logger.Log(canLogTX, msg)
+	}
+	return sendBatch(t.inner, msgs)
+}
+
+// Subscribe 订阅并记录收到的帧
+func (t *RecordingTransport) Subscribe(iface string, filter CANFilter) (*Subscription, error) {
+	sub, err := t.inner.Subscribe(iface, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan CANMessage, 256)
+	go func() {
+		defer close(ch)
+		for msg := range sub.C {
+			t.logger.Log(canLogRX, msg)
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	}()
+	return &Subscription{C: ch, cancel: sub.Close}, nil
+}
+
+// Close 关闭底层传输
+func (t *RecordingTransport) Close() error {
+	return t.inner.Close()
+}
+
+// ----------------------------------回放----------------------------------
+
+// candumpEntry 日志中的一帧
+type candumpEntry struct {
+	Time      time.Time
+	Direction string
+	Msg       CANMessage
+}
+
+// parseCandumpLine 解析一行 candump -l 日志
+func parseCandumpLine(line string) (candumpEntry, error) {
+	var e candumpEntry
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[0], "(") || !strings.HasSuffix(fields[0], ")") {
+		return e, fmt.Errorf("无效的日志行: %s", line)
+	}
+
+	ts := strings.Trim(fields[0], "()")
+	parts := strings.SplitN(ts, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return e, fmt.Errorf("无效的时间戳: %s", ts)
+	}
+	var usec int64
+	if len(parts) == 2 {
+		if usec, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return e, fmt.Errorf("无效的时间戳: %s", ts)
+		}
+	}
+	e.Time = time.Unix(sec, usec*1000)
+
+	frame := strings.SplitN(fields[2], "#", 2)
+	if len(frame) != 2 {
+		return e, fmt.Errorf("无效的帧: %s", fields[2])
+	}
+	id, err := strconv.ParseUint(frame[0], 16, 32)
+	if err != nil {
+		return e, fmt.Errorf("无效的帧ID: %s", frame[0])
+	}
+	data, err := hex.DecodeString(frame[1])
+	if err != nil {
+		return e, fmt.Errorf("无效的帧数据: %s", frame[1])
+	}
+
+	e.Msg = CANMessage{
+		Interface: fields[1],
+		ID:        uint32(id),
+		Data:      data,
+		Extended:  len(frame[0]) > 3,
+	}
+	// 没有方向标记的日志（如 candump -l 原始输出）视为发送帧
+	e.Direction = canLogTX
+	if len(fields) > 3 {
+		e.Direction = fields[3]
+	}
+	return e, nil
+}
+
+// ReplayOptions 回放选项
+type ReplayOptions struct {
+	Interface  string // 只回放该接口，空为全部
+	ID         int64  // 只回放该ID，-1为全部
+	IncludeRX  bool   // 同时回放接收方向的帧
+	SpeedScale float64
+
+	Latch *EStopLatch // 锁定时停止回放（只放行停止帧和读取帧）
+}
+
+// ReplayCANLog 按原始时间间隔把日志中的帧重新发送到传输上。
+// latch 锁定后遇到运动帧即停止回放
+func ReplayCANLog(path string, transports *TransportSet, opts ReplayOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开CAN日志失败: %v", err)
+	}
+	defer f.Close()
+
+	if opts.SpeedScale <= 0 {
+		opts.SpeedScale = 1
+	}
+
+	var entries []candumpEntry
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := parseCandumpLine(line)
+		if err != nil {
+			return fmt.Errorf("第 %d 行: %v", lineNo, err)
+		}
+		if e.Direction == canLogRX && !opts.IncludeRX {
+			continue
+		}
+		if opts.Interface != "" && e.Msg.Interface != opts.Interface {
+			continue
+		}
+		if opts.ID >= 0 && int64(e.Msg.ID) != opts.ID {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取CAN日志失败: %v", err)
+	}
+
+	log.Printf("回放 %s: %d 帧", path, len(entries))
+	start := time.Now()
+	for i, e := range entries {
+		offset := time.Duration(float64(e.Time.Sub(entries[0].Time)) / opts.SpeedScale)
+		if wait := time.Until(start.Add(offset)); wait > 0 {
+			time.Sleep(wait)
+		}
+		if motionFrame(e.Msg) {
+			if err := opts.Latch.Check(); err != nil {
+				return fmt.Errorf("回放在第 %d 帧停止: %v", i+1, err)
+			}
+		}
+		if err := transports.Send(e.Msg); err != nil {
+			return fmt.Errorf("回放第 %d 帧失败: %v", i+1, err)
+		}
+	}
+	log.Printf("回放完成，用时 %v", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// replayServerRunning 运行中的Web服务器能否响应 /api/estop
+func replayServerRunning(serverURL string) bool {
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get(strings.TrimRight(serverURL, "/") + "/api/estop")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+// guardReplay 回放期间周期查询Web服务器，直到 stop 关闭；服务器启动后锁定 latch，
+// 回放在下一个运动帧停止。命令行回放不在服务器的占用表中，不能与服务器同时向总线发帧
+func guardReplay(serverURL string, latch *EStopLatch, interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if replayServerRunning(serverURL) {
+					if latch.Engage("Web服务器 " + serverURL + " 已启动") {
+						log.Printf("🛑 Web服务器 %s 已启动，停止回放", serverURL)
+					}
+					return
+				}
+			}
+		}
+	}()
+}
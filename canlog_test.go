@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayServerRunning(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	if !replayServerRunning(url) {
+		t.Error("服务器运行时 replayServerRunning() = false")
+	}
+	srv.Close()
+	if replayServerRunning(url) {
+		t.Error("服务器停止后 replayServerRunning() = true")
+	}
+}
+
+func TestReplayStopsWhenServerStarts(t *testing.T) {
+	// 1秒内每10ms一个运动帧（写 loc_ref）
+	var lines []string
+	for i := 0; i < 100; i++ {
+		lines = append(lines, fmt.Sprintf("(1700000000.%06d) can2 1200FD3D#1670000000000000 T", i*10000))
+	}
+	path := filepath.Join(t.TempDir(), "replay.log")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 先取一个空闲端口，回放开始后才在该端口启动服务器
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	started := make(chan *httptest.Server, 1)
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			started <- nil
+			return
+		}
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srv.Listener = l
+		srv.Start()
+		started <- srv
+	}()
+
+	transports, err := NewTransportSet(&Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transports.Close()
+	latch := &EStopLatch{}
+	stop := make(chan struct{})
+	defer close(stop)
+	guardReplay("http://"+addr, latch, 20*time.Millisecond, stop)
+
+	err = ReplayCANLog(path, transports, ReplayOptions{ID: -1, SpeedScale: 1, Latch: latch})
+	if srv := <-started; srv != nil {
+		defer srv.Close()
+	} else {
+		t.Skip("端口已被占用")
+	}
+	if err == nil {
+		t.Fatal("服务器启动后回放未停止")
+	}
+	if n := len(transports.Capture().Frames()); n == 0 || n >= len(lines) {
+		t.Errorf("回放了 %d 帧，want 0 < n < %d", n, len(lines))
+	}
+}
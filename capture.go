@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const transportDryRun = "dry-run"
+
+// maxCapturedFrames 干运行最多保留的帧数，超出后覆盖最早的帧（Web模式下长时间运行时内存不再增长）
+const maxCapturedFrames = 100000
+
+// CapturedFrame 干运行时记录的一帧
+type CapturedFrame struct {
+	Time      time.Time `json:"time"`
+	Interface string    `json:"interface"`
+	ID        string    `json:"id"` // 十六进制
+	Extended  bool      `json:"extended"`
+	Data      string    `json:"data"` // 十六进制
+	Meaning   string    `json:"meaning"`
+}
+
+// CaptureTransport 干运行传输：记录待发送的帧并返回成功，不触碰总线。
+// 只保留最近 maxCapturedFrames 帧，更早的帧计入 dropped
+type CaptureTransport struct {
+	mu      sync.Mutex
+	frames  []CapturedFrame // 环形缓冲，满后 next 为最早的帧
+	next    int
+	dropped int
+	subs    *subscriberSet
+}
+
+// NewCaptureTransport 创建干运行传输
+func NewCaptureTransport() *CaptureTransport {
+	return &CaptureTransport{subs: newSubscriberSet()}
+}
+
+// Send 记录一帧并打印
+func (t *CaptureTransport) Send(msg CANMessage) error {
+	frame := CapturedFrame{
+		Time:      time.Now(),
+		Interface: msg.Interface,
+		ID:        formatCANID(msg.ID, msg.Extended),
+		Extended:  msg.Extended,
+		Data:      hex.EncodeToString(msg.Data),
+		Meaning:   describeFrame(msg),
+	}
+
+	t.mu.Lock()
+	if len(t.frames) < maxCapturedFrames {
+		t.frames = append(t.frames, frame)
+	} else {
+		t.frames[t.next] = frame
+		t.next = (t.next + 1) % maxCapturedFrames
+		t.dropped++
+	}
+	t.mu.Unlock()
+
+	log.Printf("[dry-run] %s %s#%s %s", frame.Interface, frame.ID, frame.Data, frame.Meaning)
+	return nil
+}
+
+// Subscribe 干运行下没有设备响应，订阅不会收到任何帧
+func (t *CaptureTransport) Subscribe(iface string, filter CANFilter) (*Subscription, error) {
+	return t.subs.add(iface, filter), nil
+}
+
+// isCaptureTransport 传输是否为干运行记录（可能套有帧日志记录层）
+func isCaptureTransport(t CANTransport) bool {
+	if r, ok := t.(*RecordingTransport); ok {
+		t = r.inner
+	}
+	_, ok := t.(*CaptureTransport)
+	return ok
+}
+
+// Close 干运行传输无需释放资源
+func (t *CaptureTransport) Close() error {
+	return nil
+}
+
+// Frames 获取已记录的帧（按时间顺序）
+func (t *CaptureTransport) Frames() []CapturedFrame {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	frames := make([]CapturedFrame, 0, len(t.frames))
+	frames = append(frames, t.frames[t.next:]...)
+	return append(frames, t.frames[:t.next]...)
+}
+
+// Dropped 因超出 maxCapturedFrames 被覆盖的帧数
+func (t *CaptureTransport) Dropped() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// Reset 清空记录
+func (t *CaptureTransport) Reset() {
+	t.mu.Lock()
+	t.frames = nil
+	t.next = 0
+	t.dropped = 0
+	t.mu.Unlock()
+}
+
+// WriteFile 把记录保存为JSON文件
+func (t *CaptureTransport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(t.Frames(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化帧记录失败: %v", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("写入帧记录失败: %v", err)
+	}
+	if dropped := t.Dropped(); dropped > 0 {
+		log.Printf("⚠️ 帧记录超过 %d 帧，最早的 %d 帧未保存", maxCapturedFrames, dropped)
+	}
+	return nil
+}
+
+// formatCANID 按candump习惯格式化ID：扩展帧8位，标准帧3位
+func formatCANID(id uint32, extended bool) string {
+	if extended {
+		return fmt.Sprintf("%08X", id)
+	}
+	return fmt.Sprintf("%03X", id)
+}
+
+// describeFrame 把一帧解释为可读含义
+func describeFrame(msg CANMessage) string {
+	data := make([]byte, 8)
+	copy(data, msg.Data)
+
+	if !msg.Extended {
+		if len(msg.Data) >= 7 && msg.Data[0] == 0x01 {
+			return fmt.Sprintf("手部 0x%X 手指 %v", msg.ID, msg.Data[1:7])
+		}
+		return fmt.Sprintf("标准帧 0x%X", msg.ID)
+	}
+
+	frameType := (msg.ID >> 24) & 0x1F
+	motorID := msg.ID & 0xFF
+	idx := binary.LittleEndian.Uint16(data[0:2])
+	value := math.Float32frombits(binary.LittleEndian.Uint32(data[4:8]))
+
+	switch frameType {
+	case typeMotorEnable:
+		return fmt.Sprintf("电机 %d 使能", motorID)
+	case typeMotorStop:
+		if data[0] == 0x01 {
+			return fmt.Sprintf("电机 %d 清除错误", motorID)
+		}
+		return fmt.Sprintf("电机 %d 停止", motorID)
+	case typeSetZero:
+		return fmt.Sprintf("电机 %d 设置零位", motorID)
+	case typeWriteSingle:
+		p, ok := lookupParam(idx)
+		if ok && p.Type == paramUint8 {
+			return fmt.Sprintf("电机 %d 写参数 %s=%d", motorID, paramLabel(idx), data[4])
+		}
+		text := fmt.Sprintf("电机 %d 写参数 %s=%.4f", motorID, paramLabel(idx), value)
+		if ok && p.Unit != "" {
+			text += " " + p.Unit
+		}
+		return text
+	case typeReadSingle:
+		return fmt.Sprintf("电机 %d 读参数 %s", motorID, paramLabel(idx))
+	case typeMITControl:
+		return fmt.Sprintf("电机 %d 运控 位置=%.4f 速度=%.4f 力矩=%.4f", motorID,
+			decodeRange(binary.BigEndian.Uint16(data[0:2]), feedbackPosRange),
+			decodeRange(binary.BigEndian.Uint16(data[2:4]), feedbackVelRange),
+			decodeRange(uint16(msg.ID>>8), feedbackTorqueRange))
+	}
+	return fmt.Sprintf("类型 0x%02X 电机 %d", frameType, motorID)
+}
+
+// dryRunTraceHandler 下载(GET)或清空(DELETE)干运行帧记录
+func (ws *WebServer) dryRunTraceHandler(w http.ResponseWriter, r *http.Request) {
+	capture := ws.transports.Capture()
+	if capture == nil {
+		http.Error(w, "未启用dry_run", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		frames := capture.Frames()
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", "attachment; filename=dryrun_trace.csv")
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"time", "interface", "id", "extended", "data", "meaning"})
+			for _, f := range frames {
+				cw.Write([]string{
+					f.Time.Format(time.RFC3339Nano), f.Interface, f.ID,
+					strconv.FormatBool(f.Extended), f.Data, f.Meaning,
+				})
+			}
+			cw.Flush()
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", "attachment; filename=dryrun_trace.json")
+		message := fmt.Sprintf("共 %d 帧", len(frames))
+		if dropped := capture.Dropped(); dropped > 0 {
+			message += fmt.Sprintf("（超过 %d 帧，最早的 %d 帧已丢弃）", maxCapturedFrames, dropped)
+		}
+		w.Header().Set("X-Dropped-Frames", strconv.Itoa(capture.Dropped()))
+		json.NewEncoder(w).Encode(ControlResponse{
+			Success: true,
+			Message: message,
+			Data:    frames,
+		})
+
+	case "DELETE":
+		capture.Reset()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ControlResponse{Success: true, Message: "已清空帧记录"})
+
+	default:
+		http.Error(w, "不支持的HTTP方法", http.StatusMethodNotAllowed)
+	}
+}
+
+// isCapture 传输是否为干运行记录传输（可能套有帧日志记录层）：不访问总线，没有反馈
+func isCapture(t CANTransport) bool {
+	if r, ok := t.(*RecordingTransport); ok {
+		t = r.inner
+	}
+	_, ok := t.(*CaptureTransport)
+	return ok
+}
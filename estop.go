@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EStopLatch 急停锁定。锁定期间拒绝所有运动和手部指令，控制器只放行停止帧和读取帧，
+// 直到带原因的 /api/estop/reset
+type EStopLatch struct {
+	mu          sync.Mutex
+	latched     bool
+	reason      string
+	since       time.Time
+	resetReason string
+	resetAt     time.Time
+}
+
+// EStopStatus 急停状态，出现在各状态响应中
+type EStopStatus struct {
+	Latched     bool       `json:"latched"`
+	Reason      string     `json:"reason,omitempty"`
+	Since       *time.Time `json:"since,omitempty"`
+	ResetReason string     `json:"reset_reason,omitempty"` // 上一次解除的原因
+	ResetAt     *time.Time `json:"reset_at,omitempty"`
+}
+
+// Engage 锁定，已锁定时保留最初的原因，返回是否新锁定
+func (l *EStopLatch) Engage(reason string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.latched {
+		return false
+	}
+	l.latched = true
+	l.reason = reason
+	l.since = time.Now()
+	return true
+}
+
+// Reset 解除锁定，必须给出原因
+func (l *EStopLatch) Reset(reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("解除急停必须填写原因")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.latched {
+		return fmt.Errorf("急停未锁定")
+	}
+	l.latched = false
+	l.resetReason = reason
+	l.resetAt = time.Now()
+	return nil
+}
+
+// EStopError 急停锁定期间被拒绝的指令
+type EStopError struct {
+	Reason string
+}
+
+func (e *EStopError) Error() string {
+	return fmt.Sprintf("急停已锁定（%s），需 POST /api/estop/reset 解除", e.Reason)
+}
+
+// Check 锁定时返回 EStopError（nil 锁不检查）
+func (l *EStopLatch) Check() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.latched {
+		return &EStopError{Reason: l.reason}
+	}
+	return nil
+}
+
+// Status 急停状态快照
+func (l *EStopLatch) Status() *EStopStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := &EStopStatus{Latched: l.latched, ResetReason: l.resetReason}
+	if l.latched {
+		t := l.since
+		st.Reason = l.reason
+		st.Since = &t
+	}
+	if !l.resetAt.IsZero() {
+		t := l.resetAt
+		st.ResetAt = &t
+	}
+	return st
+}
+
+// motionFrame 急停锁定时需要拦截的帧：除停止帧和读取帧外的电机帧
+func motionFrame(msg CANMessage) bool {
+	switch (msg.ID >> 24) & 0x1F {
+	case typeMotorStop, typeReadSingle:
+		return false
+	}
+	return true
+}
+
+// EStopReport 急停执行结果
+type EStopReport struct {
+	Reason    string            `json:"reason"`
+	Cancelled []string          `json:"cancelled_jobs,omitempty"`
+	Stopped   map[string][]int  `json:"stopped"`          // 接口 -> 已发送停止帧的电机
+	Hands     []string          `json:"hands"`            // 已置于安全姿态的手部接口
+	Errors    map[string]string `json:"errors,omitempty"` // 接口 -> 发送失败原因
+}
+
+// sendEStopFrames 向配置中每条手臂的每个电机发送停止帧，并把两手置于防撞预动作姿态。
+// 单个电机或手部发送失败不影响其余的发送
+func sendEStopFrames(config *Config, transports *TransportSet) EStopReport {
+	report := EStopReport{Stopped: make(map[string][]int), Errors: make(map[string]string)}
+	for iface, arm := range config.Arms {
+		var failed []string
+		for _, motorID := range armMotorIDs(arm) {
+			err := transports.For(iface).Send(CANMessage{
+				Interface: iface,
+				ID:        (uint32(typeMotorStop) << 24) | (uint32(defaultHostID) << 8) | uint32(motorID),
+				Data:      make([]byte, 8),
+				Extended:  true,
+			})
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("电机 %d: %v", motorID, err))
+				continue
+			}
+			report.Stopped[iface] = append(report.Stopped[iface], motorID)
+		}
+		if len(failed) > 0 {
+			report.Errors[iface] = strings.Join(failed, "; ")
+		}
+	}
+
+	leftDeviceID, rightDeviceID := getHandDeviceID(config)
+	for _, hand := range []struct {
+		side     string
+		deviceID int
+		pose     []int
+	}{{"left", leftDeviceID, config.HandsLeft}, {"right", rightDeviceID, config.HandsRight}} {
+		handConfig, ok := config.Hands[hand.side]
+		if !ok {
+			continue
+		}
+		// 安全姿态是急停动作的一部分，不经过锁定检查
+		if err := sendHandCommandDirect(transports, nil, handConfig.Interface, hand.deviceID, hand.pose); err != nil {
+			report.Errors[handConfig.Interface] = err.Error()
+			continue
+		}
+		report.Hands = append(report.Hands, handConfig.Interface)
+	}
+	return report
+}
+
+// emergencyStop 锁定急停、取消所有任务、结束点动会话，然后停止所有电机并把手部置于安全姿态
+func (ws *WebServer) emergencyStop(reason string) EStopReport {
+	if ws.estop.Engage(reason) {
+		log.Printf("🛑 急停: %s", reason)
+	} else {
+		log.Printf("🛑 急停（已锁定）: %s", reason)
+	}
+	cancelled := ws.jobs.CancelAll()
+	ws.closeAllJogs("急停")
+	ws.leases.ReleaseAll()
+
+	ws.mutex.RLock()
+	config := ws.config
+	ws.mutex.RUnlock()
+	report := sendEStopFrames(config, ws.transports)
+	report.Reason = reason
+	report.Cancelled = cancelled
+	for iface, e := range report.Errors {
+		log.Printf("🛑 急停 %s 发送失败: %s", iface, e)
+	}
+	return report
+}
+
+// estopHandler 急停
+// GET  /api/estop              急停状态
+// POST /api/estop              {"reason":"..."} 急停并锁定
+// POST /api/estop/reset        {"reason":"..."} 解除锁定
+func (ws *WebServer) estopHandler(w http.ResponseWriter, r *http.Request) {
+	var response ControlResponse
+	switch {
+	case r.Method == "GET":
+		response.Success = true
+		response.Message = "获取急停状态成功"
+
+	case r.Method == "POST" && r.URL.Path == "/api/estop":
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Reason == "" {
+			req.Reason = "操作员急停"
+		}
+		report := ws.emergencyStop(req.Reason)
+		response.Success = len(report.Errors) == 0
+		response.Message = "急停已执行并锁定"
+		if !response.Success {
+			response.Message = "急停已锁定，部分设备发送失败"
+		}
+		response.Data = report
+
+	case r.Method == "POST" && r.URL.Path == "/api/estop/reset":
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "解析请求失败", http.StatusBadRequest)
+			return
+		}
+		if err := ws.estop.Reset(req.Reason); err != nil {
+			response.Message = err.Error()
+			break
+		}
+		log.Printf("急停已解除: %s", req.Reason)
+		response.Success = true
+		response.Message = "急停已解除"
+
+	default:
+		http.Error(w, "路径格式应为 /api/estop 或 /api/estop/reset", http.StatusBadRequest)
+		return
+	}
+	response.EStop = ws.estop.Status()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// withEStopHeader 在每个API响应头中给出急停状态（X-EStop: latched / clear）
+func (ws *WebServer) withEStopHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			state := "clear"
+			if ws.estop.Check() != nil {
+				state = "latched"
+			}
+			w.Header().Set("X-EStop", state)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestRemoteEStop 命令行急停时通知运行中的Web服务器锁定（服务器未运行时忽略）
+func requestRemoteEStop(serverURL, reason string) (*EStopStatus, error) {
+	body, _ := json.Marshal(map[string]string{"reason": reason})
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Post(strings.TrimRight(serverURL, "/")+"/api/estop", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var response ControlResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("解析服务器响应失败: %v", err)
+	}
+	return response.EStop, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// motorFaultBits 反馈帧ID bit16-21 的故障含义（按位序号从低到高）
+var motorFaultBits = []struct {
+	Name string
+	Desc string
+}{
+	{"under_voltage", "欠压"},
+	{"over_current", "过流"},
+	{"over_temperature", "过温"},
+	{"magnetic_encoder", "磁编码故障"},
+	{"hall_encoder", "HALL编码故障"},
+	{"uncalibrated", "未标定"},
+}
+
+// faultClearTimeout 清除错误后等待电机反馈的时限
+const faultClearTimeout = 300 * time.Millisecond
+
+// decodeFaults 把故障位解析为故障名称列表
+func decodeFaults(bits uint8) []string {
+	var names []string
+	for i, f := range motorFaultBits {
+		if bits&(1<<uint(i)) != 0 {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// FaultRecord 一个电机上一种故障的记录
+type FaultRecord struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"` // 最近一帧反馈中是否仍存在
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// recordFaults 按一帧反馈更新电机的故障记录，调用方持有锁
+func (s *TelemetryStore) recordFaults(t MotorTelemetry) {
+	records := s.faults[t.MotorID]
+	if records == nil {
+		if t.FaultBits == 0 {
+			return
+		}
+		records = make(map[string]*FaultRecord)
+		s.faults[t.MotorID] = records
+	}
+
+	for _, r := range records {
+		r.Active = false
+	}
+	for i, f := range motorFaultBits {
+		if t.FaultBits&(1<<uint(i)) == 0 {
+			continue
+		}
+		r, ok := records[f.Name]
+		if !ok {
+			r = &FaultRecord{Name: f.Name, Description: f.Desc, FirstSeen: t.Updated}
+			records[f.Name] = r
+		}
+		r.Active = true
+		r.LastSeen = t.Updated
+	}
+}
+
+// Faults 返回各电机的故障记录（只含出现过故障的电机）
+func (s *TelemetryStore) Faults() map[string][]FaultRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string][]FaultRecord)
+	for id, records := range s.faults {
+		if len(records) == 0 {
+			continue
+		}
+		list := make([]FaultRecord, 0, len(records))
+		for _, r := range records {
+			list = append(list, *r)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].FirstSeen.Before(list[j].FirstSeen) })
+		out[fmt.Sprint(id)] = list
+	}
+	return out
+}
+
+// activeFaults 电机最近一帧反馈中的故障
+func (s *TelemetryStore) activeFaults(motorID int) []string {
+	t, ok := s.Get(motorID)
+	if !ok {
+		return nil
+	}
+	return decodeFaults(t.FaultBits)
+}
+
+// forgetCleared 删除已不再出现的故障记录
+func (s *TelemetryStore) forgetCleared(motorID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, r := range s.faults[motorID] {
+		if !r.Active {
+			delete(s.faults[motorID], name)
+		}
+	}
+}
+
+// waitFeedback 等待电机在 since 之后上报反馈，返回是否都已上报
+func (s *TelemetryStore) waitFeedback(motorIDs []int, since time.Time, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		fresh := true
+		for _, id := range motorIDs {
+			if t, ok := s.Get(id); !ok || t.Updated.Before(since) {
+				fresh = false
+				break
+			}
+		}
+		if fresh {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// FaultClearResult 单个电机清除错误前后的故障
+type FaultClearResult struct {
+	Before    []string `json:"before"`
+	After     []string `json:"after"`
+	Cleared   bool     `json:"cleared"`
+	Confirmed bool     `json:"confirmed"` // 清除后是否收到了电机反馈
+}
+
+// cleanErrors 清除手臂所有电机的错误，并根据清除前后的反馈报告各电机的故障是否已消除
+func (ws *WebServer) cleanErrors(iface string, controller *BlackArmController) (map[string]FaultClearResult, error) {
+	store := ws.telemetry[iface]
+	motorIDs := controller.GetMotorIDs()
+
+	results := make(map[string]FaultClearResult, len(motorIDs))
+	for _, id := range motorIDs {
+		var r FaultClearResult
+		if store != nil {
+			r.Before = store.activeFaults(id)
+		}
+		results[fmt.Sprint(id)] = r
+	}
+
+	sentAt := time.Now()
+	if err := controller.CleanError(); err != nil {
+		return results, err
+	}
+	if store == nil {
+		return results, nil
+	}
+
+	store.waitFeedback(motorIDs, sentAt, faultClearTimeout)
+	for _, id := range motorIDs {
+		r := results[fmt.Sprint(id)]
+		if t, ok := store.Get(id); ok && !t.Updated.Before(sentAt) {
+			r.Confirmed = true
+			r.After = decodeFaults(t.FaultBits)
+			r.Cleared = len(r.After) == 0
+			if r.Cleared {
+				store.forgetCleared(id)
+			}
+		}
+		results[fmt.Sprint(id)] = r
+	}
+	return results, nil
+}
+
+// summarizeFaultClear 生成清除错误结果的说明
+func summarizeFaultClear(results map[string]FaultClearResult) string {
+	ids := make([]string, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var cleared, remaining, unconfirmed []string
+	for _, id := range ids {
+		r := results[id]
+		switch {
+		case !r.Confirmed:
+			unconfirmed = append(unconfirmed, id)
+		case !r.Cleared:
+			remaining = append(remaining, fmt.Sprintf("%s(%s)", id, strings.Join(r.After, ",")))
+		case len(r.Before) > 0:
+			cleared = append(cleared, fmt.Sprintf("%s(%s)", id, strings.Join(r.Before, ",")))
+		}
+	}
+
+	var parts []string
+	if len(cleared) > 0 {
+		parts = append(parts, "已清除: "+strings.Join(cleared, " "))
+	}
+	if len(remaining) > 0 {
+		parts = append(parts, "仍有故障: "+strings.Join(remaining, " "))
+	}
+	if len(unconfirmed) > 0 {
+		parts = append(parts, "无反馈未确认: "+strings.Join(unconfirmed, " "))
+	}
+	if len(parts) == 0 {
+		return "清除错误成功，所有电机无故障"
+	}
+	return "清除错误完成，" + strings.Join(parts, "；")
+}
+
+// faultsHandler 返回各接口电机的故障记录，?interface= 只看一个接口
+func (ws *WebServer) faultsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "只支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	iface := r.URL.Query().Get("interface")
+	faults := make(map[string]map[string][]FaultRecord)
+	active := 0
+	var unavailable []string
+	for name, store := range ws.telemetry {
+		if iface != "" && name != iface {
+			continue
+		}
+		if reason := store.Unavailable(); reason != "" {
+			unavailable = append(unavailable, fmt.Sprintf("%s(%s)", name, reason))
+		}
+		records := store.Faults()
+		for _, list := range records {
+			for _, rec := range list {
+				if rec.Active {
+					active++
+				}
+			}
+		}
+		faults[name] = records
+	}
+
+	message := fmt.Sprintf("当前 %d 个故障", active)
+	if len(unavailable) > 0 {
+		sort.Strings(unavailable)
+		message += "；以下接口没有电机反馈，故障不可见: " + strings.Join(unavailable, "; ")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ControlResponse{
+		Success: len(unavailable) == 0,
+		Message: message,
+		Data:    faults,
+		EStop:   ws.estop.Status(),
+	})
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobState 运动任务状态
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobPaused    JobState = "paused"
+	JobCancelled JobState = "cancelled"
+	JobFailed    JobState = "failed"
+	JobDone      JobState = "done"
+)
+
+// maxFinishedJobs 保留的已结束任务数量
+const maxFinishedJobs = 50
+
+// errJobCancelled 任务在安全点被取消
+var errJobCancelled = errors.New("任务已取消")
+
+// Job 一次序列执行。执行函数在每个安全点（角度组之间、流程步骤之间）调用 Checkpoint，
+// 暂停时在安全点阻塞，取消时在安全点返回 errJobCancelled
+type Job struct {
+	ID         string
+	Kind       string   // "sequence" 单臂序列，"merged" 合并序列
+	Name       string   // 序列名称或文件名
+	Interfaces []string // 占用的手臂/手部接口，接口重叠的任务排队执行
+
+	mu              sync.Mutex
+	cond            *sync.Cond
+	state           JobState
+	cancelRequested bool
+	cancelCh        chan struct{}
+	done            chan struct{} // 任务结束时关闭
+	step            string
+	progress        map[string]int // 接口 -> 当前角度组序号（从0开始）
+	total           map[string]int // 接口 -> 角度组数量
+	err             string
+	report          *SequenceReport // 上举/下放流程的步骤报告
+	created         time.Time
+	started         time.Time
+	finished        time.Time
+
+	run func(*Job) error
+}
+
+// JobStatus 任务状态快照
+type JobStatus struct {
+	ID              string          `json:"id"`
+	Kind            string          `json:"kind"`
+	Name            string          `json:"name"`
+	Interfaces      []string        `json:"interfaces"`
+	State           JobState        `json:"state"`
+	CancelRequested bool            `json:"cancel_requested,omitempty"`
+	Step            string          `json:"step"`     // 当前步骤说明
+	Progress        map[string]int  `json:"progress"` // 接口 -> 当前角度组序号
+	Total           map[string]int  `json:"total"`    // 接口 -> 角度组数量
+	Error           string          `json:"error,omitempty"`
+	Report          *SequenceReport `json:"report,omitempty"` // 上举/下放流程中完成、继续和导致中止的步骤
+	Created         time.Time       `json:"created"`
+	Started         *time.Time      `json:"started,omitempty"`
+	Finished        *time.Time      `json:"finished,omitempty"`
+}
+
+// Status 任务状态快照
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := JobStatus{
+		ID:              j.ID,
+		Kind:            j.Kind,
+		Name:            j.Name,
+		Interfaces:      j.Interfaces,
+		State:           j.state,
+		CancelRequested: j.cancelRequested,
+		Step:            j.step,
+		Progress:        make(map[string]int, len(j.progress)),
+		Total:           make(map[string]int, len(j.total)),
+		Error:           j.err,
+		Report:          j.report,
+		Created:         j.created,
+	}
+	for k, v := range j.progress {
+		st.Progress[k] = v
+	}
+	for k, v := range j.total {
+		st.Total[k] = v
+	}
+	if !j.started.IsZero() {
+		t := j.started
+		st.Started = &t
+	}
+	if !j.finished.IsZero() {
+		t := j.finished
+		st.Finished = &t
+	}
+	return st
+}
+
+// finishedLocked 任务是否已结束，调用方持有 j.mu
+func (j *Job) finishedLocked() bool {
+	return j.state == JobCancelled || j.state == JobFailed || j.state == JobDone
+}
+
+// SetStep 记录当前流程步骤并检查暂停/取消（nil 任务不做任何事）
+func (j *Job) SetStep(step string) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	j.step = step
+	j.mu.Unlock()
+	return j.Checkpoint()
+}
+
+// SetReport 记录流程的步骤报告
+func (j *Job) SetReport(report *SequenceReport) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.report = report
+	j.mu.Unlock()
+}
+
+// SetTotal 记录接口上的角度组数量
+func (j *Job) SetTotal(iface string, n int) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.total[iface] = n
+	j.mu.Unlock()
+}
+
+// AngleCheckpoint 记录接口即将执行第 i 组角度，并检查暂停/取消
+func (j *Job) AngleCheckpoint(iface string, i int) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	j.progress[iface] = i
+	j.mu.Unlock()
+	return j.Checkpoint()
+}
+
+// Checkpoint 安全点：暂停时阻塞直到恢复或取消，已取消时返回 errJobCancelled
+func (j *Job) Checkpoint() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for j.state == JobPaused && !j.cancelRequested {
+		j.cond.Wait()
+	}
+	if j.cancelRequested {
+		return errJobCancelled
+	}
+	return nil
+}
+
+// Sleep 可被取消打断的等待
+func (j *Job) Sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	if j == nil {
+		time.Sleep(d)
+		return nil
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-j.cancelCh:
+		return errJobCancelled
+	}
+}
+
+// lease 任务对接口的占用
+func (j *Job) lease() Lease {
+	return Lease{Kind: leaseJob, ID: j.ID}
+}
+
+// Wait 等待任务结束，超时返回 false
+func (j *Job) Wait(timeout time.Duration) bool {
+	select {
+	case <-j.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Pause 在下一个安全点暂停
+func (j *Job) Pause() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.state != JobRunning {
+		return fmt.Errorf("任务 %s 处于 %s 状态，无法暂停", j.ID, j.state)
+	}
+	j.state = JobPaused
+	return nil
+}
+
+// Resume 恢复暂停的任务
+func (j *Job) Resume() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.state != JobPaused {
+		return fmt.Errorf("任务 %s 处于 %s 状态，无法恢复", j.ID, j.state)
+	}
+	j.state = JobRunning
+	j.cond.Broadcast()
+	return nil
+}
+
+// Cancel 取消任务：排队中的任务直接取消，运行中的任务在下一个安全点停止
+func (j *Job) Cancel() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.finishedLocked() {
+		return fmt.Errorf("任务 %s 已结束（%s）", j.ID, j.state)
+	}
+	if !j.cancelRequested {
+		j.cancelRequested = true
+		close(j.cancelCh)
+	}
+	if j.state == JobQueued {
+		j.state = JobCancelled
+		j.finished = time.Now()
+		close(j.done)
+	}
+	j.cond.Broadcast()
+	return nil
+}
+
+// JobManager 运动任务管理：接口不重叠的任务并行执行，重叠的按提交顺序排队。
+// 运行中的任务占用其接口（见 LeaseManager）
+type JobManager struct {
+	mu     sync.Mutex
+	jobs   []*Job // 按提交顺序
+	next   int
+	leases *LeaseManager
+}
+
+// NewJobManager 创建任务管理器
+func NewJobManager(leases *LeaseManager) *JobManager {
+	return &JobManager{leases: leases}
+}
+
+// Submit 提交任务，run 在任务开始时于新的goroutine中执行。
+// 接口被点动会话占用时拒绝提交；preempt 为真时先结束点动会话、取消占用这些接口的任务，新任务排在其后
+func (m *JobManager) Submit(kind, name string, interfaces []string, preempt bool, run func(*Job) error) (*Job, error) {
+	if preempt {
+		m.CancelOn(interfaces)
+	}
+	for _, iface := range interfaces {
+		owner, ok := m.leases.Owner(iface)
+		if !ok || owner.Kind == leaseJob {
+			continue
+		}
+		if !preempt {
+			return nil, m.leases.Check(iface, Lease{})
+		}
+		log.Printf("⚠️ 抢占 %s: 原占用者 %s", iface, owner)
+		m.leases.Release(owner)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.next++
+	job := &Job{
+		ID:         fmt.Sprintf("job-%d", m.next),
+		Kind:       kind,
+		Name:       name,
+		Interfaces: interfaces,
+		state:      JobQueued,
+		cancelCh:   make(chan struct{}),
+		done:       make(chan struct{}),
+		progress:   make(map[string]int),
+		total:      make(map[string]int),
+		created:    time.Now(),
+		run:        run,
+	}
+	job.cond = sync.NewCond(&job.mu)
+	m.jobs = append(m.jobs, job)
+	log.Printf("任务 %s 已提交: %s %s 接口 %v", job.ID, kind, name, interfaces)
+
+	m.scheduleLocked()
+	return job, nil
+}
+
+// scheduleLocked 启动可以运行的排队任务，调用方持有 m.mu
+func (m *JobManager) scheduleLocked() {
+	busy := make(map[string]bool)
+	for _, job := range m.jobs {
+		job.mu.Lock()
+		state := job.state
+		job.mu.Unlock()
+
+		switch state {
+		case JobRunning, JobPaused:
+			for _, iface := range job.Interfaces {
+				busy[iface] = true
+			}
+		case JobQueued:
+			free := true
+			for _, iface := range job.Interfaces {
+				// 点动会话占用的接口同样不可用
+				if busy[iface] || m.leases.Check(iface, job.lease()) != nil {
+					free = false
+				}
+				// 排在前面的任务即使未启动也占住接口，保证顺序
+				busy[iface] = true
+			}
+			if free {
+				m.startLocked(job)
+			}
+		}
+	}
+	m.pruneLocked()
+}
+
+// startLocked 占用接口并启动任务，调用方持有 m.mu
+func (m *JobManager) startLocked(job *Job) {
+	if err := m.leases.Acquire(job.Interfaces, job.lease()); err != nil {
+		// scheduleLocked 已检查过占用，只在并发占用时发生，留在队列中
+		return
+	}
+	job.mu.Lock()
+	job.state = JobRunning
+	job.started = time.Now()
+	job.mu.Unlock()
+	log.Printf("任务 %s 开始执行", job.ID)
+
+	go func() {
+		err := job.run(job)
+
+		job.mu.Lock()
+		switch {
+		case errors.Is(err, errJobCancelled) || (err == nil && job.cancelRequested):
+			job.state = JobCancelled
+		case err != nil:
+			job.state = JobFailed
+			job.err = err.Error()
+		default:
+			job.state = JobDone
+		}
+		job.finished = time.Now()
+		state := job.state
+		job.mu.Unlock()
+		log.Printf("任务 %s 结束: %s %s", job.ID, state, job.err)
+
+		m.leases.Release(job.lease())
+		close(job.done)
+		m.mu.Lock()
+		m.scheduleLocked()
+		m.mu.Unlock()
+	}()
+}
+
+// pruneLocked 只保留最近的已结束任务，调用方持有 m.mu
+func (m *JobManager) pruneLocked() {
+	finished := 0
+	for _, job := range m.jobs {
+		job.mu.Lock()
+		if job.finishedLocked() {
+			finished++
+		}
+		job.mu.Unlock()
+	}
+	if finished <= maxFinishedJobs {
+		return
+	}
+	kept := m.jobs[:0]
+	for _, job := range m.jobs {
+		job.mu.Lock()
+		drop := job.finishedLocked() && finished > maxFinishedJobs
+		job.mu.Unlock()
+		if drop {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	m.jobs = kept
+}
+
+// Get 按ID查找任务
+func (m *JobManager) Get(id string) *Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// List 所有任务的状态，按提交顺序
+func (m *JobManager) List() []JobStatus {
+	m.mu.Lock()
+	jobs := append([]*Job(nil), m.jobs...)
+	m.mu.Unlock()
+
+	list := make([]JobStatus, len(jobs))
+	for i, job := range jobs {
+		list[i] = job.Status()
+	}
+	return list
+}
+
+// CancelOn 取消使用任一指定接口的未结束任务（含排队中的），返回这些任务
+func (m *JobManager) CancelOn(interfaces []string) []*Job {
+	m.mu.Lock()
+	jobs := append([]*Job(nil), m.jobs...)
+	m.mu.Unlock()
+
+	var cancelled []*Job
+	for _, job := range jobs {
+		if !sharesInterface(job.Interfaces, interfaces) {
+			continue
+		}
+		if job.Cancel() == nil {
+			log.Printf("任务 %s 被抢占取消", job.ID)
+			cancelled = append(cancelled, job)
+		}
+	}
+	return cancelled
+}
+
+// sharesInterface 两组接口是否有重叠
+func sharesInterface(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CancelAll 取消所有未结束的任务，返回被取消的任务ID
+func (m *JobManager) CancelAll() []string {
+	m.mu.Lock()
+	jobs := append([]*Job(nil), m.jobs...)
+	m.mu.Unlock()
+
+	var ids []string
+	for _, job := range jobs {
+		if job.Cancel() == nil {
+			ids = append(ids, job.ID)
+		}
+	}
+	return ids
+}
+
+// jobsHandler 运动任务管理
+// GET  /api/jobs                     所有任务
+// GET  /api/jobs/{id}                单个任务
+// POST /api/jobs/{id}/pause|resume|cancel
+func (ws *WebServer) jobsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs"), "/")
+	if path == "" {
+		if r.Method != "GET" {
+			http.Error(w, "只支持GET方法", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ControlResponse{Success: true, Message: "获取任务列表成功", Data: ws.jobs.List(), EStop: ws.estop.Status()})
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	job := ws.jobs.Get(parts[0])
+	if job == nil {
+		http.Error(w, "未找到任务: "+parts[0], http.StatusNotFound)
+		return
+	}
+
+	var response ControlResponse
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		response.Success = true
+		response.Message = "获取任务成功"
+
+	case len(parts) == 2 && r.Method == "POST":
+		var err error
+		switch parts[1] {
+		case "pause":
+			err = job.Pause()
+		case "resume":
+			err = job.Resume()
+		case "cancel":
+			err = job.Cancel()
+		default:
+			http.Error(w, "不支持的操作: "+parts[1], http.StatusBadRequest)
+			return
+		}
+		response.Success = err == nil
+		if err != nil {
+			response.Message = err.Error()
+		} else {
+			response.Message = fmt.Sprintf("任务 %s: %s", job.ID, parts[1])
+		}
+
+	default:
+		http.Error(w, "路径格式应为 /api/jobs/{id}[/pause|resume|cancel]", http.StatusBadRequest)
+		return
+	}
+	response.Data = job.Status()
+	response.EStop = ws.estop.Status()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 点动会话心跳超时后的处理
+const (
+	jogHold     = "hold"      // 手臂：以实测位置为目标停住；手部：保持最后指令
+	jogDisable  = "disable"   // 手臂：失能
+	jogSafePose = "safe_pose" // 手部：发送防撞预动作姿态
+)
+
+// 点动会话参数
+const (
+	defaultJogTimeout = 1 * time.Second
+	jogKeepClosed     = 1 * time.Minute // 已结束的会话保留多久，便于客户端查询结束原因
+)
+
+// JogConfig 点动会话（config.yaml 的 jog）
+type JogConfig struct {
+	HeartbeatTimeoutMs int    `yaml:"heartbeat_timeout_ms"` // 超过该时间没有心跳或点动指令即停止，默认1000
+	OnTimeout          string `yaml:"on_timeout"`           // 手臂超时处理: hold（默认）/ disable
+	HandOnTimeout      string `yaml:"hand_on_timeout"`      // 手部超时处理: hold（默认）/ safe_pose
+}
+
+// JogSession 操作员点动会话：打开时占用一个手臂或手部接口，客户端周期发送心跳，
+// 超时未收到心跳或点动指令时服务器停止该接口的运动并结束会话
+type JogSession struct {
+	ID        string
+	Interface string
+	Device    string // arm / hand
+	OnTimeout string
+	Timeout   time.Duration
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	opened   time.Time
+	lastBeat time.Time
+	closed   time.Time
+	reason   string // 结束原因
+}
+
+// JogStatus 点动会话状态
+type JogStatus struct {
+	ID        string     `json:"id"`
+	Interface string     `json:"interface"`
+	Device    string     `json:"device"`
+	OnTimeout string     `json:"on_timeout"`
+	TimeoutMs int64      `json:"timeout_ms"`
+	Opened    time.Time  `json:"opened"`
+	LastBeat  time.Time  `json:"last_beat"`
+	Active    bool       `json:"active"`
+	Closed    *time.Time `json:"closed,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// JogRequest 打开会话或点动指令
+type JogRequest struct {
+	Interface string `json:"interface"`
+	Preempt   bool   `json:"preempt"`
+	OnTimeout string `json:"on_timeout"` // 为空时使用配置
+	TimeoutMs int    `json:"timeout_ms"` // 为空时使用配置
+
+	JointID int         `json:"joint_id"`
+	Delta   float32     `json:"delta"` // 相对上一次指令角度的增量 rad
+	Angle   *float32    `json:"angle"` // 绝对角度，滑动条使用
+	Hand    HandControl `json:"hand"`
+}
+
+func (s *JogSession) lease() Lease {
+	return Lease{Kind: leaseJog, ID: s.ID}
+}
+
+// Status 会话状态快照
+func (s *JogSession) Status() JogStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := JogStatus{
+		ID:        s.ID,
+		Interface: s.Interface,
+		Device:    s.Device,
+		OnTimeout: s.OnTimeout,
+		TimeoutMs: s.Timeout.Milliseconds(),
+		Opened:    s.opened,
+		LastBeat:  s.lastBeat,
+		Active:    s.closed.IsZero(),
+		Reason:    s.reason,
+	}
+	if !s.closed.IsZero() {
+		t := s.closed
+		st.Closed = &t
+	}
+	return st
+}
+
+// close 结束会话，返回是否由本次调用结束
+func (s *JogSession) close(reason string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed.IsZero() {
+		return false
+	}
+	s.closed = time.Now()
+	s.reason = reason
+	s.timer.Stop()
+	return true
+}
+
+// jogPolicy 检查超时处理方式，为空时使用配置或默认值
+func jogPolicy(device, policy string, config JogConfig) (string, error) {
+	if policy == "" {
+		policy = config.OnTimeout
+		if device == "hand" {
+			policy = config.HandOnTimeout
+		}
+	}
+	if policy == "" {
+		return jogHold, nil
+	}
+	switch {
+	case policy == jogHold,
+		device == "arm" && policy == jogDisable,
+		device == "hand" && policy == jogSafePose:
+		return policy, nil
+	}
+	if device == "hand" {
+		return "", fmt.Errorf("手部超时处理应为 hold 或 safe_pose: %s", policy)
+	}
+	return "", fmt.Errorf("手臂超时处理应为 hold 或 disable: %s", policy)
+}
+
+// openJog 打开点动会话并占用接口
+func (ws *WebServer) openJog(req JogRequest) (*JogSession, error) {
+	if err := ws.estop.Check(); err != nil {
+		return nil, err
+	}
+
+	ws.mutex.RLock()
+	_, isArm := ws.controllers[req.Interface]
+	_, isHand := ws.handDeviceID(req.Interface)
+	jogConfig := ws.config.Jog
+	ws.mutex.RUnlock()
+
+	device := "arm"
+	switch {
+	case isArm:
+		if err := ws.posture.CheckMotion(); err != nil {
+			return nil, err
+		}
+	case isHand:
+		device = "hand"
+	default:
+		return nil, fmt.Errorf("未找到接口: %s", req.Interface)
+	}
+	policy, err := jogPolicy(device, req.OnTimeout, jogConfig)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = time.Duration(jogConfig.HeartbeatTimeoutMs) * time.Millisecond
+	}
+	if timeout <= 0 {
+		timeout = defaultJogTimeout
+	}
+
+	if req.Preempt {
+		if err := ws.claimLease([]string{req.Interface}, true, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	ws.jogMu.Lock()
+	defer ws.jogMu.Unlock()
+	ws.jogNext++
+	s := &JogSession{
+		ID:        fmt.Sprintf("jog-%d", ws.jogNext),
+		Interface: req.Interface,
+		Device:    device,
+		OnTimeout: policy,
+		Timeout:   timeout,
+		opened:    time.Now(),
+	}
+	s.lastBeat = s.opened
+	if err := ws.leases.Acquire([]string{req.Interface}, s.lease()); err != nil {
+		return nil, err
+	}
+	s.timer = time.AfterFunc(timeout, func() { ws.jogTimedOut(s) })
+
+	for id, old := range ws.jogs {
+		if st := old.Status(); !st.Active && time.Since(*st.Closed) > jogKeepClosed {
+			delete(ws.jogs, id)
+		}
+	}
+	ws.jogs[s.ID] = s
+	log.Printf("点动会话 %s 打开: %s (%s)，心跳超时 %v 后 %s", s.ID, s.Interface, device, timeout, policy)
+	return s, nil
+}
+
+// beat 收到心跳或点动指令：确认会话仍持有占用并重置超时
+func (ws *WebServer) beat(s *JogSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed.IsZero() {
+		return fmt.Errorf("点动会话 %s 已结束: %s", s.ID, s.reason)
+	}
+	if owner, ok := ws.leases.Owner(s.Interface); !ok || owner.Kind != leaseJog || owner.ID != s.ID {
+		// 提交序列时被抢占
+		s.closed = time.Now()
+		s.reason = "占用已被释放"
+		s.timer.Stop()
+		return fmt.Errorf("点动会话 %s 已结束: %s", s.ID, s.reason)
+	}
+	s.lastBeat = time.Now()
+	s.timer.Reset(s.Timeout)
+	return nil
+}
+
+// endJog 客户端结束会话或会话被抢占，释放占用，不停止运动
+func (ws *WebServer) endJog(s *JogSession, reason string) {
+	if s.close(reason) {
+		ws.leases.Release(s.lease())
+		log.Printf("点动会话 %s 结束: %s", s.ID, reason)
+	}
+}
+
+// endJogByID 按ID结束会话（被抢占），会话不存在时只释放占用
+func (ws *WebServer) endJogByID(id, reason string) {
+	ws.jogMu.Lock()
+	s := ws.jogs[id]
+	ws.jogMu.Unlock()
+	if s == nil {
+		ws.leases.Release(Lease{Kind: leaseJog, ID: id})
+		return
+	}
+	ws.endJog(s, reason)
+}
+
+// closeAllJogs 结束所有会话（急停）
+func (ws *WebServer) closeAllJogs(reason string) {
+	ws.jogMu.Lock()
+	sessions := make([]*JogSession, 0, len(ws.jogs))
+	for _, s := range ws.jogs {
+		sessions = append(sessions, s)
+	}
+	ws.jogMu.Unlock()
+	for _, s := range sessions {
+		ws.endJog(s, reason)
+	}
+}
+
+// jogTimedOut 心跳超时：仍持有占用时按会话的处理方式停止该接口，然后结束会话
+func (ws *WebServer) jogTimedOut(s *JogSession) {
+	owner, ok := ws.leases.Owner(s.Interface)
+	held := ok && owner.Kind == leaseJog && owner.ID == s.ID
+	if !s.close(fmt.Sprintf("心跳超时(%v)，%s", s.Timeout, s.OnTimeout)) {
+		return
+	}
+	ws.leases.Release(s.lease())
+	if !held {
+		log.Printf("点动会话 %s 心跳超时，占用已被释放，不做处理", s.ID)
+		return
+	}
+	log.Printf("⚠️ 点动会话 %s 心跳超时(%v)，%s: %s", s.ID, s.Timeout, s.OnTimeout, s.Interface)
+
+	if s.Device == "hand" {
+		if s.OnTimeout == jogSafePose {
+			if err := ws.handSafePose(s.Interface); err != nil {
+				log.Printf("点动会话 %s 手部安全姿态失败: %v", s.ID, err)
+			}
+		}
+		return
+	}
+
+	ws.mutex.RLock()
+	controller := ws.controllers[s.Interface]
+	ws.mutex.RUnlock()
+	if controller == nil {
+		return
+	}
+	var err error
+	if s.OnTimeout == jogDisable {
+		err = controller.DisableMotor()
+	} else {
+		err = controller.Hold()
+	}
+	if err != nil {
+		log.Printf("点动会话 %s 停止 %s 失败: %v", s.ID, s.Interface, err)
+	}
+}
+
+// Hold 以各关节实测位置(mech_pos)为目标，使正在运动的关节停在当前位置。
+// 读不到位置的关节保持上一次指令角度
+func (b *BlackArmController) Hold() error {
+	reads := make([]paramRead, len(b.MotorIDs))
+	for i, motorID := range b.MotorIDs {
+		reads[i] = paramRead{Motor: motorID, Index: idxMechPos}
+	}
+	if err := b.readParams(reads); err != nil {
+		return err
+	}
+	targets := make(map[int]float32, len(reads))
+	for _, r := range reads {
+		if r.Err == nil {
+			targets[r.Motor] = r.Value
+		}
+	}
+	if len(targets) == 0 {
+		log.Printf("%s 没有位置反馈，保持上一次指令角度", b.Interface)
+		return nil
+	}
+	if _, err := b.sendAngleGroup(targets); err != nil {
+		return err
+	}
+	log.Printf("%s 已停在当前位置: %v", b.Interface, targets)
+	return nil
+}
+
+// handDeviceID 手部接口的设备ID，调用方持有 ws.mutex
+func (ws *WebServer) handDeviceID(iface string) (int, bool) {
+	leftDeviceID, rightDeviceID := getHandDeviceID(ws.config)
+	for side, hand := range ws.config.Hands {
+		if hand.Interface != iface {
+			continue
+		}
+		if side == "left" {
+			return leftDeviceID, true
+		}
+		return rightDeviceID, true
+	}
+	return 0, false
+}
+
+// handSafePose 手部发送防撞预动作姿态
+func (ws *WebServer) handSafePose(iface string) error {
+	ws.mutex.RLock()
+	defer ws.mutex.RUnlock()
+	for side, hand := range ws.config.Hands {
+		if hand.Interface != iface {
+			continue
+		}
+		deviceID, _ := ws.handDeviceID(iface)
+		pose := ws.config.HandsRight
+		if side == "left" {
+			pose = ws.config.HandsLeft
+		}
+		return sendHandCommandDirect(ws.transports, ws.estop, iface, deviceID, pose)
+	}
+	return fmt.Errorf("未找到手部接口: %s", iface)
+}
+
+// jogMove 会话内的一条点动指令：手臂按 angle 或 delta 设置一个关节，手部设置手指
+func (ws *WebServer) jogMove(s *JogSession, req JogRequest) error {
+	if err := ws.estop.Check(); err != nil {
+		return err
+	}
+	if err := ws.beat(s); err != nil {
+		return err
+	}
+
+	if s.Device == "hand" {
+		ws.mutex.RLock()
+		deviceID, _ := ws.handDeviceID(s.Interface)
+		ws.mutex.RUnlock()
+		return ws.sendHandCommand(s.Interface, deviceID, req.Hand)
+	}
+
+	if err := ws.posture.CheckMotion(); err != nil {
+		return err
+	}
+	ws.mutex.RLock()
+	controller, ok := ws.controllers[s.Interface]
+	ws.mutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("未找到手臂接口: %s", s.Interface)
+	}
+	if !controller.isValidJoint(req.JointID) {
+		return fmt.Errorf("无效的关节ID: %d", req.JointID)
+	}
+	var angle float32
+	if req.Angle != nil {
+		angle = *req.Angle
+	} else {
+		base, ok := controller.lastTarget(req.JointID)
+		if !ok {
+			v, err := controller.ReadParam(req.JointID, idxMechPos)
+			if err != nil {
+				return fmt.Errorf("关节 %d 没有上一次指令角度，读取当前位置失败: %v", req.JointID, err)
+			}
+			base = v
+		}
+		angle = base + req.Delta
+	}
+	if err := controller.SetAngle(req.JointID, angle); err != nil {
+		return err
+	}
+	if target, ok := controller.lastTarget(req.JointID); ok {
+		angle = target
+	}
+	ws.updateCurrentAngle(s.Interface, strconv.Itoa(req.JointID), angle)
+	return nil
+}
+
+// jogHandler 点动会话
+// GET    /api/jog                       所有会话
+// POST   /api/jog                       {"interface":"can2","on_timeout":"hold","timeout_ms":1000,"preempt":false} 打开会话
+// GET    /api/jog/{id}                  会话状态
+// POST   /api/jog/{id}/heartbeat        心跳
+// POST   /api/jog/{id}/move             手臂 {"joint_id":61,"delta":0.05} 或 {"joint_id":61,"angle":0.3}；手部 {"hand":{...}}
+// DELETE /api/jog/{id}                  结束会话
+func (ws *WebServer) jogHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jog"), "/")
+	var response ControlResponse
+	status := http.StatusOK
+
+	if path == "" {
+		switch r.Method {
+		case "GET":
+			ws.jogMu.Lock()
+			list := make([]JogStatus, 0, len(ws.jogs))
+			for _, s := range ws.jogs {
+				list = append(list, s.Status())
+			}
+			ws.jogMu.Unlock()
+			sort.Slice(list, func(i, j int) bool { return list[i].Opened.Before(list[j].Opened) })
+			response.Success = true
+			response.Message = "获取点动会话成功"
+			response.Data = list
+		case "POST":
+			var req JogRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "解析请求失败", http.StatusBadRequest)
+				return
+			}
+			s, err := ws.openJog(req)
+			if err != nil {
+				ws.writeRefused(w, err)
+				return
+			}
+			response.Success = true
+			response.Message = fmt.Sprintf("点动会话 %s 已打开", s.ID)
+			response.Data = s.Status()
+		default:
+			http.Error(w, "只支持GET和POST方法", http.StatusMethodNotAllowed)
+			return
+		}
+		response.EStop = ws.estop.Status()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	ws.jogMu.Lock()
+	s := ws.jogs[parts[0]]
+	ws.jogMu.Unlock()
+	if s == nil {
+		http.Error(w, "未找到点动会话: "+parts[0], http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		response.Success = true
+		response.Message = "获取点动会话成功"
+
+	case len(parts) == 1 && r.Method == "DELETE":
+		ws.endJog(s, "客户端结束")
+		response.Success = true
+		response.Message = fmt.Sprintf("点动会话 %s 已结束", s.ID)
+
+	case len(parts) == 2 && r.Method == "POST" && parts[1] == "heartbeat":
+		if err := ws.beat(s); err != nil {
+			response.Message = err.Error()
+			status = http.StatusGone
+			break
+		}
+		response.Success = true
+		response.Message = "ok"
+
+	case len(parts) == 2 && r.Method == "POST" && parts[1] == "move":
+		var req JogRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "解析请求失败", http.StatusBadRequest)
+			return
+		}
+		if err := ws.jogMove(s, req); err != nil {
+			if _, latched := err.(*EStopError); latched {
+				ws.writeRefused(w, err)
+				return
+			}
+			response.Message = err.Error()
+			if !s.Status().Active {
+				status = http.StatusGone
+			}
+			break
+		}
+		response.Success = true
+		response.Message = "点动成功"
+
+	default:
+		http.Error(w, "路径格式应为 /api/jog/{id}[/heartbeat|move]", http.StatusBadRequest)
+		return
+	}
+	response.Data = s.Status()
+	response.EStop = ws.estop.Status()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
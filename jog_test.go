@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJogPolicy(t *testing.T) {
+	config := JogConfig{OnTimeout: jogDisable, HandOnTimeout: jogSafePose}
+	tests := []struct {
+		device  string
+		policy  string
+		config  JogConfig
+		want    string
+		wantErr bool
+	}{
+		{"arm", "", JogConfig{}, jogHold, false},
+		{"hand", "", JogConfig{}, jogHold, false},
+		{"arm", "", config, jogDisable, false},
+		{"hand", "", config, jogSafePose, false},
+		{"arm", jogHold, config, jogHold, false},
+		{"arm", jogSafePose, JogConfig{}, "", true},
+		{"hand", jogDisable, JogConfig{}, "", true},
+		{"arm", "stop", JogConfig{}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := jogPolicy(tt.device, tt.policy, tt.config)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("jogPolicy(%s, %q, %+v) = %q, %v; want %q, wantErr %v", tt.device, tt.policy, tt.config, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestJogMoveMissingController(t *testing.T) {
+	ws := &WebServer{
+		controllers: map[string]*BlackArmController{},
+		estop:       &EStopLatch{},
+		leases:      NewLeaseManager(nil),
+	}
+	s := &JogSession{ID: "jog-1", Interface: "can9", Device: "arm", Timeout: time.Second, timer: time.NewTimer(time.Hour)}
+	defer s.timer.Stop()
+	if err := ws.leases.Acquire([]string{s.Interface}, s.lease()); err != nil {
+		t.Fatal(err)
+	}
+
+	angle := float32(0.1)
+	if err := ws.jogMove(s, JogRequest{JointID: 61, Angle: &angle}); err == nil {
+		t.Fatal("接口没有控制器时 jogMove 应返回错误")
+	}
+}
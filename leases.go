@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 占用者类型
+const (
+	leaseJob = "job" // 序列任务
+	leaseJog = "jog" // 操作员点动会话
+)
+
+// preemptWait 抢占运行中的任务时等待其在安全点停止的时间
+const preemptWait = 10 * time.Second
+
+// Lease 手臂或手部接口的运动占用。占用期间其他来源的运动指令被拒绝，除非显式抢占或急停
+type Lease struct {
+	Kind  string    `json:"kind"` // job / jog
+	ID    string    `json:"id"`
+	Since time.Time `json:"since"`
+}
+
+// String 占用者的可读说明，如 "job job-3"
+func (l Lease) String() string {
+	return l.Kind + " " + l.ID
+}
+
+// BusyError 接口被其他占用者持有
+type BusyError struct {
+	Interface string
+	Device    string // arm / hand
+	Owner     Lease
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("%s busy: owned by %s (%s)", e.Device, e.Owner, e.Interface)
+}
+
+// LeaseManager 按接口记录运动占用
+type LeaseManager struct {
+	mu     sync.Mutex
+	leases map[string]Lease // 接口 -> 占用者
+	hands  map[string]bool  // 手部接口，用于错误信息
+}
+
+// NewLeaseManager 创建占用表，handInterfaces 为手部接口
+func NewLeaseManager(handInterfaces []string) *LeaseManager {
+	m := &LeaseManager{leases: make(map[string]Lease), hands: make(map[string]bool)}
+	for _, iface := range handInterfaces {
+		m.hands[iface] = true
+	}
+	return m
+}
+
+// busyLocked 接口被 owner 以外的占用者持有时返回错误，调用方持有 m.mu
+func (m *LeaseManager) busyLocked(iface string, owner Lease) error {
+	held, ok := m.leases[iface]
+	if !ok || (held.Kind == owner.Kind && held.ID == owner.ID) {
+		return nil
+	}
+	device := "arm"
+	if m.hands[iface] {
+		device = "hand"
+	}
+	return &BusyError{Interface: iface, Device: device, Owner: held}
+}
+
+// Acquire 为 owner 占用全部接口，任一接口被其他占用者持有时都不占用并返回 BusyError
+func (m *LeaseManager) Acquire(interfaces []string, owner Lease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, iface := range interfaces {
+		if err := m.busyLocked(iface, owner); err != nil {
+			return err
+		}
+	}
+	if owner.Since.IsZero() {
+		owner.Since = time.Now()
+	}
+	for _, iface := range interfaces {
+		m.leases[iface] = owner
+	}
+	return nil
+}
+
+// Release 释放 owner 持有的全部接口
+func (m *LeaseManager) Release(owner Lease) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for iface, held := range m.leases {
+		if held.Kind == owner.Kind && held.ID == owner.ID {
+			delete(m.leases, iface)
+		}
+	}
+}
+
+// Check 接口是否可由 owner 使用；owner 为零值表示不属于任何占用者的单条指令
+func (m *LeaseManager) Check(iface string, owner Lease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.busyLocked(iface, owner)
+}
+
+// Owner 接口当前的占用者
+func (m *LeaseManager) Owner(iface string) (Lease, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.leases[iface]
+	return l, ok
+}
+
+// ownerOf 接口占用者，未占用时为 nil，用于状态输出
+func (m *LeaseManager) ownerOf(iface string) *Lease {
+	if l, ok := m.Owner(iface); ok {
+		return &l
+	}
+	return nil
+}
+
+// ReleaseAll 释放所有占用（急停）
+func (m *LeaseManager) ReleaseAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leases = make(map[string]Lease)
+}
+
+// claimMotion 单条运动指令使用接口前检查急停锁定、手臂姿态和占用
+func (ws *WebServer) claimMotion(interfaces []string, preempt bool, session string) error {
+	if err := ws.estop.Check(); err != nil {
+		return err
+	}
+	if err := ws.checkArmPosture(interfaces); err != nil {
+		return err
+	}
+	return ws.claimLease(interfaces, preempt, session)
+}
+
+// claimLease 检查接口占用，session 为发出指令的点动会话（占用者本身的指令不冲突）。
+// preempt 为真时取消占用这些接口的任务（含排队中的）并等待运行中的任务在安全点停止，或结束占用的点动会话
+func (ws *WebServer) claimLease(interfaces []string, preempt bool, session string) error {
+	self := Lease{}
+	if session != "" {
+		self = Lease{Kind: leaseJog, ID: session}
+	}
+	for _, iface := range interfaces {
+		err := ws.leases.Check(iface, self)
+		if err == nil {
+			continue
+		}
+		if !preempt {
+			return err
+		}
+		owner := err.(*BusyError).Owner
+		log.Printf("⚠️ 抢占 %s: 原占用者 %s", iface, owner)
+		if owner.Kind == leaseJog {
+			ws.endJogByID(owner.ID, "被抢占")
+		}
+	}
+	if !preempt {
+		return nil
+	}
+	for _, job := range ws.jobs.CancelOn(interfaces) {
+		if !job.Wait(preemptWait) {
+			return fmt.Errorf("抢占失败: 任务 %s 在 %v 内未停止", job.ID, preemptWait)
+		}
+	}
+	return nil
+}
+
+// writeRefused 拒绝指令：急停锁定返回 503 和急停状态，占用冲突返回 409
+func (ws *WebServer) writeRefused(w http.ResponseWriter, err error) {
+	response := ControlResponse{Success: false, Message: err.Error()}
+	status := http.StatusConflict
+	var latched *EStopError
+	if errors.As(err, &latched) {
+		status = http.StatusServiceUnavailable
+		response.EStop = ws.estop.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
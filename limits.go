@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JointLimit 单个关节的软限位，未配置的项不检查
+type JointLimit struct {
+	Min      *float32 `yaml:"min"`       // 角度下限 rad
+	Max      *float32 `yaml:"max"`       // 角度上限 rad
+	MaxSpeed float32  `yaml:"max_speed"` // PP模式速度上限 rad/s，0为不限
+	MaxStep  float32  `yaml:"max_step"`  // 相对上一次指令角度的最大变化 rad，0为不限
+}
+
+// 超限处理方式（arms.{iface}.limit_policy）
+const (
+	limitReject = "reject" // 默认：拒绝整条指令
+	limitClamp  = "clamp"  // 截断到限位并记录警告
+)
+
+// limitFor 电机的软限位
+func (b *BlackArmController) limitFor(motorID int) (JointLimit, bool) {
+	l, ok := b.Limits[motorID]
+	return l, ok
+}
+
+// limitAngle 按软限位检查角度，clamp 策略下返回截断后的角度
+func (b *BlackArmController) limitAngle(motorID int, angle float32) (float32, error) {
+	if math.IsNaN(float64(angle)) || math.IsInf(float64(angle), 0) {
+		return 0, fmt.Errorf("关节 %d 角度无效: %v", motorID, angle)
+	}
+	l, ok := b.limitFor(motorID)
+	if !ok {
+		return angle, nil
+	}
+
+	if l.Min != nil && angle < *l.Min {
+		if err := b.limitHit(motorID, "角度 %.3f 低于下限 %.3f", angle, *l.Min); err != nil {
+			return 0, err
+		}
+		angle = *l.Min
+	}
+	if l.Max != nil && angle > *l.Max {
+		if err := b.limitHit(motorID, "角度 %.3f 高于上限 %.3f", angle, *l.Max); err != nil {
+			return 0, err
+		}
+		angle = *l.Max
+	}
+	if l.MaxStep > 0 {
+		if err := b.seedTargets([]int{motorID}); err != nil {
+			return 0, fmt.Errorf("无法检查 max_step: %v", err)
+		}
+		if last, ok := b.lastTarget(motorID); ok {
+			delta := angle - last
+			if delta > l.MaxStep || delta < -l.MaxStep {
+				if err := b.limitHit(motorID, "单步变化 %.3f（%.3f → %.3f）超过 max_step %.3f", delta, last, angle, l.MaxStep); err != nil {
+					return 0, err
+				}
+				if delta > 0 {
+					angle = last + l.MaxStep
+				} else {
+					angle = last - l.MaxStep
+				}
+			}
+		}
+	}
+	return angle, nil
+}
+
+// limitSpeed 按软限位检查PP速度
+func (b *BlackArmController) limitSpeed(motorID int, speed float32) (float32, error) {
+	l, ok := b.limitFor(motorID)
+	if !ok || l.MaxSpeed <= 0 || speed <= l.MaxSpeed {
+		return speed, nil
+	}
+	if err := b.limitHit(motorID, "速度 %.3f 超过 max_speed %.3f", speed, l.MaxSpeed); err != nil {
+		return 0, err
+	}
+	return l.MaxSpeed, nil
+}
+
+// limitVelocity 按 max_speed 检查有符号的速度指令（速度模式 spd_ref、运控速度项），clamp 时保留方向
+func (b *BlackArmController) limitVelocity(motorID int, velocity float32) (float32, error) {
+	l, ok := b.limitFor(motorID)
+	if !ok || l.MaxSpeed <= 0 || (velocity <= l.MaxSpeed && velocity >= -l.MaxSpeed) {
+		return velocity, nil
+	}
+	if err := b.limitHit(motorID, "速度 %.3f 超过 max_speed %.3f", velocity, l.MaxSpeed); err != nil {
+		return 0, err
+	}
+	if velocity < 0 {
+		return -l.MaxSpeed, nil
+	}
+	return l.MaxSpeed, nil
+}
+
+// requireUnbounded 速度/电流模式不以位置为目标，会一直转过角度限位，配置了 min/max 的关节拒绝（与 limit_policy 无关）
+func (b *BlackArmController) requireUnbounded(motorID int, action string) error {
+	if l, ok := b.limitFor(motorID); ok && (l.Min != nil || l.Max != nil) {
+		return fmt.Errorf("%s 关节 %d 配置了角度软限位，不允许 %s", b.Interface, motorID, action)
+	}
+	return nil
+}
+
+// limitHit 触发软限位：reject 策略返回错误，clamp 策略只记录警告
+func (b *BlackArmController) limitHit(motorID int, format string, args ...interface{}) error {
+	msg := fmt.Sprintf("%s 关节 %d 软限位: ", b.Interface, motorID) + fmt.Sprintf(format, args...)
+	if b.LimitPolicy == limitClamp {
+		log.Printf("%s，已截断", msg)
+		return nil
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// lastTarget 关节的指令角度基准：最近一次成功下发的指令角度，尚未下发过时为 seedTargets 读到的实测位置
+func (b *BlackArmController) lastTarget(motorID int) (float32, bool) {
+	b.targetMu.Lock()
+	defer b.targetMu.Unlock()
+	angle, ok := b.targets[motorID]
+	return angle, ok
+}
+
+// seedTargets 为还没有指令角度基准的关节读取实测位置(mech_pos)作为基准（启动后、命令行模式、点动之后的第一条指令），
+// 使第一条指令同样受 max_step 限制、插值从实际位置开始。读不到时返回错误；
+// 干运行没有位置反馈，不读取（这些关节没有基准，指令不经过总线）
+func (b *BlackArmController) seedTargets(motorIDs []int) error {
+	var reads []paramRead
+	for _, motorID := range motorIDs {
+		if _, ok := b.lastTarget(motorID); !ok {
+			reads = append(reads, paramRead{Motor: motorID, Index: idxMechPos})
+		}
+	}
+	if len(reads) == 0 || isCapture(b.Transport) {
+		return nil
+	}
+	if err := b.readParams(reads); err != nil {
+		return fmt.Errorf("读取实测位置失败: %v", err)
+	}
+	measured := make(map[int]float32, len(reads))
+	var failed []string
+	for _, r := range reads {
+		if r.Err != nil {
+			failed = append(failed, strconv.Itoa(r.Motor))
+			continue
+		}
+		measured[r.Motor] = r.Value
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s 关节 %s 没有上一次指令角度，也读不到实测位置", b.Interface, strings.Join(failed, ","))
+	}
+	b.recordTargets(measured)
+	return nil
+}
+
+// recordTargets 记录成功下发的指令角度，作为下一次 max_step 检查的基准
+func (b *BlackArmController) recordTargets(targets map[int]float32) {
+	b.targetMu.Lock()
+	defer b.targetMu.Unlock()
+	for motorID, angle := range targets {
+		b.targets[motorID] = angle
+	}
+}
+
+// armLimits 配置中的软限位，忽略不属于该手臂的电机
+func armLimits(arm ArmConfig, motorIDs []int) map[int]JointLimit {
+	limits := make(map[int]JointLimit, len(arm.Limits))
+	for motorID, l := range arm.Limits {
+		found := false
+		for _, id := range motorIDs {
+			if id == motorID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fmt.Printf("警告: 手臂 '%s' 的 limits 中电机 %d 不在 motor_ids 中，忽略\n", arm.DeviceName, motorID)
+			continue
+		}
+		if l.Min != nil && l.Max != nil && *l.Min > *l.Max {
+			fmt.Printf("警告: 手臂 '%s' 电机 %d 的 min %.3f 大于 max %.3f，忽略\n", arm.DeviceName, motorID, *l.Min, *l.Max)
+			continue
+		}
+		limits[motorID] = l
+	}
+	return limits
+}
+
+// sequenceLimitViolations 检查序列中超出软限位的角度，以及直接下发（step）的相邻角度组间超过 max_step 的变化
+func sequenceLimitViolations(seq JointSequence, limits map[int]JointLimit, traj TrajectoryConfig) []string {
+	var violations []string
+	prev := map[int]float32{}
+	for i, set := range seq.Angles {
+		stepped := stepProfile(set, &seq, traj) == profileStep
+		targets := angleSetTargets(set)
+		ids := make([]int, 0, len(targets))
+		for motorID := range targets {
+			ids = append(ids, motorID)
+		}
+		sort.Ints(ids)
+
+		for _, motorID := range ids {
+			angle := targets[motorID]
+			l, ok := limits[motorID]
+			if !ok {
+				continue
+			}
+			where := fmt.Sprintf("第 %d 组(%s) 关节 %d", i+1, set.Name, motorID)
+			if l.Min != nil && angle < *l.Min {
+				violations = append(violations, fmt.Sprintf("%s 角度 %.3f 低于下限 %.3f", where, angle, *l.Min))
+			}
+			if l.Max != nil && angle > *l.Max {
+				violations = append(violations, fmt.Sprintf("%s 角度 %.3f 高于上限 %.3f", where, angle, *l.Max))
+			}
+			if last, ok := prev[motorID]; ok && stepped && l.MaxStep > 0 {
+				if delta := angle - last; delta > l.MaxStep || delta < -l.MaxStep {
+					violations = append(violations, fmt.Sprintf("%s 单步变化 %.3f 超过 max_step %.3f", where, delta, l.MaxStep))
+				}
+			}
+			prev[motorID] = angle
+		}
+		for motorIDStr, speed := range set.Speed {
+			motorID, err := strconv.Atoi(motorIDStr)
+			if err != nil {
+				continue
+			}
+			if l, ok := limits[motorID]; ok && l.MaxSpeed > 0 && speed > l.MaxSpeed {
+				violations = append(violations, fmt.Sprintf("第 %d 组(%s) 关节 %d 速度 %.3f 超过 max_speed %.3f", i+1, set.Name, motorID, speed, l.MaxSpeed))
+			}
+		}
+	}
+	return violations
+}
+
+// flagSequenceLimits 按配置中对应手臂的软限位检查序列，结果记在 seq.LimitViolations 并输出警告
+func flagSequenceLimits(config *Config, seq *JointSequence) {
+	seq.LimitViolations = nil
+	for _, arm := range config.Arms {
+		if armSide(arm) != seq.ArmType {
+			continue
+		}
+		seq.LimitViolations = append(seq.LimitViolations, sequenceLimitViolations(*seq, arm.Limits, config.Trajectory)...)
+	}
+	for _, v := range seq.LimitViolations {
+		log.Printf("⚠️ 序列 %s 超出软限位: %s", seq.Name, v)
+	}
+}
+
+// limitSummary 软限位的可读说明，用于 /api/arms
+func limitSummary(limits map[int]JointLimit) map[string]map[string]float32 {
+	out := make(map[string]map[string]float32, len(limits))
+	for motorID, l := range limits {
+		m := make(map[string]float32)
+		if l.Min != nil {
+			m["min"] = *l.Min
+		}
+		if l.Max != nil {
+			m["max"] = *l.Max
+		}
+		if l.MaxSpeed > 0 {
+			m["max_speed"] = l.MaxSpeed
+		}
+		if l.MaxStep > 0 {
+			m["max_step"] = l.MaxStep
+		}
+		out[strconv.Itoa(motorID)] = m
+	}
+	return out
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// limitTestController 电机61有 [-1, 0.5] 的角度限位、max_speed 2、max_step 0.3，电机62没有限位，
+// 电机63只有 max_speed 2
+func limitTestController(policy string) *BlackArmController {
+	min, max := float32(-1), float32(0.5)
+	return NewBlackArmController(NewCaptureTransport(), "can2", ArmConfig{
+		ArmType:     "left",
+		MotorIDs:    []int{61, 62, 63},
+		LimitPolicy: policy,
+		Limits: map[int]JointLimit{
+			61: {Min: &min, Max: &max, MaxSpeed: 2, MaxStep: 0.3},
+			63: {MaxSpeed: 2},
+		},
+	})
+}
+
+func TestLimitAngle(t *testing.T) {
+	nan := float32(math.NaN())
+	tests := []struct {
+		name    string
+		policy  string
+		motor   int
+		last    *float32 // 上一次指令角度，nil 表示没有
+		angle   float32
+		want    float32
+		wantErr bool
+	}{
+		{"限位内", limitReject, 61, nil, 0.2, 0.2, false},
+		{"低于下限拒绝", limitReject, 61, nil, -1.5, 0, true},
+		{"高于上限拒绝", limitReject, 61, nil, 0.6, 0, true},
+		{"低于下限截断", limitClamp, 61, nil, -1.5, -1, false},
+		{"高于上限截断", limitClamp, 61, nil, 0.6, 0.5, false},
+		{"单步超限拒绝", limitReject, 61, f32(0), 0.4, 0, true},
+		{"单步超限截断（正向）", limitClamp, 61, f32(0), 0.4, 0.3, false},
+		{"单步超限截断（反向）", limitClamp, 61, f32(0), -0.9, -0.3, false},
+		{"先截断到上限再检查单步", limitClamp, 61, f32(0), 2, 0.3, false},
+		{"单步不超限", limitReject, 61, f32(0.1), 0.35, 0.35, false},
+		{"没有限位的关节不检查", limitReject, 62, nil, 3, 3, false},
+		{"NaN 总是拒绝", limitClamp, 62, nil, nan, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := limitTestController(tt.policy)
+			if tt.last != nil {
+				b.recordTargets(map[int]float32{tt.motor: *tt.last})
+			}
+			got, err := b.limitAngle(tt.motor, tt.angle)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("limitAngle(%d, %v) error = %v, wantErr %v", tt.motor, tt.angle, err, tt.wantErr)
+			}
+			if !tt.wantErr && math.Abs(float64(got-tt.want)) > 1e-6 {
+				t.Errorf("limitAngle(%d, %v) = %v, want %v", tt.motor, tt.angle, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitSpeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		motor   int
+		speed   float32
+		want    float32
+		wantErr bool
+	}{
+		{"不超过 max_speed", limitReject, 61, 1.5, 1.5, false},
+		{"等于 max_speed", limitReject, 61, 2, 2, false},
+		{"超过 max_speed 拒绝", limitReject, 61, 3, 0, true},
+		{"超过 max_speed 截断", limitClamp, 61, 3, 2, false},
+		{"没有限位的关节不检查", limitReject, 62, 10, 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := limitTestController(tt.policy).limitSpeed(tt.motor, tt.speed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("limitSpeed(%d, %v) error = %v, wantErr %v", tt.motor, tt.speed, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("limitSpeed(%d, %v) = %v, want %v", tt.motor, tt.speed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitVelocity(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		motor    int
+		velocity float32
+		want     float32
+		wantErr  bool
+	}{
+		{"正向不超过", limitReject, 63, 1.5, 1.5, false},
+		{"反向不超过", limitReject, 63, -2, -2, false},
+		{"正向超过拒绝", limitReject, 63, 3, 0, true},
+		{"反向超过拒绝", limitReject, 63, -3, 0, true},
+		{"正向超过截断", limitClamp, 63, 3, 2, false},
+		{"反向截断保留方向", limitClamp, 63, -3, -2, false},
+		{"没有限位的关节不检查", limitReject, 62, -10, -10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := limitTestController(tt.policy).limitVelocity(tt.motor, tt.velocity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("limitVelocity(%d, %v) error = %v, wantErr %v", tt.motor, tt.velocity, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("limitVelocity(%d, %v) = %v, want %v", tt.motor, tt.velocity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnboundedModesOnLimitedJoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		motor   int
+		mode    int
+		wantErr bool
+	}{
+		{"有角度限位不能切到速度模式", 61, RunModeVelocity, true},
+		{"有角度限位不能切到电流模式", 61, RunModeCurrent, true},
+		{"有角度限位可以切到CSP", 61, RunModeCSP, false},
+		{"只有 max_speed 可以切到速度模式", 63, RunModeVelocity, false},
+		{"没有限位可以切到电流模式", 62, RunModeCurrent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := limitTestController(limitClamp)
+			err := b.SetRunMode(tt.motor, tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetRunMode(%d, %s) error = %v, wantErr %v", tt.motor, runModeNames[tt.mode], err, tt.wantErr)
+			}
+			if tt.wantErr && b.runMode(tt.motor) != RunModePP {
+				t.Errorf("拒绝后模式 = %s, want pp", runModeNames[b.runMode(tt.motor)])
+			}
+		})
+	}
+}
+
+func TestSetVelocityLimited(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		velocity float32
+		want     float32
+		wantErr  bool
+	}{
+		{"不超过", limitReject, -1.5, -1.5, false},
+		{"超过拒绝", limitReject, 2.5, 0, true},
+		{"超过截断", limitClamp, -2.5, -2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := limitTestController(tt.policy)
+			if err := b.SetRunMode(63, RunModeVelocity); err != nil {
+				t.Fatal(err)
+			}
+			p, err := resolveParam("spd_ref")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := b.SetParam(63, p, float64(tt.velocity))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetParam(spd_ref=%v) error = %v, wantErr %v", tt.velocity, err, tt.wantErr)
+			}
+			if !tt.wantErr && float32(got) != tt.want {
+				t.Errorf("SetParam(spd_ref=%v) = %v, want %v", tt.velocity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetMITLimited(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		cmd     MITCommand
+		wantVel float32
+		wantErr bool
+	}{
+		{"速度项不超过", limitReject, MITCommand{Position: 0.1, Velocity: 1, Kp: 10, Kd: 1}, 1, false},
+		{"速度项超过拒绝", limitReject, MITCommand{Position: 0.1, Velocity: 3, Kp: 10, Kd: 1}, 0, true},
+		{"速度项超过截断", limitClamp, MITCommand{Position: 0.1, Velocity: -3, Kp: 10, Kd: 1}, -2, false},
+		{"kp=0 带速度拒绝", limitClamp, MITCommand{Velocity: 1, Kd: 1}, 0, true},
+		{"kp=0 带力矩拒绝", limitClamp, MITCommand{Kd: 1, Torque: 1}, 0, true},
+		{"kp=0 只有阻尼", limitReject, MITCommand{Kd: 1}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := limitTestController(tt.policy)
+			if err := b.SetRunMode(61, RunModeMIT); err != nil {
+				t.Fatal(err)
+			}
+			capture := b.Transport.(*CaptureTransport)
+			before := len(capture.Frames())
+			err := b.SetMIT(61, tt.cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetMIT(%+v) error = %v, wantErr %v", tt.cmd, err, tt.wantErr)
+			}
+			frames := capture.Frames()[before:]
+			if tt.wantErr {
+				if len(frames) != 0 {
+					t.Errorf("拒绝后仍下发了 %d 帧", len(frames))
+				}
+				return
+			}
+			if len(frames) != 1 {
+				t.Fatalf("下发 %d 帧，want 1", len(frames))
+			}
+			data, err := hex.DecodeString(frames[0].Data)
+			if err != nil || len(data) != 8 {
+				t.Fatalf("帧数据 %q 无效: %v", frames[0].Data, err)
+			}
+			if got, want := uint16(data[2])<<8|uint16(data[3]), encodeRange(float64(tt.wantVel), feedbackVelRange); got != want {
+				t.Errorf("速度项编码 = %d, want %d（%v rad/s）", got, want, tt.wantVel)
+			}
+		})
+	}
+}
+
+// positionTransport 模拟电机：读取 mech_pos 时按 pos 响应（pos 中没有的电机不响应），其余帧记录在 sent
+type positionTransport struct {
+	replyTestTransport
+	pos map[uint8]float32
+
+	mu   sync.Mutex
+	sent []CANMessage
+}
+
+func newPositionTransport(pos map[uint8]float32) *positionTransport {
+	return &positionTransport{replyTestTransport: replyTestTransport{subs: newSubscriberSet()}, pos: pos}
+}
+
+func (t *positionTransport) Send(msg CANMessage) error {
+	if (msg.ID>>24)&0x1F == typeReadSingle {
+		motor, index := uint8(msg.ID), binary.LittleEndian.Uint16(msg.Data[0:2])
+		if v, ok := t.pos[motor]; ok && index == idxMechPos {
+			resp := readResp(motor, index, math.Float32bits(v), time.Now())
+			resp.Interface = msg.Interface
+			t.subs.dispatch(resp)
+		}
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sent = append(t.sent, msg)
+	return nil
+}
+
+// locRefs 已下发的 loc_ref 角度
+func (t *positionTransport) locRefs() []float32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []float32
+	for _, msg := range t.sent {
+		if binary.LittleEndian.Uint16(msg.Data[0:2]) == idxLocRef {
+			out = append(out, math.Float32frombits(binary.LittleEndian.Uint32(msg.Data[4:8])))
+		}
+	}
+	return out
+}
+
+func TestMaxStepSeededFromMeasured(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		pos     map[uint8]float32 // 实测位置，nil 表示电机不响应
+		angle   float32
+		want    float32
+		wantErr bool
+	}{
+		{"第一条指令不超过 max_step", limitReject, map[uint8]float32{61: 0.1}, 0.35, 0.35, false},
+		{"第一条指令超过 max_step 拒绝", limitReject, map[uint8]float32{61: 0.1}, 0.5, 0, true},
+		{"第一条指令超过 max_step 截断", limitClamp, map[uint8]float32{61: -0.5}, 0.5, -0.2, false},
+		{"读不到实测位置拒绝", limitClamp, nil, 0.1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			min, max := float32(-1), float32(0.5)
+			transport := newPositionTransport(tt.pos)
+			b := NewBlackArmController(transport, "can0", ArmConfig{
+				ArmType:     "left",
+				MotorIDs:    []int{61},
+				LimitPolicy: tt.policy,
+				Limits:      map[int]JointLimit{61: {Min: &min, Max: &max, MaxStep: 0.3}},
+			})
+			defer b.Replies.Close()
+
+			_, err := b.SetAngleGroup(map[int]float32{61: tt.angle})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetAngleGroup(%v) error = %v, wantErr %v", tt.angle, err, tt.wantErr)
+			}
+			sent := transport.locRefs()
+			if tt.wantErr {
+				if len(sent) != 0 {
+					t.Errorf("拒绝后仍下发了 %v", sent)
+				}
+				return
+			}
+			if len(sent) != 1 || math.Abs(float64(sent[0]-tt.want)) > 1e-6 {
+				t.Errorf("下发 %v, want [%v]", sent, tt.want)
+			}
+		})
+	}
+}
+
+func f32(v float32) *float32 { return &v }
@@ -1,24 +1,36 @@
 package main
 
 import (
-	"bytes"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
-	"io"
 	"math"
-	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // BlackArmController Black Arm控制器结构体
 type BlackArmController struct {
-	BaseURL   string // CAN桥接服务器URL
-	Interface string // CAN接口名称
-	MotorIDs  []int  // 电机ID列表
-	Client    *http.Client
+	Transport  CANTransport // CAN传输（HTTP桥接或SocketCAN）
+	Interface  string       // CAN接口名称
+	MotorIDs   []int        // 电机ID列表
+	Side       string       // "left"、"right" 或 "unknown"
+	JointNames []string     // 与 MotorIDs 一一对应的关节名称
+	InitPose   []float32    // 合并上举序列时插入的初始角度，与 MotorIDs 一一对应
+	Replies    *ReplyDispatcher
+
+	Limits      map[int]JointLimit // 电机ID -> 软限位
+	LimitPolicy string             // 超限处理: reject（默认）或 clamp
+
+	targetMu sync.Mutex
+	targets  map[int]float32 // 电机ID -> 指令角度基准（见 lastTarget）
+
+	modeMu sync.Mutex
+	modes  map[int]int // 电机ID -> 运行模式，使能时写入 run_mode
+
+	Latch *EStopLatch // 急停锁定，锁定时只放行停止帧和读取帧；命令行模式为 nil
 }
 
 // CANMessage CAN消息结构体
@@ -27,6 +39,8 @@ type CANMessage struct {
 	ID        uint32 `json:"id"`
 	Data      []byte `json:"data"`
 	Extended  bool   `json:"extended"`
+
+	Timestamp time.Time `json:"-"` // 接收时间（本机时钟），发送时不使用
 }
 
 // CANResponse CAN响应结构体
@@ -38,51 +52,108 @@ type CANResponse struct {
 }
 
 // NewBlackArmController 创建新的Black Arm控制器
-func NewBlackArmController(baseURL, interface_, deviceName string) *BlackArmController {
+func NewBlackArmController(transport CANTransport, interface_ string, arm ArmConfig) *BlackArmController {
 	controller := &BlackArmController{
-		BaseURL:   baseURL,
+		Transport: transport,
 		Interface: interface_,
-		Client:    &http.Client{Timeout: 50 * time.Second},
+		Replies:   NewReplyDispatcher(transport, interface_),
+		modes:     make(map[int]int),
+		targets:   make(map[int]float32),
 	}
 
-	// 根据设备名称确定电机ID范围
-	var motorIDs []int
-	if strings.Contains(deviceName, "left") {
-		// 左臂电机ID范围: 61-67
-		motorIDs = []int{61, 62, 63, 64, 65, 66, 67}
-	} else if strings.Contains(deviceName, "right") {
-		// 右臂电机ID范围: 51-57
-		motorIDs = []int{51, 52, 53, 54, 55, 56, 57}
-	} else {
-		// 默认使用右臂电机ID
-		motorIDs = []int{51, 52, 53, 54, 55, 56, 57}
-		fmt.Printf("警告: 无法从设备名称 '%s' 判断左右臂，使用默认右臂电机ID\n", deviceName)
+	controller.Side = armSide(arm)
+	controller.MotorIDs = armMotorIDs(arm)
+	controller.JointNames = armJointNames(arm, len(controller.MotorIDs))
+	controller.InitPose = armInitPose(arm, controller.Side, len(controller.MotorIDs))
+	controller.Limits = armLimits(arm, controller.MotorIDs)
+	controller.LimitPolicy = limitReject
+	if arm.LimitPolicy == limitClamp {
+		controller.LimitPolicy = limitClamp
 	}
-
-	controller.MotorIDs = motorIDs
-	fmt.Printf("手臂 %s (%s) 的电机ID列表: %v\n", interface_, deviceName, motorIDs)
+	fmt.Printf("手臂 %s (%s, %s臂) 的电机ID列表: %v 关节: %v\n",
+		interface_, arm.DeviceName, controller.Side, controller.MotorIDs, controller.JointNames)
 
 	return controller
 }
 
-// sendCommand 发送CAN命令
-func (b *BlackArmController) sendCommand(command CANMessage) error {
-	jsonData, err := json.Marshal(command)
-	if err != nil {
-		return fmt.Errorf("序列化命令失败: %v", err)
+// legacyMotorIDs 未配置 motor_ids 时沿用的出厂ID
+var legacyMotorIDs = map[string][]int{
+	"left":  {61, 62, 63, 64, 65, 66, 67},
+	"right": {51, 52, 53, 54, 55, 56, 57},
+}
+
+// armSide 手臂左右：优先使用配置的 arm_type，其次由 motor_ids 推断，最后看设备名称
+func armSide(arm ArmConfig) string {
+	if arm.ArmType == "left" || arm.ArmType == "right" {
+		return arm.ArmType
 	}
+	if len(arm.MotorIDs) > 0 {
+		if side := inferArmSide(arm.MotorIDs); side != "unknown" {
+			return side
+		}
+	}
+	if strings.Contains(arm.DeviceName, "left") {
+		return "left"
+	}
+	if strings.Contains(arm.DeviceName, "right") {
+		return "right"
+	}
+	return "unknown"
+}
 
-	resp, err := b.Client.Post(b.BaseURL+"/api/can", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("发送HTTP请求失败: %v", err)
+// armMotorIDs 手臂的电机ID：优先使用配置中的 motor_ids（可由 /api/scan 写回），未配置时按左右臂使用出厂ID
+func armMotorIDs(arm ArmConfig) []int {
+	if len(arm.MotorIDs) > 0 {
+		return append([]int(nil), arm.MotorIDs...)
+	}
+	if ids, ok := legacyMotorIDs[armSide(arm)]; ok {
+		return append([]int(nil), ids...)
 	}
-	defer resp.Body.Close()
+	// 默认使用右臂电机ID
+	fmt.Printf("警告: 无法判断手臂 '%s' 的左右，且未配置 motor_ids，使用默认右臂电机ID\n", arm.DeviceName)
+	return append([]int(nil), legacyMotorIDs["right"]...)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP请求失败，状态码: %d", resp.StatusCode)
+// armJointNames 关节名称，未配置或数量不符时使用 "关节N"
+func armJointNames(arm ArmConfig, dof int) []string {
+	if len(arm.JointNames) == dof {
+		return append([]string(nil), arm.JointNames...)
+	}
+	if len(arm.JointNames) > 0 {
+		fmt.Printf("警告: 手臂 '%s' 的 joint_names 数量 %d 与电机数量 %d 不符，忽略\n", arm.DeviceName, len(arm.JointNames), dof)
+	}
+	names := make([]string, dof)
+	for i := range names {
+		names[i] = fmt.Sprintf("关节%d", i+1)
 	}
+	return names
+}
 
-	return nil
+// armInitPose 上举序列的初始角度，未配置时第二个关节左臂 0.1、右臂 -0.1，其余为0
+func armInitPose(arm ArmConfig, side string, dof int) []float32 {
+	if len(arm.InitPose) == dof {
+		return append([]float32(nil), arm.InitPose...)
+	}
+	pose := make([]float32, dof)
+	if dof > 1 {
+		switch side {
+		case "left":
+			pose[1] = 0.1
+		case "right":
+			pose[1] = -0.1
+		}
+	}
+	return pose
+}
+
+// sendCommand 发送CAN命令
+func (b *BlackArmController) sendCommand(command CANMessage) error {
+	if motionFrame(command) {
+		if err := b.Latch.Check(); err != nil {
+			return err
+		}
+	}
+	return b.Transport.Send(command)
 }
 
 // EnableMotor 启用电机
@@ -107,13 +178,9 @@ func (b *BlackArmController) EnableMotor(motorID string) error {
 
 // enableSingleMotor 启用单个电机
 func (b *BlackArmController) enableSingleMotor(motorID int) error {
-	// 设置电机模式为PP (Position Profile)
-	setModeCommand := CANMessage{
-		Interface: b.Interface,
-		ID:        0x1200FD00 + uint32(motorID),
-		Data:      []byte{0x05, 0x70, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}, // PP模式
-		Extended:  true,
-	}
+	// 设置电机运行模式（默认PP，可由 SetRunMode 切换）
+	runMode, _ := lookupParam(idxRunMode)
+	setModeCommand := b.buildParamFrame(motorID, runMode, float64(b.runMode(motorID)))
 
 	// 启用电机命令
 	enableCommand := CANMessage{
@@ -225,52 +292,111 @@ func (b *BlackArmController) SetAngle(jointID int, angle float32) error {
 	if !b.isValidJoint(jointID) {
 		return fmt.Errorf("无效的关节ID: %d", jointID)
 	}
-	// 将float32转换为字节数组 (小端序)
-	angleBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(angleBytes, math.Float32bits(angle))
-
-	data := []byte{0x16, 0x70, 0x00, 0x00}
-	data = append(data, angleBytes...)
-
-	command := CANMessage{
-		Interface: b.Interface,
-		ID:        0x1200FD00 + uint32(jointID),
-		Data:      data,
-		Extended:  true,
+	if err := b.requireMode(jointID, "set_angle", RunModePP, RunModeCSP); err != nil {
+		return err
+	}
+	angle, err := b.limitAngle(jointID, angle)
+	if err != nil {
+		return err
 	}
 
-	if err := b.sendCommand(command); err != nil {
+	if err := b.WriteParam(jointID, idxLocRef, float64(angle)); err != nil {
 		return fmt.Errorf("设置关节 %d 角度失败: %v", jointID, err)
 	}
+	b.recordTargets(map[int]float32{jointID: angle})
 
 	fmt.Printf("关节 %d 角度设置为 %.2f\n", jointID, angle)
 	return nil
 }
 
-// SetAngles 设置所有关节角度
-func (b *BlackArmController) SetAngles(angles []float32) error {
+// buildAngleFrame 构建写 loc_ref(0x7016) 的角度帧
+func (b *BlackArmController) buildAngleFrame(jointID int, angle float32) CANMessage {
+	locRef, _ := lookupParam(idxLocRef)
+	return b.buildParamFrame(jointID, locRef, float64(angle))
+}
+
+// SetAngles 设置所有关节角度，整组一次下发
+func (b *BlackArmController) SetAngles(angles []float32) (BatchResult, error) {
 	if len(angles) != len(b.MotorIDs) {
-		return fmt.Errorf("角度数量 %d 与电机数量 %d 不匹配", len(angles), len(b.MotorIDs))
+		return BatchResult{}, fmt.Errorf("角度数量 %d 与电机数量 %d 不匹配", len(angles), len(b.MotorIDs))
 	}
 	fmt.Println("设置所有关节角度", angles)
-	// 并发设置所有关节角度
-	errChan := make(chan error, len(b.MotorIDs))
 
+	targets := make(map[int]float32, len(angles))
 	for i, motorID := range b.MotorIDs {
-		go func(id int, angle float32) {
-			errChan <- b.SetAngle(id, angle)
-		}(motorID, angles[i])
+		targets[motorID] = angles[i]
+	}
+	res, err := b.SetAngleGroup(targets)
+	if err != nil {
+		return res, err
 	}
 
-	// 等待所有goroutine完成
-	for i := 0; i < len(b.MotorIDs); i++ {
-		if err := <-errChan; err != nil {
-			return err
+	fmt.Println("所有关节角度设置成功")
+	return res, nil
+}
+
+// SetAngleGroup 一次传输调用下发一组关节角度（按电机ID顺序），返回首末帧的发送时间差。
+// 任一关节超出软限位时整组不下发；clamp 策略下 targets 中的角度改为截断后的值
+func (b *BlackArmController) SetAngleGroup(targets map[int]float32) (BatchResult, error) {
+	res, err := b.sendAngleGroup(targets)
+	if err != nil {
+		return res, err
+	}
+	fmt.Printf("%s 下发 %d 个关节角度，首末帧间隔 %v (批量=%v)\n", b.Interface, res.Count, res.Skew, res.Batched)
+	return res, nil
+}
+
+// sendAngleGroup 同 SetAngleGroup，但不输出日志，用于插值时高频下发中间点
+func (b *BlackArmController) sendAngleGroup(targets map[int]float32) (BatchResult, error) {
+	motorIDs := make([]int, 0, len(targets))
+	for motorID := range targets {
+		if !b.isValidJoint(motorID) {
+			return BatchResult{}, fmt.Errorf("无效的关节ID: %d", motorID)
+		}
+		if err := b.requireMode(motorID, "set_angle", RunModePP, RunModeCSP); err != nil {
+			return BatchResult{}, err
 		}
+		motorIDs = append(motorIDs, motorID)
 	}
+	sort.Ints(motorIDs)
 
-	fmt.Println("所有关节角度设置成功")
-	return nil
+	// 一次读取所有需要 max_step 基准的关节，避免 limitAngle 逐个读取
+	var stepLimited []int
+	for _, motorID := range motorIDs {
+		if l, ok := b.limitFor(motorID); ok && l.MaxStep > 0 {
+			stepLimited = append(stepLimited, motorID)
+		}
+	}
+	if err := b.seedTargets(stepLimited); err != nil {
+		return BatchResult{}, fmt.Errorf("无法检查 max_step: %v", err)
+	}
+
+	limited := make(map[int]float32, len(motorIDs))
+	for _, motorID := range motorIDs {
+		angle, err := b.limitAngle(motorID, targets[motorID])
+		if err != nil {
+			return BatchResult{}, err
+		}
+		limited[motorID] = angle
+	}
+	for motorID, angle := range limited {
+		targets[motorID] = angle
+	}
+
+	frames := make([]CANMessage, len(motorIDs))
+	for i, motorID := range motorIDs {
+		frames[i] = b.buildAngleFrame(motorID, targets[motorID])
+	}
+
+	if err := b.Latch.Check(); err != nil {
+		return BatchResult{}, err
+	}
+	res, err := sendBatch(b.Transport, frames)
+	if err != nil {
+		return res, fmt.Errorf("下发关节角度组失败: %v", err)
+	}
+	b.recordTargets(targets)
+	return res, nil
 }
 
 // 设置所有关节速度
@@ -288,27 +414,16 @@ func (b *BlackArmController) SetSpeeds(speeds []float32) error {
 	return nil
 }
 
-// SetSpeed 设置单个关节速度
+// SetSpeed 设置单个关节速度（PP模式速度 0x7024）
 func (b *BlackArmController) SetSpeed(jointID int, speed float32) error {
 	if !b.isValidJoint(jointID) {
 		return fmt.Errorf("无效的关节ID: %d", jointID)
 	}
-
-	// 将float32转换为字节数组 (小端序)
-	speedBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(speedBytes, math.Float32bits(speed))
-
-	data := []byte{0x24, 0x70, 0x00, 0x00}
-	data = append(data, speedBytes...)
-
-	command := CANMessage{
-		Interface: b.Interface,
-		ID:        0x1200FD00 + uint32(jointID),
-		Data:      data,
-		Extended:  true,
+	speed, err := b.limitSpeed(jointID, speed)
+	if err != nil {
+		return err
 	}
-
-	if err := b.sendCommand(command); err != nil {
+	if err := b.WriteParam(jointID, idxSpeedLimitPP, float64(speed)); err != nil {
 		return fmt.Errorf("设置关节 %d 速度失败: %v", jointID, err)
 	}
 
@@ -318,90 +433,22 @@ func (b *BlackArmController) SetSpeed(jointID int, speed float32) error {
 
 // SetMotorLocKp 设置电机位置Kp参数
 func (b *BlackArmController) SetMotorLocKp(motorID int, kp float32) error {
-	if !b.isValidJoint(motorID) {
-		return fmt.Errorf("无效的电机ID: %d", motorID)
-	}
-
-	kpBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(kpBytes, math.Float32bits(kp))
-
-	data := []byte{0x1E, 0x70, 0x00, 0x00}
-	data = append(data, kpBytes...)
-
-	command := CANMessage{
-		Interface: b.Interface,
-		ID:        0x1200FD00 + uint32(motorID),
-		Data:      data,
-		Extended:  true,
-	}
-
-	return b.sendCommand(command)
+	return b.WriteParam(motorID, idxLocKp, float64(kp))
 }
 
 // SetMotorSpeedKp 设置电机速度Kp参数
 func (b *BlackArmController) SetMotorSpeedKp(motorID int, kp float32) error {
-	if !b.isValidJoint(motorID) {
-		return fmt.Errorf("无效的电机ID: %d", motorID)
-	}
-
-	kpBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(kpBytes, math.Float32bits(kp))
-
-	data := []byte{0x1F, 0x70, 0x00, 0x00}
-	data = append(data, kpBytes...)
-
-	command := CANMessage{
-		Interface: b.Interface,
-		ID:        0x1200FD00 + uint32(motorID),
-		Data:      data,
-		Extended:  true,
-	}
-
-	return b.sendCommand(command)
+	return b.WriteParam(motorID, idxSpdKp, float64(kp))
 }
 
 // SetMotorSpeedKi 设置电机速度Ki参数
 func (b *BlackArmController) SetMotorSpeedKi(motorID int, ki float32) error {
-	if !b.isValidJoint(motorID) {
-		return fmt.Errorf("无效的电机ID: %d", motorID)
-	}
-
-	kiBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(kiBytes, math.Float32bits(ki))
-
-	data := []byte{0x20, 0x70, 0x00, 0x00}
-	data = append(data, kiBytes...)
-
-	command := CANMessage{
-		Interface: b.Interface,
-		ID:        0x1200FD00 + uint32(motorID),
-		Data:      data,
-		Extended:  true,
-	}
-
-	return b.sendCommand(command)
+	return b.WriteParam(motorID, idxSpdKi, float64(ki))
 }
 
 // SetMotorSpeedFiltGain 设置电机速度滤波增益
 func (b *BlackArmController) SetMotorSpeedFiltGain(motorID int, gain float32) error {
-	if !b.isValidJoint(motorID) {
-		return fmt.Errorf("无效的电机ID: %d", motorID)
-	}
-
-	gainBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(gainBytes, math.Float32bits(gain))
-
-	data := []byte{0x21, 0x70, 0x00, 0x00}
-	data = append(data, gainBytes...)
-
-	command := CANMessage{
-		Interface: b.Interface,
-		ID:        0x1200FD00 + uint32(motorID),
-		Data:      data,
-		Extended:  true,
-	}
-
-	return b.sendCommand(command)
+	return b.WriteParam(motorID, idxSpdFiltGain, float64(gain))
 }
 
 // ReturnZero 回到零位
@@ -412,7 +459,8 @@ func (b *BlackArmController) ReturnZero() error {
 		zeroAngles[i] = 0.0
 	}
 
-	return b.SetAngles(zeroAngles)
+	_, err := b.SetAngles(zeroAngles)
+	return err
 }
 
 // isValidJoint 检查关节ID是否有效
@@ -433,50 +481,143 @@ func (b *BlackArmController) GetMotorIDs() []int {
 // ----------------------------------查询相关----------------------------------
 // 查询相关常量
 const (
-	typeReadSingle = 0x11
-	defaultHostID  = 0xFD
+	typeMotorFeedback = 0x02
+	typeMotorEnable   = 0x03
+	typeMotorStop     = 0x04
+	typeSetZero       = 0x06
+	typeReadSingle    = 0x11
+	typeWriteSingle   = 0x12
+	defaultHostID     = 0xFD
+
+	idxRunMode      = 0x7005
+	idxIqRef        = 0x7006
+	idxSpdRef       = 0x700A
+	idxLocRef       = 0x7016
+	idxLimitSpd     = 0x7017
+	idxMechPos      = 0x7019
+	idxLocKp        = 0x701E
+	idxSpdKp        = 0x701F
+	idxSpdKi        = 0x7020
+	idxSpdFiltGain  = 0x7021
+	idxSpeedLimitPP = 0x7024
+)
 
-	idxLocRef = 0x7016
-	idxLocKp  = 0x701E
-	idxSpdKp  = 0x701F
-	idxSpdKi  = 0x7020
+// 反馈帧（类型0x02）中位置/速度/力矩的量程，按16位无符号数线性映射
+const (
+	feedbackPosRange    = 4 * math.Pi // ±4π rad
+	feedbackVelRange    = 44.0        // ±44 rad/s
+	feedbackTorqueRange = 17.0        // ±17 Nm
 )
 
-// QueryCurrentAngles 查询当前角度值
-func QueryCurrentAngles(canBridgeURL, interfaceName string, motorIDs []int) (map[int]float64, map[string]float64, error) {
-	client := &http.Client{Timeout: 50 * time.Second}
+// readParamTimeout 单个读取请求等待响应的时限（直连总线），轮询桥接上见 replyTimeout
+const readParamTimeout = 100 * time.Millisecond
 
-	// 发送读取请求
-	indices := []uint16{idxLocRef, idxLocKp, idxSpdKp, idxSpdKi}
-	for _, m := range motorIDs {
-		if err := sendReadForMotor(client, canBridgeURL, interfaceName, m, indices); err != nil {
-			return nil, nil, fmt.Errorf("发送读取请求失败: %v", err)
-		}
+// paramRead 一个读取请求及其结果
+type paramRead struct {
+	Motor int
+	Index uint16
+	Value float32
+	Err   error
+}
+
+// ReadParam 读取单个电机参数（按参数表解码），只接受请求发出之后该电机对该索引的响应
+func (b *BlackArmController) ReadParam(motorID int, index uint16) (float32, error) {
+	reads := []paramRead{{Motor: motorID, Index: index}}
+	if err := b.readParams(reads); err != nil {
+		return 0, err
 	}
+	return reads[0].Value, reads[0].Err
+}
 
-	// 监听反馈
-	angles := make(map[int]float64)
-	params := make(map[string]float64)
+// readParams 一次发出一组读取请求并并发等待，各请求独立计时，结果写回 reads
+func (b *BlackArmController) readParams(reads []paramRead) error {
+	for _, r := range reads {
+		if !b.isValidJoint(r.Motor) {
+			return fmt.Errorf("无效的关节ID: %d", r.Motor)
+		}
+	}
 
-	// 先查询第一个电机的参数值（所有电机参数值相同）
-	if len(motorIDs) > 0 {
-		locKp, spdKp, spdKi := listenMotorParams(client, canBridgeURL, interfaceName, motorIDs[0], 500*time.Millisecond)
-		if locKp != nil {
-			params["loc_kp"] = *locKp
+	// 先登记等待再发送读取请求，避免错过响应帧
+	replies := make([]*PendingReply, len(reads))
+	frames := make([]CANMessage, len(reads))
+	cancel := func() {
+		for _, p := range replies {
+			if p != nil {
+				p.Cancel()
+			}
 		}
-		if spdKp != nil {
-			params["spd_kp"] = *spdKp
+	}
+	for i, r := range reads {
+		p, err := b.Replies.Expect(r.Motor, r.Index)
+		if err != nil {
+			cancel()
+			return err
 		}
-		if spdKi != nil {
-			params["spd_ki"] = *spdKi
+		replies[i] = p
+		frames[i] = CANMessage{
+			Interface: b.Interface,
+			ID:        buildReadReqID(defaultHostID, uint8(r.Motor)),
+			Data:      buildReadReqData(r.Index),
+			Extended:  true,
 		}
 	}
 
-	// 查询所有电机的角度值
-	for _, m := range motorIDs {
-		ok, angle := listenOneMotorRound(client, canBridgeURL, interfaceName, m, 2000*time.Millisecond)
-		if ok {
-			angles[m] = angle
+	for _, p := range replies {
+		p.Sending()
+	}
+	if _, err := sendBatch(b.Transport, frames); err != nil {
+		cancel()
+		return fmt.Errorf("发送读取请求失败: %v", err)
+	}
+
+	timeout := replyTimeout(b.Transport)
+	var wg sync.WaitGroup
+	for i := range reads {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u, err := replies[i].Wait(timeout)
+			reads[i].Value = float32(decodeParamValue(reads[i].Index, u))
+			reads[i].Err = err
+		}(i)
+	}
+	wg.Wait()
+	return nil
+}
+
+// QueryCurrentAngles 查询各电机当前角度（loc_ref）以及第一个电机的位置环/速度环参数（所有电机参数相同）
+func (b *BlackArmController) QueryCurrentAngles() (map[int]float64, map[string]float64, error) {
+	var reads []paramRead
+	for i, m := range b.MotorIDs {
+		reads = append(reads, paramRead{Motor: m, Index: idxLocRef})
+		if i == 0 {
+			reads = append(reads,
+				paramRead{Motor: m, Index: idxLocKp},
+				paramRead{Motor: m, Index: idxSpdKp},
+				paramRead{Motor: m, Index: idxSpdKi})
+		}
+	}
+	if err := b.readParams(reads); err != nil {
+		return nil, nil, err
+	}
+
+	angles := make(map[int]float64)
+	params := make(map[string]float64)
+	for _, r := range reads {
+		if r.Err != nil {
+			fmt.Printf("查询: %v\n", r.Err)
+			continue
+		}
+		v := float64(r.Value)
+		switch r.Index {
+		case idxLocRef:
+			angles[r.Motor] = v
+		case idxLocKp:
+			params["loc_kp"] = v
+		case idxSpdKp:
+			params["spd_kp"] = v
+		case idxSpdKi:
+			params["spd_ki"] = v
 		}
 	}
 
@@ -501,42 +642,15 @@ func buildReadReqData(index uint16) []byte {
 	return d
 }
 
-// sendReadForMotor 发送单个电机的读取请求
-func sendReadForMotor(client *http.Client, canBridgeURL, iface string, motorID int, indices []uint16) error {
-	for _, idx := range indices {
-		id := buildReadReqID(defaultHostID, uint8(motorID))
-		data := buildReadReqData(idx)
-		cmd := CANMessage{
-			Interface: iface,
-			ID:        id,
-			Data:      data,
-			Extended:  true,
-		}
-
-		jsonData, err := json.Marshal(cmd)
-		if err != nil {
-			return fmt.Errorf("序列化命令失败: %v", err)
-		}
-
-		url := strings.TrimRight(canBridgeURL, "/") + "/api/can"
-		resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
-		if err != nil {
-			return fmt.Errorf("发送HTTP请求失败: %v", err)
-		}
-		resp.Body.Close()
-
-		time.Sleep(5 * time.Millisecond)
-	}
-	return nil
-}
-
 // listenResponse 监听响应结构
 type listenResponse struct {
 	Status string `json:"status"`
 	Data   struct {
 		Messages []struct {
-			HexData []string `json:"hex_data"`
+			HexData   []string `json:"hex_data"`
+			Timestamp float64  `json:"timestamp"`
 		} `json:"messages"`
+		Total uint64 `json:"total"` // 桥接累计收到的该ID帧数（可选）
 	} `json:"data"`
 }
 
@@ -546,138 +660,12 @@ func parseHexByte(s string) byte {
 	return byte(v)
 }
 
-// listenOneMotorRound 监听单个电机一轮（仅loc_ref）
-func listenOneMotorRound(client *http.Client, canBridgeURL, iface string, motorID int, maxDuration time.Duration) (bool, float64) {
-	if maxDuration <= 0 {
-		maxDuration = 2000 * time.Millisecond
-	}
-	respID := buildReadRespID(defaultHostID, uint8(motorID))
-	listenBase := strings.TrimRight(canBridgeURL, "/") + "/api/messages"
-	url := fmt.Sprintf("%s/%s?id=%d", listenBase, iface, respID)
-
-	type streamState struct {
-		seen     map[uint32]bool
-		prevBits uint32
-		prevVal  float32
-		havePrev bool
-		repeats  int
-		captured bool
-	}
-	state := streamState{seen: make(map[uint32]bool)}
-
-	deadline := time.Now().Add(maxDuration)
-	for time.Now().Before(deadline) {
-		resp, err := client.Get(url)
-		if err != nil {
-			time.Sleep(60 * time.Millisecond)
-			continue
-		}
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		var lr listenResponse
-		if err := json.Unmarshal(body, &lr); err != nil || len(lr.Data.Messages) == 0 {
-			time.Sleep(80 * time.Millisecond)
-			continue
-		}
-
-		for _, m := range lr.Data.Messages {
-			if len(m.HexData) < 8 {
-				continue
-			}
-			idx := uint16(parseHexByte(m.HexData[0])) |
-				uint16(parseHexByte(m.HexData[1]))<<8
-
-			b4 := parseHexByte(m.HexData[4])
-			b5 := parseHexByte(m.HexData[5])
-			b6 := parseHexByte(m.HexData[6])
-			b7 := parseHexByte(m.HexData[7])
-			u := uint32(b4) | uint32(b5)<<8 | uint32(b6)<<16 | uint32(b7)<<24
-			val32 := math.Float32frombits(u)
-
-			// 仅对 loc_ref 应用重复判定逻辑
-			if idx == idxLocRef {
-				if state.seen[u] {
-					state.repeats++
-					if !state.captured && state.havePrev {
-						return true, float64(state.prevVal)
-					}
-					if state.repeats >= 2 {
-						return true, float64(state.prevVal)
-					}
-				} else {
-					state.seen[u] = true
-					state.prevBits = u
-					state.prevVal = val32
-					state.havePrev = true
-				}
-			}
-		}
-		time.Sleep(80 * time.Millisecond)
-	}
-	return false, 0
-}
-
-// listenMotorParams 监听电机参数值（loc_kp, spd_kp, spd_ki）
-func listenMotorParams(client *http.Client, canBridgeURL, iface string, motorID int, maxDuration time.Duration) (*float64, *float64, *float64) {
-	respID := buildReadRespID(defaultHostID, uint8(motorID))
-	listenBase := strings.TrimRight(canBridgeURL, "/") + "/api/messages"
-	url := fmt.Sprintf("%s/%s?id=%d", listenBase, iface, respID)
-
-	var locKp, spdKp, spdKi *float64
-	seen := make(map[uint16]bool)
-
-	deadline := time.Now().Add(maxDuration)
-	for time.Now().Before(deadline) {
-		resp, err := client.Get(url)
-		if err != nil {
-			time.Sleep(60 * time.Millisecond)
-			continue
-		}
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		var lr listenResponse
-		if err := json.Unmarshal(body, &lr); err != nil || len(lr.Data.Messages) == 0 {
-			time.Sleep(80 * time.Millisecond)
-			continue
-		}
-
-		for _, m := range lr.Data.Messages {
-			if len(m.HexData) < 8 {
-				continue
-			}
-			idx := uint16(parseHexByte(m.HexData[0])) |
-				uint16(parseHexByte(m.HexData[1]))<<8
-
-			b4 := parseHexByte(m.HexData[4])
-			b5 := parseHexByte(m.HexData[5])
-			b6 := parseHexByte(m.HexData[6])
-			b7 := parseHexByte(m.HexData[7])
-			u := uint32(b4) | uint32(b5)<<8 | uint32(b6)<<16 | uint32(b7)<<24
-			val32 := math.Float32frombits(u)
-
-			if idx == idxLocKp && !seen[idxLocKp] {
-				v := float64(val32)
-				locKp = &v
-				seen[idxLocKp] = true
-			}
-			if idx == idxSpdKp && !seen[idxSpdKp] {
-				v := float64(val32)
-				spdKp = &v
-				seen[idxSpdKp] = true
-			}
-			if idx == idxSpdKi && !seen[idxSpdKi] {
-				v := float64(val32)
-				spdKi = &v
-				seen[idxSpdKi] = true
-			}
-
-			if locKp != nil && spdKp != nil && spdKi != nil {
-				return locKp, spdKp, spdKi
-			}
-		}
-		time.Sleep(80 * time.Millisecond)
+// decodeReadResp 解析读取响应帧，返回参数索引和值
+func decodeReadResp(data []byte) (uint16, uint32, bool) {
+	if len(data) < 8 {
+		return 0, 0, false
 	}
-	return locKp, spdKp, spdKi
+	idx := uint16(data[0]) | uint16(data[1])<<8
+	u := binary.LittleEndian.Uint32(data[4:8])
+	return idx, u, true
 }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 运行模式（参数 0x7005 run_mode）
+const (
+	RunModeMIT      = 0 // 运控模式：一帧同时给定位置、速度、Kp、Kd和前馈力矩
+	RunModePP       = 1 // 位置模式(PP)：loc_ref + vel_max 梯形规划
+	RunModeVelocity = 2 // 速度模式：spd_ref，limit_cur 限流
+	RunModeCurrent  = 3 // 电流模式：iq_ref
+	RunModeCSP      = 5 // 位置模式(CSP)：loc_ref，limit_spd 限速
+)
+
+// typeMITControl 运控模式控制帧类型，ID: 0x01<<24 | 前馈力矩(uint16)<<8 | 电机ID
+const typeMITControl = 0x01
+
+// 运控模式各量的量程
+const (
+	mitKpMax = 500.0
+	mitKdMax = 5.0
+)
+
+// runModeNames 模式名称，用于接口参数和错误信息
+var runModeNames = map[int]string{
+	RunModeMIT:      "mit",
+	RunModePP:       "pp",
+	RunModeVelocity: "velocity",
+	RunModeCurrent:  "current",
+	RunModeCSP:      "csp",
+}
+
+// parseRunMode 解析模式名称
+func parseRunMode(name string) (int, error) {
+	for mode, n := range runModeNames {
+		if n == strings.ToLower(name) {
+			return mode, nil
+		}
+	}
+	names := make([]string, 0, len(runModeNames))
+	for _, n := range runModeNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return 0, fmt.Errorf("未知运行模式: %s（可选 %s）", name, strings.Join(names, "/"))
+}
+
+// runMode 电机当前（由本控制器设置的）运行模式，未设置过时为PP
+func (b *BlackArmController) runMode(motorID int) int {
+	b.modeMu.Lock()
+	defer b.modeMu.Unlock()
+	if mode, ok := b.modes[motorID]; ok {
+		return mode
+	}
+	return RunModePP
+}
+
+// requireMode 检查电机处于允许的模式之一
+func (b *BlackArmController) requireMode(motorID int, action string, allowed ...int) error {
+	mode := b.runMode(motorID)
+	for _, m := range allowed {
+		if m == mode {
+			return nil
+		}
+	}
+	names := make([]string, len(allowed))
+	for i, m := range allowed {
+		names[i] = runModeNames[m]
+	}
+	return fmt.Errorf("电机 %d 处于 %s 模式，%s 需要 %s 模式", motorID, runModeNames[mode], action, strings.Join(names, "/"))
+}
+
+// SetRunMode 切换电机运行模式：先停止电机，写 run_mode，再重新使能
+func (b *BlackArmController) SetRunMode(motorID int, mode int) error {
+	if !b.isValidJoint(motorID) {
+		return fmt.Errorf("无效的电机ID: %d", motorID)
+	}
+	if _, ok := runModeNames[mode]; !ok {
+		return fmt.Errorf("不支持的运行模式: %d", mode)
+	}
+	if mode == RunModeVelocity || mode == RunModeCurrent {
+		if err := b.requireUnbounded(motorID, runModeNames[mode]+" 模式"); err != nil {
+			return err
+		}
+	}
+
+	stop := CANMessage{
+		Interface: b.Interface,
+		ID:        (uint32(typeMotorStop) << 24) | (uint32(defaultHostID) << 8) | uint32(motorID),
+		Data:      make([]byte, 8),
+		Extended:  true,
+	}
+	if err := b.sendCommand(stop); err != nil {
+		return fmt.Errorf("停止电机 %d 失败: %v", motorID, err)
+	}
+
+	b.modeMu.Lock()
+	b.modes[motorID] = mode
+	b.modeMu.Unlock()
+
+	if err := b.enableSingleMotor(motorID); err != nil {
+		return err
+	}
+	fmt.Printf("电机 %d 切换到 %s 模式\n", motorID, runModeNames[mode])
+	return nil
+}
+
+// SetRunModeAll 切换所有电机的运行模式
+func (b *BlackArmController) SetRunModeAll(mode int) error {
+	for _, motorID := range b.MotorIDs {
+		if err := b.SetRunMode(motorID, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MITCommand 运控模式的一帧指令
+type MITCommand struct {
+	Position float32 `json:"position"` // rad
+	Velocity float32 `json:"velocity"` // rad/s
+	Kp       float32 `json:"kp"`       // 0~500
+	Kd       float32 `json:"kd"`       // 0~5
+	Torque   float32 `json:"torque"`   // 前馈力矩 Nm
+}
+
+// validate 检查各量是否在量程内
+func (c MITCommand) validate() error {
+	checks := []struct {
+		name     string
+		v        float32
+		min, max float64
+	}{
+		{"position", c.Position, -feedbackPosRange, feedbackPosRange},
+		{"velocity", c.Velocity, -feedbackVelRange, feedbackVelRange},
+		{"kp", c.Kp, 0, mitKpMax},
+		{"kd", c.Kd, 0, mitKdMax},
+		{"torque", c.Torque, -feedbackTorqueRange, feedbackTorqueRange},
+	}
+	for _, ch := range checks {
+		if float64(ch.v) < ch.min || float64(ch.v) > ch.max || ch.v != ch.v {
+			return fmt.Errorf("运控参数 %s=%g 超出范围 [%g, %g]", ch.name, ch.v, ch.min, ch.max)
+		}
+	}
+	return nil
+}
+
+// SetMIT 运控模式下发一帧位置/速度/Kp/Kd/前馈力矩，低Kp即可得到柔顺的姿态
+func (b *BlackArmController) SetMIT(motorID int, cmd MITCommand) error {
+	if !b.isValidJoint(motorID) {
+		return fmt.Errorf("无效的电机ID: %d", motorID)
+	}
+	if err := b.requireMode(motorID, "set_mit", RunModeMIT); err != nil {
+		return err
+	}
+	if err := cmd.validate(); err != nil {
+		return err
+	}
+	position, err := b.limitAngle(motorID, cmd.Position)
+	if err != nil {
+		return err
+	}
+	cmd.Position = position
+	velocity, err := b.limitVelocity(motorID, cmd.Velocity)
+	if err != nil {
+		return err
+	}
+	cmd.Velocity = velocity
+	// Kp 为0时位置项不起作用，速度项和前馈力矩会一直转过角度限位
+	if cmd.Kp == 0 && (cmd.Velocity != 0 || cmd.Torque != 0) {
+		if err := b.requireUnbounded(motorID, "kp=0 的运控速度/力矩指令"); err != nil {
+			return err
+		}
+	}
+
+	torque := uint32(encodeRange(float64(cmd.Torque), feedbackTorqueRange))
+	data := make([]byte, 8)
+	putUint16BE(data[0:2], encodeRange(float64(cmd.Position), feedbackPosRange))
+	putUint16BE(data[2:4], encodeRange(float64(cmd.Velocity), feedbackVelRange))
+	putUint16BE(data[4:6], uint16(float64(cmd.Kp)/mitKpMax*65535))
+	putUint16BE(data[6:8], uint16(float64(cmd.Kd)/mitKdMax*65535))
+
+	if err := b.sendCommand(CANMessage{
+		Interface: b.Interface,
+		ID:        (uint32(typeMITControl) << 24) | torque<<8 | uint32(motorID),
+		Data:      data,
+		Extended:  true,
+	}); err != nil {
+		return err
+	}
+	b.recordTargets(map[int]float32{motorID: cmd.Position})
+	return nil
+}
+
+// putUint16BE 大端写入
+func putUint16BE(b []byte, v uint16) {
+	b[0] = byte(v >> 8)
+	b[1] = byte(v)
+}
+
+// SetVelocity 速度模式下设置目标速度（按 max_speed 检查），currentLimit>0 时同时设置电流限制
+func (b *BlackArmController) SetVelocity(motorID int, velocity, currentLimit float32) error {
+	if err := b.requireMode(motorID, "set_velocity", RunModeVelocity); err != nil {
+		return err
+	}
+	if err := b.requireUnbounded(motorID, "set_velocity"); err != nil {
+		return err
+	}
+	velocity, err := b.limitVelocity(motorID, velocity)
+	if err != nil {
+		return err
+	}
+	if currentLimit > 0 {
+		if err := b.WriteParam(motorID, 0x7018, float64(currentLimit)); err != nil {
+			return err
+		}
+	}
+	return b.WriteParam(motorID, idxSpdRef, float64(velocity))
+}
+
+// SetCurrent 电流模式下设置Iq指令
+func (b *BlackArmController) SetCurrent(motorID int, iq float32) error {
+	if err := b.requireMode(motorID, "set_current", RunModeCurrent); err != nil {
+		return err
+	}
+	if err := b.requireUnbounded(motorID, "set_current"); err != nil {
+		return err
+	}
+	return b.WriteParam(motorID, idxIqRef, float64(iq))
+}
+
+// SetCSP CSP模式下设置目标位置，speedLimit>0 时同时设置速度限制
+func (b *BlackArmController) SetCSP(motorID int, position, speedLimit float32) error {
+	if err := b.requireMode(motorID, "set_csp", RunModeCSP); err != nil {
+		return err
+	}
+	position, err := b.limitAngle(motorID, position)
+	if err != nil {
+		return err
+	}
+	if speedLimit > 0 {
+		if speedLimit, err = b.limitSpeed(motorID, speedLimit); err != nil {
+			return err
+		}
+		if err := b.WriteParam(motorID, idxLimitSpd, float64(speedLimit)); err != nil {
+			return err
+		}
+	}
+	if err := b.WriteParam(motorID, idxLocRef, float64(position)); err != nil {
+		return err
+	}
+	b.recordTargets(map[int]float32{motorID: position})
+	return nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 参数值类型
+const (
+	paramUint8   = "uint8"
+	paramFloat32 = "float"
+)
+
+// MotorParam 电机参数表中的一项
+type MotorParam struct {
+	Index    uint16  `json:"index"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Unit     string  `json:"unit"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Writable bool    `json:"writable"`
+	Desc     string  `json:"description"`
+}
+
+// motorParams 电机参数表（0x7005起的单参数读写区），新增参数只需在此登记
+var motorParams = []MotorParam{
+	{idxRunMode, "run_mode", paramUint8, "", 0, 5, true, "运行模式 0运控 1PP 2速度 3电流 5CSP"},
+	{idxIqRef, "iq_ref", paramFloat32, "A", -23, 23, true, "电流模式Iq指令"},
+	{idxSpdRef, "spd_ref", paramFloat32, "rad/s", -20, 20, true, "速度模式速度指令"},
+	{0x700B, "limit_torque", paramFloat32, "Nm", 0, 17, true, "转矩限制"},
+	{0x7010, "cur_kp", paramFloat32, "", 0, 200, true, "电流环Kp"},
+	{0x7011, "cur_ki", paramFloat32, "", 0, 200, true, "电流环Ki"},
+	{0x7014, "cur_filt_gain", paramFloat32, "", 0, 1, true, "电流滤波系数"},
+	{idxLocRef, "loc_ref", paramFloat32, "rad", -feedbackPosRange, feedbackPosRange, true, "位置指令"},
+	{idxLimitSpd, "limit_spd", paramFloat32, "rad/s", 0, 20, true, "CSP速度限制"},
+	{0x7018, "limit_cur", paramFloat32, "A", 0, 23, true, "速度/位置模式电流限制"},
+	{idxMechPos, "mech_pos", paramFloat32, "rad", -feedbackPosRange, feedbackPosRange, false, "负载端机械角度"},
+	{0x701A, "iqf", paramFloat32, "A", -23, 23, false, "Iq滤波值"},
+	{0x701B, "mech_vel", paramFloat32, "rad/s", -feedbackVelRange, feedbackVelRange, false, "负载端转速"},
+	{0x701C, "vbus", paramFloat32, "V", 0, 60, false, "母线电压"},
+	{idxLocKp, "loc_kp", paramFloat32, "", 0, 200, true, "位置环Kp"},
+	{idxSpdKp, "spd_kp", paramFloat32, "", 0, 200, true, "速度环Kp"},
+	{idxSpdKi, "spd_ki", paramFloat32, "", 0, 200, true, "速度环Ki"},
+	{idxSpdFiltGain, "spd_filt_gain", paramFloat32, "", 0, 1, true, "速度滤波系数"},
+	{0x7022, "acc_rad", paramFloat32, "rad/s^2", 0, 100, true, "速度模式加速度"},
+	{idxSpeedLimitPP, "vel_max", paramFloat32, "rad/s", 0, 20, true, "PP模式速度"},
+	{0x7025, "acc_set", paramFloat32, "rad/s^2", 0, 100, true, "PP模式加速度"},
+}
+
+// lookupParam 按索引查找参数
+func lookupParam(index uint16) (MotorParam, bool) {
+	for _, p := range motorParams {
+		if p.Index == index {
+			return p, true
+		}
+	}
+	return MotorParam{}, false
+}
+
+// resolveParam 按名称或十六进制索引（如 0x7018）查找参数
+func resolveParam(key string) (MotorParam, error) {
+	for _, p := range motorParams {
+		if p.Name == key {
+			return p, nil
+		}
+	}
+	if idx, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(key), "0x"), 16, 16); err == nil {
+		if p, ok := lookupParam(uint16(idx)); ok {
+			return p, nil
+		}
+	}
+	return MotorParam{}, fmt.Errorf("未知参数: %s", key)
+}
+
+// paramLabel 参数索引的显示文本
+func paramLabel(idx uint16) string {
+	if p, ok := lookupParam(idx); ok {
+		return fmt.Sprintf("0x%04X(%s)", idx, p.Name)
+	}
+	return fmt.Sprintf("0x%04X", idx)
+}
+
+// check 检查写入值是否合法
+func (p MotorParam) check(value float64) error {
+	if !p.Writable {
+		return fmt.Errorf("参数 %s 只读", p.Name)
+	}
+	if math.IsNaN(value) || value < p.Min || value > p.Max {
+		return fmt.Errorf("参数 %s 的值 %g 超出范围 [%g, %g]", p.Name, value, p.Min, p.Max)
+	}
+	if p.Type == paramUint8 && value != math.Trunc(value) {
+		return fmt.Errorf("参数 %s 必须为整数", p.Name)
+	}
+	return nil
+}
+
+// encode 编码写参数帧的数据：[索引低, 索引高, 0, 0, 值(小端)]
+func (p MotorParam) encode(value float64) []byte {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint16(data[0:2], p.Index)
+	if p.Type == paramUint8 {
+		data[4] = byte(value)
+	} else {
+		binary.LittleEndian.PutUint32(data[4:8], math.Float32bits(float32(value)))
+	}
+	return data
+}
+
+// decode 解码读取响应中的原始32位值
+func (p MotorParam) decode(raw uint32) float64 {
+	if p.Type == paramUint8 {
+		return float64(raw & 0xFF)
+	}
+	return float64(math.Float32frombits(raw))
+}
+
+// decodeParamValue 按参数表解码读取响应的值，未登记的索引按float处理
+func decodeParamValue(index uint16, raw uint32) float64 {
+	if p, ok := lookupParam(index); ok {
+		return p.decode(raw)
+	}
+	return float64(math.Float32frombits(raw))
+}
+
+// buildParamFrame 构建写参数帧（不做检查）
+func (b *BlackArmController) buildParamFrame(motorID int, p MotorParam, value float64) CANMessage {
+	return CANMessage{
+		Interface: b.Interface,
+		ID:        (uint32(typeWriteSingle) << 24) | (uint32(defaultHostID) << 8) | uint32(motorID),
+		Data:      p.encode(value),
+		Extended:  true,
+	}
+}
+
+// WriteParam 按参数表检查类型、范围和可写性后写入单个电机参数
+func (b *BlackArmController) WriteParam(motorID int, index uint16, value float64) error {
+	if !b.isValidJoint(motorID) {
+		return fmt.Errorf("无效的电机ID: %d", motorID)
+	}
+	p, ok := lookupParam(index)
+	if !ok {
+		return fmt.Errorf("未知参数: 0x%04X", index)
+	}
+	if err := p.check(value); err != nil {
+		return err
+	}
+	return b.sendCommand(b.buildParamFrame(motorID, p, value))
+}
+
+// SetParam 参数接口的写入：运动相关参数交给对应的控制方法，与专用接口一样经过软限位、
+// 运行模式检查和模式记录，其余参数直接写入。返回实际写入的值（clamp 策略下可能被截断）
+func (b *BlackArmController) SetParam(motorID int, p MotorParam, value float64) (float64, error) {
+	switch p.Index {
+	case idxRunMode:
+		return value, b.SetRunMode(motorID, int(value))
+	case idxLocRef:
+		if err := b.SetAngle(motorID, float32(value)); err != nil {
+			return 0, err
+		}
+		angle, _ := b.lastTarget(motorID)
+		return float64(angle), nil
+	case idxSpeedLimitPP, idxLimitSpd:
+		speed, err := b.limitSpeed(motorID, float32(value))
+		if err != nil {
+			return 0, err
+		}
+		return float64(speed), b.WriteParam(motorID, p.Index, float64(speed))
+	case idxSpdRef:
+		velocity, err := b.limitVelocity(motorID, float32(value))
+		if err != nil {
+			return 0, err
+		}
+		return float64(velocity), b.SetVelocity(motorID, velocity, 0)
+	case idxIqRef:
+		return value, b.SetCurrent(motorID, float32(value))
+	}
+	return value, b.WriteParam(motorID, p.Index, value)
+}
+
+// ParamValue 参数读取结果
+type ParamValue struct {
+	MotorParam
+	Value *float64 `json:"value"`
+	Error string   `json:"error,omitempty"`
+}
+
+// ReadAllParams 读取电机的全部参数
+func (b *BlackArmController) ReadAllParams(motorID int) ([]ParamValue, error) {
+	reads := make([]paramRead, len(motorParams))
+	for i, p := range motorParams {
+		reads[i] = paramRead{Motor: motorID, Index: p.Index}
+	}
+	if err := b.readParams(reads); err != nil {
+		return nil, err
+	}
+
+	values := make([]ParamValue, len(reads))
+	for i, r := range reads {
+		values[i].MotorParam = motorParams[i]
+		if r.Err != nil {
+			values[i].Error = r.Err.Error()
+			continue
+		}
+		v := float64(r.Value)
+		values[i].Value = &v
+	}
+	return values, nil
+}
+
+// paramsHandler 电机参数读写
+// GET  /api/params/                         参数表
+// GET  /api/params/{iface}/{motor}[?name=]  读取全部（或单个）参数
+// PUT  /api/params/{iface}/{motor}          {"limit_cur": 5, "0x7017": 2} 按名称或索引写入（运动参数见 SetParam），?preempt=true 抢占
+func (ws *WebServer) paramsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/params"), "/")
+	if path == "" {
+		json.NewEncoder(w).Encode(ControlResponse{Success: true, Message: "参数表", Data: motorParams})
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 {
+		http.Error(w, "路径格式应为 /api/params/{iface}/{motor}", http.StatusBadRequest)
+		return
+	}
+	motorID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		http.Error(w, "无效的电机ID", http.StatusBadRequest)
+		return
+	}
+
+	ws.mutex.RLock()
+	controller, exists := ws.controllers[parts[0]]
+	ws.mutex.RUnlock()
+	if !exists {
+		http.Error(w, "未找到指定的手臂接口", http.StatusNotFound)
+		return
+	}
+	if !controller.isValidJoint(motorID) {
+		http.Error(w, fmt.Sprintf("无效的电机ID: %d", motorID), http.StatusBadRequest)
+		return
+	}
+
+	var response ControlResponse
+	switch r.Method {
+	case "GET":
+		if name := r.URL.Query().Get("name"); name != "" {
+			p, err := resolveParam(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			v, err := controller.ReadParam(motorID, p.Index)
+			response.Success = err == nil
+			if err != nil {
+				response.Message = fmt.Sprintf("读取失败: %v", err)
+			} else {
+				value := float64(v)
+				response.Message = "读取成功"
+				response.Data = ParamValue{MotorParam: p, Value: &value}
+			}
+			break
+		}
+
+		values, err := controller.ReadAllParams(motorID)
+		response.Success = err == nil
+		if err != nil {
+			response.Message = fmt.Sprintf("读取失败: %v", err)
+		} else {
+			response.Message = "读取成功"
+			response.Data = values
+		}
+
+	case "PUT":
+		if err := ws.claimMotion([]string{parts[0]}, r.URL.Query().Get("preempt") == "true", r.URL.Query().Get("session")); err != nil {
+			ws.writeRefused(w, err)
+			return
+		}
+		var values map[string]float64
+		if err := json.NewDecoder(r.Body).Decode(&values); err != nil || len(values) == 0 {
+			http.Error(w, "请求体应为 {参数名或索引: 值}", http.StatusBadRequest)
+			return
+		}
+
+		// 先全部检查再写入，避免只写入一部分
+		keys := make([]string, 0, len(values))
+		params := make(map[string]MotorParam, len(values))
+		for key, value := range values {
+			p, err := resolveParam(key)
+			if err == nil {
+				err = p.check(value)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			keys = append(keys, key)
+			params[key] = p
+		}
+		sort.Strings(keys)
+
+		written := make(map[string]float64)
+		for _, key := range keys {
+			p := params[key]
+			v, err := controller.SetParam(motorID, p, values[key])
+			if err != nil {
+				response.Message = fmt.Sprintf("写入 %s 失败: %v", p.Name, err)
+				break
+			}
+			written[p.Name] = v
+		}
+		response.Success = len(written) == len(keys)
+		if response.Success {
+			response.Message = fmt.Sprintf("已写入 %d 个参数", len(written))
+		}
+		response.Data = written
+
+	default:
+		http.Error(w, "不支持的HTTP方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Posture 双臂姿态
+type Posture string
+
+const (
+	PostureStowed     Posture = "stowed"      // 收起，可执行UP序列
+	PostureRaising    Posture = "raising"     // UP序列执行中
+	PosturePlayingSKS Posture = "playing-sks" // 在萨克斯演奏位置
+	PosturePlayingSN  Posture = "playing-sn"  // 在唢呐演奏位置
+	PostureLowering   Posture = "lowering"    // DOWN序列执行中
+	PostureFault      Posture = "fault"       // 序列失败或中途退出，姿态未知，需要操作员确认
+)
+
+// defaultPostureFile 姿态状态文件，未配置 posture_file 时使用
+const defaultPostureFile = "posture_state.json"
+
+// PostureState 持久化的姿态状态
+type PostureState struct {
+	State    Posture   `json:"state"`
+	Since    time.Time `json:"since"`
+	Reason   string    `json:"reason"`             // 最近一次变化的原因
+	Override bool      `json:"override,omitempty"` // 最近一次由操作员设置
+}
+
+// PostureStore 姿态状态机：UP/DOWN序列执行前检查、执行中和结束后更新，每次变化写入文件
+type PostureStore struct {
+	mu    sync.Mutex
+	path  string
+	state PostureState
+}
+
+// parsePosture 检查姿态名称
+func parsePosture(s string) (Posture, error) {
+	switch p := Posture(strings.ToLower(s)); p {
+	case PostureStowed, PostureRaising, PosturePlayingSKS, PosturePlayingSN, PostureLowering, PostureFault:
+		return p, nil
+	}
+	return "", fmt.Errorf("未知姿态: %s（可选 stowed/raising/playing-sks/playing-sn/lowering/fault）", s)
+}
+
+// playingPosture 乐器对应的演奏姿态
+func playingPosture(isSks bool) Posture {
+	if isSks {
+		return PosturePlayingSKS
+	}
+	return PosturePlayingSN
+}
+
+// LoadPostureStore 读取姿态状态文件。文件不存在时为 stowed；文件无法读取时为 fault，
+// 且不覆盖该文件；上次运行停在 raising/lowering（序列中途退出）时改为 fault
+func LoadPostureStore(path string) *PostureStore {
+	if path == "" {
+		path = defaultPostureFile
+	}
+	p := &PostureStore{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("⚠️ 未找到姿态状态文件 %s，假定双臂为 stowed", path)
+		p.state = PostureState{State: PostureStowed, Since: time.Now(), Reason: "状态文件不存在，假定收起"}
+		p.save()
+		return p
+	}
+	if err != nil {
+		// 文件存在但读不出来：实际姿态未知，保留原文件等操作员处理
+		log.Printf("⚠️ 读取姿态状态文件 %s 失败: %v，置为 fault（不覆盖该文件）", path, err)
+		p.state = PostureState{State: PostureFault, Since: time.Now(), Reason: fmt.Sprintf("读取状态文件失败: %v", err)}
+		return p
+	}
+	err = json.Unmarshal(data, &p.state)
+	if err == nil {
+		_, err = parsePosture(string(p.state.State))
+	}
+	if err != nil {
+		log.Printf("⚠️ 姿态状态文件 %s 无效: %v，置为 fault", path, err)
+		p.setLocked(PostureFault, fmt.Sprintf("状态文件无效: %v", err), false)
+		return p
+	}
+	if p.state.State == PostureRaising || p.state.State == PostureLowering {
+		log.Printf("⚠️ 上次运行在 %s 中途退出，姿态置为 fault", p.state.State)
+		p.setLocked(PostureFault, fmt.Sprintf("启动时姿态为 %s，上次运行在序列中途退出", p.state.State), false)
+		return p
+	}
+	log.Printf("当前姿态: %s（%s）", p.state.State, p.state.Reason)
+	return p
+}
+
+// Get 当前姿态
+func (p *PostureStore) Get() PostureState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// setLocked 更新姿态并写入文件，调用方持有 p.mu
+func (p *PostureStore) setLocked(state Posture, reason string, override bool) {
+	log.Printf("姿态: %s → %s（%s）", p.state.State, state, reason)
+	p.state = PostureState{State: state, Since: time.Now(), Reason: reason, Override: override}
+	p.save()
+}
+
+// save 写入状态文件（先写临时文件再改名），失败只记录日志
+func (p *PostureStore) save() {
+	data, err := json.MarshalIndent(p.state, "", "  ")
+	if err != nil {
+		log.Printf("序列化姿态状态失败: %v", err)
+		return
+	}
+	tmp := p.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("保存姿态状态失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		log.Printf("保存姿态状态失败: %v", err)
+	}
+}
+
+// checkLocked UP序列需要 stowed，DOWN序列需要同一乐器的演奏姿态，调用方持有 p.mu
+func (p *PostureStore) checkLocked(isUp, isSks bool) error {
+	current := p.state.State
+	if isUp {
+		if current != PostureStowed {
+			return fmt.Errorf("当前姿态为 %s，UP序列需要 %s", current, PostureStowed)
+		}
+		return nil
+	}
+	want := playingPosture(isSks)
+	if current == want {
+		return nil
+	}
+	if current == playingPosture(!isSks) {
+		return fmt.Errorf("当前姿态为 %s，不能执行 %s 的DOWN序列", current, want)
+	}
+	return fmt.Errorf("当前姿态为 %s，DOWN序列需要 %s", current, want)
+}
+
+// Check 序列执行前的检查（不改变姿态）
+func (p *PostureStore) Check(isUp, isSks bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.checkLocked(isUp, isSks)
+}
+
+// CheckMotion UP/DOWN以外的手臂运动（单臂序列、关节和参数指令、点动）之前的检查：
+// 姿态为 fault 或停在序列中途时实际位置未知，拒绝运动，需操作员确认后通过 POST /api/posture 设置（nil 不检查）
+func (p *PostureStore) CheckMotion() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch current := p.state.State; current {
+	case PostureFault, PostureRaising, PostureLowering:
+		return fmt.Errorf("当前姿态为 %s，实际位置未知，确认后通过 POST /api/posture 设置姿态再运动手臂", current)
+	}
+	return nil
+}
+
+// checkArmPosture 按 CheckMotion 检查，只作用于手臂接口。手部指令不受姿态限制：
+// fault 时操作员可能需要张开手指让出乐器
+func (ws *WebServer) checkArmPosture(interfaces []string) error {
+	ws.mutex.RLock()
+	arm := false
+	for _, iface := range interfaces {
+		if _, ok := ws.controllers[iface]; ok {
+			arm = true
+		}
+	}
+	ws.mutex.RUnlock()
+	if !arm {
+		return nil
+	}
+	return ws.posture.CheckMotion()
+}
+
+// Begin 检查并进入 raising/lowering（nil 不检查）
+func (p *PostureStore) Begin(isUp, isSks bool) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.checkLocked(isUp, isSks); err != nil {
+		return err
+	}
+	if isUp {
+		p.setLocked(PostureRaising, "开始UP序列", false)
+	} else {
+		p.setLocked(PostureLowering, "开始DOWN序列", false)
+	}
+	return nil
+}
+
+// Finish 序列结束：成功时进入演奏姿态或 stowed，失败或取消时进入 fault
+func (p *PostureStore) Finish(isUp, isSks bool, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case err != nil && isUp:
+		p.setLocked(PostureFault, fmt.Sprintf("UP序列未完成: %v", err), false)
+	case err != nil:
+		p.setLocked(PostureFault, fmt.Sprintf("DOWN序列未完成: %v", err), false)
+	case isUp:
+		p.setLocked(playingPosture(isSks), "UP序列完成", false)
+	default:
+		p.setLocked(PostureStowed, "DOWN序列完成", false)
+	}
+}
+
+// Override 操作员直接设置姿态，必须给出原因
+func (p *PostureStore) Override(state, reason string) error {
+	posture, err := parsePosture(state)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("设置姿态必须填写原因")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setLocked(posture, "操作员设置: "+reason, true)
+	return nil
+}
+
+// postureHandler 姿态状态
+// GET  /api/posture     当前姿态
+// POST /api/posture     {"state":"stowed","reason":"..."} 操作员设置
+func (ws *WebServer) postureHandler(w http.ResponseWriter, r *http.Request) {
+	var response ControlResponse
+	switch r.Method {
+	case "GET":
+		response.Success = true
+		response.Message = "获取姿态成功"
+
+	case "POST":
+		var req struct {
+			State  string `json:"state"`
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "解析请求失败", http.StatusBadRequest)
+			return
+		}
+		if err := ws.posture.Override(req.State, req.Reason); err != nil {
+			response.Message = err.Error()
+			break
+		}
+		response.Success = true
+		response.Message = fmt.Sprintf("姿态已设置为 %s", req.State)
+
+	default:
+		http.Error(w, "只支持GET和POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	response.Data = ws.posture.Get()
+	response.EStop = ws.estop.Status()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
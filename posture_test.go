@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPostureCheck(t *testing.T) {
+	tests := []struct {
+		state   Posture
+		isUp    bool
+		isSks   bool
+		wantErr bool
+	}{
+		{PostureStowed, true, true, false},
+		{PostureStowed, false, true, true},
+		{PosturePlayingSKS, true, true, true},
+		{PosturePlayingSKS, false, true, false},
+		{PosturePlayingSKS, false, false, true}, // 萨克斯姿态不能执行唢呐的DOWN
+		{PosturePlayingSN, false, false, false},
+		{PostureFault, true, false, true},
+		{PostureFault, false, false, true},
+		{PostureRaising, true, true, true},
+	}
+	for _, tt := range tests {
+		p := &PostureStore{path: filepath.Join(t.TempDir(), "posture.json"), state: PostureState{State: tt.state}}
+		if err := p.Check(tt.isUp, tt.isSks); (err != nil) != tt.wantErr {
+			t.Errorf("Check(%s, up=%v, sks=%v) error = %v, wantErr %v", tt.state, tt.isUp, tt.isSks, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPostureBeginFinish(t *testing.T) {
+	tests := []struct {
+		name  string
+		isUp  bool
+		isSks bool
+		start Posture
+		err   error
+		want  Posture
+	}{
+		{"UP成功", true, true, PostureStowed, nil, PosturePlayingSKS},
+		{"UP失败", true, false, PostureStowed, errors.New("失败"), PostureFault},
+		{"DOWN成功", false, false, PosturePlayingSN, nil, PostureStowed},
+		{"DOWN取消", false, true, PosturePlayingSKS, errJobCancelled, PostureFault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "posture.json")
+			p := &PostureStore{path: path, state: PostureState{State: tt.start}}
+			if err := p.Begin(tt.isUp, tt.isSks); err != nil {
+				t.Fatalf("Begin() error = %v", err)
+			}
+			inProgress := PostureLowering
+			if tt.isUp {
+				inProgress = PostureRaising
+			}
+			if got := p.Get().State; got != inProgress {
+				t.Fatalf("Begin() 后姿态 = %s, want %s", got, inProgress)
+			}
+			p.Finish(tt.isUp, tt.isSks, tt.err)
+			if got := p.Get().State; got != tt.want {
+				t.Errorf("Finish() 后姿态 = %s, want %s", got, tt.want)
+			}
+			if got := LoadPostureStore(path).Get().State; got != tt.want {
+				t.Errorf("重新读取的姿态 = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPostureStore(t *testing.T) {
+	tests := []struct {
+		name string
+		file string // 空表示文件不存在
+		want Posture
+	}{
+		{"文件不存在", "", PostureStowed},
+		{"演奏姿态", `{"state":"playing-sn","reason":"UP序列完成"}`, PosturePlayingSN},
+		{"中途退出", `{"state":"raising","reason":"开始UP序列"}`, PostureFault},
+		{"未知姿态", `{"state":"flying"}`, PostureFault},
+		{"无效JSON", `{`, PostureFault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "posture.json")
+			if tt.file != "" {
+				if err := ioutil.WriteFile(path, []byte(tt.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := LoadPostureStore(path).Get().State; got != tt.want {
+				t.Errorf("LoadPostureStore() 姿态 = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPostureStoreUnreadable(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, path string)
+	}{
+		{"路径是目录", func(t *testing.T, path string) {
+			if err := os.Mkdir(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"无读权限", func(t *testing.T, path string) {
+			if os.Geteuid() == 0 {
+				t.Skip("root 不受文件权限限制")
+			}
+			if err := ioutil.WriteFile(path, []byte(`{"state":"playing-sn"}`), 0200); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "posture.json")
+			tt.setup(t, path)
+			before, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := LoadPostureStore(path).Get().State; got != PostureFault {
+				t.Errorf("LoadPostureStore() 姿态 = %s, want %s", got, PostureFault)
+			}
+			after, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.IsDir() != before.IsDir() || !after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size() {
+				t.Error("无法读取的状态文件被覆盖")
+			}
+			if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+				t.Error("不应写出临时状态文件")
+			}
+		})
+	}
+}
+
+func TestCheckMotion(t *testing.T) {
+	tests := []struct {
+		state   Posture
+		wantErr bool
+	}{
+		{PostureStowed, false},
+		{PosturePlayingSKS, false},
+		{PosturePlayingSN, false},
+		{PostureFault, true},
+		{PostureRaising, true},
+		{PostureLowering, true},
+	}
+	for _, tt := range tests {
+		p := &PostureStore{state: PostureState{State: tt.state}}
+		if err := p.CheckMotion(); (err != nil) != tt.wantErr {
+			t.Errorf("CheckMotion(%s) error = %v, wantErr %v", tt.state, err, tt.wantErr)
+		}
+	}
+}
+
+func TestClaimMotionChecksArmPosture(t *testing.T) {
+	leases := NewLeaseManager([]string{"can5"})
+	ws := &WebServer{
+		config: &Config{},
+		controllers: map[string]*BlackArmController{
+			"can2": NewBlackArmController(NewCaptureTransport(), "can2", ArmConfig{ArmType: "left", MotorIDs: []int{61}}),
+		},
+		leases:  leases,
+		jobs:    NewJobManager(leases),
+		estop:   &EStopLatch{},
+		posture: &PostureStore{state: PostureState{State: PostureFault}},
+	}
+	if err := ws.claimMotion([]string{"can2"}, false, ""); err == nil {
+		t.Error("姿态为 fault 时手臂运动指令应被拒绝")
+	}
+	if _, err := ws.openJog(JogRequest{Interface: "can2"}); err == nil {
+		t.Error("姿态为 fault 时不应开始手臂点动")
+	}
+	if err := ws.claimMotion([]string{"can5"}, false, ""); err != nil {
+		t.Errorf("手部指令不受姿态限制: %v", err)
+	}
+
+	ws.posture.state.State = PostureStowed
+	if err := ws.claimMotion([]string{"can2"}, false, ""); err != nil {
+		t.Errorf("姿态为 stowed 时 claimMotion() error = %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// replyKey 读取响应的匹配键
+type replyKey struct {
+	motor uint8
+	index uint16
+}
+
+// ReplyDispatcher 接收一个接口上的读取响应帧，按 (电机, 参数索引) 分发给等待者
+type ReplyDispatcher struct {
+	transport CANTransport
+	iface     string
+
+	mu      sync.Mutex
+	subs    map[uint8]*Subscription
+	waiters map[replyKey][]chan replyFrame
+}
+
+// replyFrame 收到的响应值及接收时间
+type replyFrame struct {
+	value uint32
+	at    time.Time
+}
+
+// NewReplyDispatcher 创建读取响应分发器，电机的订阅在首次等待时建立
+func NewReplyDispatcher(transport CANTransport, iface string) *ReplyDispatcher {
+	return &ReplyDispatcher{
+		transport: transport,
+		iface:     iface,
+		subs:      make(map[uint8]*Subscription),
+		waiters:   make(map[replyKey][]chan replyFrame),
+	}
+}
+
+// PendingReply 一个尚未收到的读取响应
+type PendingReply struct {
+	d     *ReplyDispatcher
+	key   replyKey
+	ch    chan replyFrame
+	since time.Time // 请求发送时间，此前收到的帧一律忽略
+}
+
+// Expect 登记对 (motorID, index) 响应的等待，必须在发送读取请求之前调用，
+// 发送前再调用 Sending 标记请求时间
+func (d *ReplyDispatcher) Expect(motorID int, index uint16) (*PendingReply, error) {
+	key := replyKey{uint8(motorID), index}
+
+	// 订阅可能要同步拉取一次桥接缓存，在锁外进行，不阻塞其他电机响应的分发
+	d.mu.Lock()
+	_, subscribed := d.subs[key.motor]
+	d.mu.Unlock()
+	var sub *Subscription
+	if !subscribed {
+		var err error
+		if sub, err = d.transport.Subscribe(d.iface, ExactID(buildReadRespID(defaultHostID, key.motor))); err != nil {
+			return nil, fmt.Errorf("订阅电机 %d 响应失败: %v", motorID, err)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if sub != nil {
+		if _, ok := d.subs[key.motor]; ok {
+			// 并发的 Expect 已经订阅
+			sub.Close()
+		} else {
+			d.subs[key.motor] = sub
+			go d.route(key.motor, sub)
+		}
+	}
+	p := &PendingReply{d: d, key: key, ch: make(chan replyFrame, 8), since: time.Now()}
+	d.waiters[key] = append(d.waiters[key], p.ch)
+	return p, nil
+}
+
+// route 把电机的响应帧交给对应索引的所有等待者，等待者在 Wait 中自行筛选和注销
+func (d *ReplyDispatcher) route(motor uint8, sub *Subscription) {
+	for msg := range sub.C {
+		idx, u, ok := decodeReadResp(msg.Data)
+		if !ok {
+			continue
+		}
+		f := replyFrame{value: u, at: msg.Timestamp}
+		if f.at.IsZero() {
+			f.at = time.Now()
+		}
+
+		d.mu.Lock()
+		for _, ch := range d.waiters[replyKey{motor, idx}] {
+			select {
+			case ch <- f:
+			default:
+			}
+		}
+		d.mu.Unlock()
+	}
+}
+
+// Sending 标记请求即将发送，紧接着发送读取请求前调用
+func (p *PendingReply) Sending() {
+	p.since = time.Now()
+}
+
+// Wait 等待请求发出之后收到的第一个响应，返回参数的原始32位值
+func (p *PendingReply) Wait(timeout time.Duration) (uint32, error) {
+	defer p.Cancel()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case f := <-p.ch:
+			if f.at.Before(p.since) {
+				// 请求发出前已在总线上的帧（如上一次请求迟到的响应）
+				continue
+			}
+			return f.value, nil
+		case <-timer.C:
+			return 0, fmt.Errorf("读取电机 %d 参数 %s 超时", p.key.motor, paramLabel(p.key.index))
+		}
+	}
+}
+
+// Cancel 放弃等待
+func (p *PendingReply) Cancel() {
+	d := p.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	waiters := d.waiters[p.key]
+	for i, ch := range waiters {
+		if ch == p.ch {
+			d.waiters[p.key] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(d.waiters[p.key]) == 0 {
+		delete(d.waiters, p.key)
+	}
+}
+
+// Close 取消所有电机的订阅
+func (d *ReplyDispatcher) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for motor, sub := range d.subs {
+		sub.Close()
+		delete(d.subs, motor)
+	}
+}
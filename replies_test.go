@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// replyTestTransport 把测试注入的帧交给订阅者
+type replyTestTransport struct {
+	subs *subscriberSet
+
+	block      chan struct{} // 不为nil时订阅 blockMotor 的响应阻塞到其关闭（模拟缓慢的基线轮询）
+	blockMotor uint8
+}
+
+func (t *replyTestTransport) Send(msg CANMessage) error { return nil }
+func (t *replyTestTransport) Subscribe(iface string, filter CANFilter) (*Subscription, error) {
+	if t.block != nil && filter.ID == buildReadRespID(defaultHostID, t.blockMotor) {
+		<-t.block
+	}
+	return t.subs.add(iface, filter), nil
+}
+func (t *replyTestTransport) Close() error { return nil }
+
+// readResp 构造电机对参数的读取响应帧
+func readResp(motor uint8, index uint16, value uint32, at time.Time) CANMessage {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint16(data[0:2], index)
+	binary.LittleEndian.PutUint32(data[4:8], value)
+	return CANMessage{Interface: "can0", ID: buildReadRespID(defaultHostID, motor), Data: data, Extended: true, Timestamp: at}
+}
+
+func TestPendingReplyIgnoresFramesBeforeRequest(t *testing.T) {
+	const motor, index = 3, idxMechPos
+	tests := []struct {
+		name    string
+		offsets []time.Duration // 各响应帧相对请求发送时间的偏移
+		index   uint16          // 响应帧的参数索引
+		want    uint32          // 期望取到第几个帧的值（从1开始），0为超时
+	}{
+		{"请求之后的响应", []time.Duration{time.Millisecond}, index, 1},
+		{"请求之前的迟到响应被忽略", []time.Duration{-time.Millisecond}, index, 0},
+		{"跳过迟到响应取之后的响应", []time.Duration{-5 * time.Millisecond, 2 * time.Millisecond}, index, 2},
+		{"其他参数的响应不匹配", []time.Duration{time.Millisecond}, idxLocRef, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &replyTestTransport{subs: newSubscriberSet()}
+			d := NewReplyDispatcher(transport, "can0")
+			defer d.Close()
+
+			p, err := d.Expect(motor, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Sending()
+			for i, off := range tt.offsets {
+				transport.subs.dispatch(readResp(motor, tt.index, uint32(i+1), p.since.Add(off)))
+			}
+
+			got, err := p.Wait(50 * time.Millisecond)
+			if tt.want == 0 {
+				if err == nil {
+					t.Fatalf("Wait() = %d, want timeout", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Wait() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Wait() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectDoesNotBlockOtherMotorsWhileSubscribing(t *testing.T) {
+	transport := &replyTestTransport{subs: newSubscriberSet(), block: make(chan struct{}), blockMotor: 5}
+	d := NewReplyDispatcher(transport, "can0")
+	defer d.Close()
+
+	p, err := d.Expect(3, idxMechPos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := make(chan error, 1)
+	go func() {
+		_, err := d.Expect(5, idxMechPos)
+		slow <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	p.Sending()
+	transport.subs.dispatch(readResp(3, idxMechPos, 7, time.Now()))
+	if got, err := p.Wait(100 * time.Millisecond); err != nil || got != 7 {
+		t.Errorf("电机5订阅期间电机3的 Wait() = %d, %v, want 7", got, err)
+	}
+	close(transport.block)
+	if err := <-slow; err != nil {
+		t.Error(err)
+	}
+}
+
+// legacyBridge 只支持按ID轮询、帧没有时间戳和累计帧数的旧桥接，fail 次请求失败后才返回缓存
+type legacyBridge struct {
+	mu    sync.Mutex
+	fail  int
+	cache []CANMessage
+}
+
+func (b *legacyBridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/capabilities" {
+		http.NotFound(w, r)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail > 0 {
+		b.fail--
+		http.Error(w, "busy", http.StatusInternalServerError)
+		return
+	}
+	var resp listenResponse
+	for _, m := range b.cache {
+		var hexData []string
+		for _, v := range m.Data {
+			hexData = append(hexData, fmt.Sprintf("%02X", v))
+		}
+		resp.Data.Messages = append(resp.Data.Messages, struct {
+			HexData   []string `json:"hex_data"`
+			Timestamp float64  `json:"timestamp"`
+		}{HexData: hexData})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (b *legacyBridge) push(msg CANMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cache = append(b.cache, msg)
+}
+
+func TestExpectFailedBaselineOnLegacyBridge(t *testing.T) {
+	const motor = 3
+	// 桥接缓存中有上一次请求留下的响应（值1），没有时间戳
+	bridge := &legacyBridge{fail: 1, cache: []CANMessage{readResp(motor, idxMechPos, 1, time.Time{})}}
+	srv := httptest.NewServer(bridge)
+	defer srv.Close()
+	transport := NewHTTPBridgeTransport(srv.URL)
+	transport.PollInterval = 10 * time.Millisecond
+	defer transport.Close()
+	d := NewReplyDispatcher(transport, "can0")
+	defer d.Close()
+
+	// 基线拉取失败：不能把缓存当作新帧
+	if _, err := d.Expect(motor, idxMechPos); err == nil {
+		t.Fatal("基线拉取失败时 Expect() 应返回错误")
+	}
+
+	// 重试时基线成功，缓存中的旧响应不能当作本次请求的响应
+	p, err := d.Expect(motor, idxMechPos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Sending()
+	if got, err := p.Wait(50 * time.Millisecond); err == nil {
+		t.Fatalf("Wait() = %d, 取到了请求之前缓存的响应", got)
+	}
+
+	// 请求之后到达的响应正常取到
+	p, err = d.Expect(motor, idxMechPos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Sending()
+	bridge.push(readResp(motor, idxMechPos, 2, time.Time{}))
+	if got, err := p.Wait(200 * time.Millisecond); err != nil || got != 2 {
+		t.Errorf("Wait() = %d, %v, want 2", got, err)
+	}
+}
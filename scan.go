@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// 扫描参数
+const (
+	scanFirstID = 1
+	scanLastID  = 127
+	scanTimeout = 200 * time.Millisecond
+)
+
+// sideByIDDecade 出厂刷写的电机ID约定：左臂 6x，右臂 5x
+var sideByIDDecade = map[int]string{6: "left", 5: "right"}
+
+// ScanResult 一个接口的扫描结果
+type ScanResult struct {
+	Interface  string `json:"interface"`
+	MotorIDs   []int  `json:"motor_ids"`  // 响应的电机ID
+	Side       string `json:"side"`       // 由ID推断的左右臂，无法判断时为 unknown
+	DoF        int    `json:"dof"`        // 响应的电机数
+	Configured []int  `json:"configured"` // 当前使用的电机ID
+	Matches    bool   `json:"matches"`    // 扫描结果与当前使用的ID是否一致
+
+	ConfiguredSide string `json:"configured_side"` // 当前配置的左右臂
+	Error          string `json:"error,omitempty"`
+}
+
+// ScanMotorIDs 向接口上 from..to 的每个ID发送读取 mech_pos 请求，返回有响应的电机ID
+func ScanMotorIDs(transport CANTransport, iface string, from, to int) ([]int, error) {
+	replies := NewReplyDispatcher(transport, iface)
+	defer replies.Close()
+
+	var ids []int
+	var pending []*PendingReply
+	var frames []CANMessage
+	for id := from; id <= to; id++ {
+		p, err := replies.Expect(id, idxMechPos)
+		if err != nil {
+			for _, p := range pending {
+				p.Cancel()
+			}
+			return nil, err
+		}
+		ids = append(ids, id)
+		pending = append(pending, p)
+		frames = append(frames, CANMessage{
+			Interface: iface,
+			ID:        buildReadReqID(defaultHostID, uint8(id)),
+			Data:      buildReadReqData(idxMechPos),
+			Extended:  true,
+		})
+	}
+
+	for _, p := range pending {
+		p.Sending()
+	}
+	if _, err := sendBatch(transport, frames); err != nil {
+		for _, p := range pending {
+			p.Cancel()
+		}
+		return nil, fmt.Errorf("发送扫描请求失败: %v", err)
+	}
+
+	var mu sync.Mutex
+	var found []int
+	var wg sync.WaitGroup
+	for i, p := range pending {
+		wg.Add(1)
+		go func(id int, p *PendingReply) {
+			defer wg.Done()
+			if _, err := p.Wait(scanTimeout); err == nil {
+				mu.Lock()
+				found = append(found, id)
+				mu.Unlock()
+			}
+		}(ids[i], p)
+	}
+	wg.Wait()
+
+	sort.Ints(found)
+	return found, nil
+}
+
+// inferArmSide 按ID约定推断左右臂，ID不在同一约定范围内时返回 unknown
+func inferArmSide(ids []int) string {
+	side := ""
+	for _, id := range ids {
+		s, ok := sideByIDDecade[id/10]
+		if !ok || (side != "" && s != side) {
+			return "unknown"
+		}
+		side = s
+	}
+	if side == "" {
+		return "unknown"
+	}
+	return side
+}
+
+// ScanArms 并发扫描各接口，configured 为各接口当前使用的电机ID，sides 为当前配置的左右臂
+func ScanArms(transports *TransportSet, interfaces []string, configured map[string][]int, sides map[string]string) []ScanResult {
+	sort.Strings(interfaces)
+	results := make([]ScanResult, len(interfaces))
+	var wg sync.WaitGroup
+	for i, iface := range interfaces {
+		wg.Add(1)
+		go func(i int, iface string) {
+			defer wg.Done()
+			r := ScanResult{Interface: iface, Configured: configured[iface], ConfiguredSide: sides[iface]}
+			ids, err := ScanMotorIDs(transports.For(iface), iface, scanFirstID, scanLastID)
+			if err != nil {
+				r.Error = err.Error()
+			}
+			r.MotorIDs = ids
+			r.DoF = len(ids)
+			r.Side = inferArmSide(ids)
+			r.Matches = err == nil && sameIDs(ids, r.Configured)
+			results[i] = r
+			log.Printf("扫描 %s: 响应电机 %v (推断 %s 臂, %d 自由度), 当前使用 %v", iface, ids, r.Side, r.DoF, r.Configured)
+		}(i, iface)
+	}
+	wg.Wait()
+	return results
+}
+
+// scanArms 扫描指定（为空时为全部已配置）手臂接口
+func (ws *WebServer) scanArms(interfaces []string) []ScanResult {
+	ws.mutex.RLock()
+	if len(interfaces) == 0 {
+		for iface := range ws.config.Arms {
+			interfaces = append(interfaces, iface)
+		}
+	}
+	configured := make(map[string][]int, len(ws.controllers))
+	sides := make(map[string]string, len(ws.controllers))
+	for iface, c := range ws.controllers {
+		configured[iface] = c.GetMotorIDs()
+		sides[iface] = c.Side
+	}
+	ws.mutex.RUnlock()
+
+	return ScanArms(ws.transports, interfaces, configured, sides)
+}
+
+// sameIDs 比较两个ID列表（不计顺序）
+func sameIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa := append([]int(nil), a...)
+	sb := append([]int(nil), b...)
+	sort.Ints(sa)
+	sort.Ints(sb)
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mismatch 扫描结果与当前配置不一致之处，一致时为空
+func (r ScanResult) mismatch() string {
+	var diffs []string
+	if !r.Matches {
+		diffs = append(diffs, fmt.Sprintf("响应电机 %v，当前使用 %v", r.MotorIDs, r.Configured))
+	}
+	if r.Side != "unknown" && r.Side != r.ConfiguredSide {
+		diffs = append(diffs, fmt.Sprintf("推断为 %s 臂，当前配置为 %s 臂", r.Side, r.ConfiguredSide))
+	}
+	return strings.Join(diffs, "，")
+}
+
+// writeArmMotorIDs 把扫描到的电机ID和推断的左右臂写回配置文件 arms.{iface}.motor_ids / arm_type，保留其余内容和注释。
+// 扫描结果与当前配置不一致（可能扫到了别的手臂或漏了电机）时拒绝写回，除非 confirm
+func writeArmMotorIDs(path string, results []ScanResult, confirm bool) error {
+	if !confirm {
+		var diffs []string
+		for _, r := range results {
+			if r.Error != "" || len(r.MotorIDs) == 0 {
+				continue
+			}
+			if d := r.mismatch(); d != "" {
+				diffs = append(diffs, r.Interface+": "+d)
+			}
+		}
+		if len(diffs) > 0 {
+			return fmt.Errorf("扫描结果与当前配置不一致，未写回（确认后重试）: %s", strings.Join(diffs, "; "))
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	if len(doc.Content) == 0 {
+		return fmt.Errorf("配置文件为空")
+	}
+	arms := mappingValue(doc.Content[0], "arms")
+	if arms == nil || arms.Kind != yaml3.MappingNode {
+		return fmt.Errorf("配置文件中没有 arms")
+	}
+
+	for _, r := range results {
+		if r.Error != "" || len(r.MotorIDs) == 0 {
+			continue
+		}
+		arm := mappingValue(arms, r.Interface)
+		if arm == nil || arm.Kind != yaml3.MappingNode {
+			return fmt.Errorf("配置文件中没有手臂 %s", r.Interface)
+		}
+
+		seq := &yaml3.Node{Kind: yaml3.SequenceNode, Tag: "!!seq", Style: yaml3.FlowStyle}
+		for _, id := range r.MotorIDs {
+			seq.Content = append(seq.Content, &yaml3.Node{Kind: yaml3.ScalarNode, Tag: "!!int", Value: fmt.Sprint(id)})
+		}
+		setMappingValue(arm, "motor_ids", seq)
+		if r.Side != "unknown" {
+			setMappingValue(arm, "arm_type", &yaml3.Node{Kind: yaml3.ScalarNode, Tag: "!!str", Value: r.Side})
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml3.NewEncoder(&buf)
+	enc.SetIndent(4)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("序列化配置文件失败: %v", err)
+	}
+	enc.Close()
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("写入配置文件失败: %v", err)
+	}
+	return nil
+}
+
+// mappingValue 查找映射节点中键对应的值节点
+func mappingValue(m *yaml3.Node, key string) *yaml3.Node {
+	if m.Kind != yaml3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue 设置映射节点中键的值，键不存在时追加
+func setMappingValue(m *yaml3.Node, key string, value *yaml3.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml3.Node{Kind: yaml3.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// scanRequest POST /api/scan 请求体
+type scanRequest struct {
+	Interfaces  []string `json:"interfaces"`   // 为空时扫描全部手臂接口
+	WriteConfig bool     `json:"write_config"` // 把结果写回 config.yaml
+	Confirm     bool     `json:"confirm"`      // 扫描结果与当前配置不一致时仍然写回
+}
+
+// scanHandler 扫描手臂接口上的电机ID，可选写回配置文件（重启后生效）
+func (ws *WebServer) scanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "只支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req scanRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "解析请求失败", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results := ws.scanArms(req.Interfaces)
+	response := ControlResponse{Success: true, Message: "扫描完成", Data: results}
+	for _, res := range results {
+		if res.Error != "" {
+			response.Success = false
+			response.Message = fmt.Sprintf("扫描 %s 失败: %s", res.Interface, res.Error)
+		}
+	}
+
+	if req.WriteConfig && response.Success {
+		if err := writeArmMotorIDs("config.yaml", results, req.Confirm); err != nil {
+			response.Success = false
+			response.Message = fmt.Sprintf("写回配置失败: %v", err)
+		} else {
+			if err := ws.reloadConfig(); err != nil {
+				log.Printf("重新加载配置失败: %v", err)
+			}
+			response.Message = "扫描完成，已写回 config.yaml 的 arms.motor_ids/arm_type，重启后生效"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
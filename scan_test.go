@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInferArmSide(t *testing.T) {
+	tests := []struct {
+		ids  []int
+		want string
+	}{
+		{[]int{61, 62, 67}, "left"},
+		{[]int{51, 57}, "right"},
+		{[]int{51, 61}, "unknown"},
+		{[]int{12}, "unknown"},
+		{nil, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := inferArmSide(tt.ids); got != tt.want {
+			t.Errorf("inferArmSide(%v) = %s, want %s", tt.ids, got, tt.want)
+		}
+	}
+}
+
+const scanTestConfig = `arms:
+    can2:
+        device_name: left_black_arm # 左臂
+        arm_type: left
+        motor_ids: [61, 62, 63]
+`
+
+func TestWriteArmMotorIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  ScanResult
+		confirm bool
+		wantErr bool
+		want    []string // 写回后文件中应出现的内容
+	}{
+		{
+			name:   "与配置一致时写回",
+			result: ScanResult{Interface: "can2", MotorIDs: []int{61, 62, 63}, Side: "left", Configured: []int{61, 62, 63}, ConfiguredSide: "left", Matches: true},
+			want:   []string{"motor_ids: [61, 62, 63]", "arm_type: left", "# 左臂"},
+		},
+		{
+			name:    "响应电机不一致时拒绝",
+			result:  ScanResult{Interface: "can2", MotorIDs: []int{61, 62}, Side: "left", Configured: []int{61, 62, 63}, ConfiguredSide: "left"},
+			wantErr: true,
+		},
+		{
+			name:    "左右臂不一致时拒绝",
+			result:  ScanResult{Interface: "can2", MotorIDs: []int{51, 52, 53}, Side: "right", Configured: []int{61, 62, 63}, ConfiguredSide: "left"},
+			wantErr: true,
+		},
+		{
+			name:    "确认后写回ID和左右臂",
+			result:  ScanResult{Interface: "can2", MotorIDs: []int{51, 52, 53}, Side: "right", Configured: []int{61, 62, 63}, ConfiguredSide: "left"},
+			confirm: true,
+			want:    []string{"motor_ids: [51, 52, 53]", "arm_type: right"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := ioutil.WriteFile(path, []byte(scanTestConfig), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := writeArmMotorIDs(path, []ScanResult{tt.result}, tt.confirm)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("writeArmMotorIDs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			data, _ := ioutil.ReadFile(path)
+			if tt.wantErr {
+				if string(data) != scanTestConfig {
+					t.Errorf("拒绝写回时配置文件被修改:\n%s", data)
+				}
+				return
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(string(data), w) {
+					t.Errorf("配置文件中没有 %q:\n%s", w, data)
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"embed"
 	"encoding/json"
 	"flag"
@@ -11,10 +10,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -30,6 +32,20 @@ type Config struct {
 
 	// CAN桥接URL
 	CanBridgeURL string `yaml:"can_bridge_url"`
+	// 模拟模式：在 can_bridge_url 的端口上启动内置桥接模拟器，所有接口经HTTP桥接访问虚拟设备
+	Simulate bool `yaml:"simulate"`
+	// 干运行：只记录将要发送的帧，不访问总线
+	DryRun bool `yaml:"dry_run"`
+	// CAN帧日志（candump -l 格式，可用 -replay 回放）
+	CanLog CanLogConfig `yaml:"can_log"`
+	// 序列关键帧之间的插值
+	Trajectory TrajectoryConfig `yaml:"trajectory"`
+	// 点动会话心跳超时
+	Jog JogConfig `yaml:"jog"`
+	// 双臂姿态状态文件（默认 posture_state.json），重启后保留
+	PostureFile string `yaml:"posture_file"`
+	// 收到 SIGINT/SIGTERM 后的关闭策略
+	Shutdown ShutdownConfig `yaml:"shutdown"`
 
 	// 手部预设配置 - 直接从配置文件读取
 	SksLeftPressProfile    []int `yaml:"sks_left_press_profile"`
@@ -51,21 +67,43 @@ type Config struct {
 
 // JointSequence 关节角度序列 - 使用JSON格式
 type JointSequence struct {
-	Name     string          `json:"name"`
-	ArmType  string          `json:"arm_type"`  // "left" or "right"
-	ArmModel string          `json:"arm_model"` // 暂定"old" or "new"
-	Angles   []JointAngleSet `json:"angles"`
+	Name     string `json:"name"`
+	ArmType  string `json:"arm_type"`          // "left" or "right"
+	ArmModel string `json:"arm_model"`         // 暂定"old" or "new"
+	Profile  string `json:"profile,omitempty"` // 关键帧插值曲线 step/linear/cubic/trapezoid，角度组可单独指定
+	// 每组都等待到位（角度组也可单独设置 wait_arrival）
+	WaitArrival bool            `json:"wait_arrival,omitempty"`
+	Angles      []JointAngleSet `json:"angles"`
+
+	LimitViolations []string `json:"limit_violations,omitempty"` // 加载时发现的超出软限位的角度，不写回文件
 }
 
 // JointAngleSet 一组关节角度值 - 使用JSON格式
 type JointAngleSet struct {
-	Name   string             `json:"name"`
-	Values map[string]float32 `json:"values"` // motor_id -> angle
+	Name    string             `json:"name"`
+	Values  map[string]float32 `json:"values"`            // motor_id -> angle
+	Profile string             `json:"profile,omitempty"` // 从上一组到本组的插值曲线，为空时使用序列的设置
+
+	DurationMs int                `json:"duration_ms,omitempty"` // 从上一组到达本组的用时，默认1000
+	DwellMs    int                `json:"dwell_ms,omitempty"`    // 到达后额外停留的时间
+	Speed      map[string]float32 `json:"speed,omitempty"`       // motor_id -> 本段PP速度，未指定的关节使用默认速度0.8
+
+	WaitArrival bool    `json:"wait_arrival,omitempty"` // 读取实测位置等待到位，代替 duration_ms 的固定等待
+	Tolerance   float32 `json:"tolerance,omitempty"`    // 到位容差 rad，默认0.02
+	TimeoutMs   int     `json:"timeout_ms,omitempty"`   // 最后一点下发后等待到位的时限，默认5000，超时则序列中止
 }
 
 type ArmConfig struct {
-	DeviceName string `yaml:"device_name"`
-	ArmType    string `yaml:"arm_type"` // "left" or "right"
+	DeviceName string    `yaml:"device_name"`
+	ArmType    string    `yaml:"arm_type"`    // "left" or "right"，为空时由 motor_ids / device_name 推断
+	Transport  string    `yaml:"transport"`   // "http"（默认，经CAN桥接）或 "socketcan"
+	BridgeURL  string    `yaml:"bridge_url"`  // 该接口使用的CAN桥接URL，为空时使用 can_bridge_url
+	MotorIDs   []int     `yaml:"motor_ids"`   // 电机ID，为空时按左右臂使用出厂ID（左61-67，右51-57）
+	JointNames []string  `yaml:"joint_names"` // 与 motor_ids 一一对应的关节名称
+	InitPose   []float32 `yaml:"init_pose"`   // 合并上举序列时插入的初始角度，与 motor_ids 一一对应
+
+	Limits      map[int]JointLimit `yaml:"limits"`       // 电机ID -> 软限位（min/max/max_speed/max_step）
+	LimitPolicy string             `yaml:"limit_policy"` // 超限处理: reject（默认，拒绝）或 clamp（截断）
 }
 
 type HandConfig struct {
@@ -78,15 +116,26 @@ type HandConfig struct {
 type HandConfigNew struct {
 	Interface string `yaml:"interface"`
 	ID        string `yaml:"id"`
+	Transport string `yaml:"transport"`  // "http"（默认，经CAN桥接）或 "socketcan"
+	BridgeURL string `yaml:"bridge_url"` // 该接口使用的CAN桥接URL，为空时使用 can_bridge_url
 }
 
 // ArmInfo 手臂信息
 type ArmInfo struct {
-	Interface  string `json:"interface"`
-	DeviceName string `json:"device_name"`
-	ArmType    string `json:"arm_type"` // "left" or "right"
-	MotorIDs   []int  `json:"motor_ids"`
-	Status     string `json:"status"`
+	Interface  string   `json:"interface"`
+	DeviceName string   `json:"device_name"`
+	ArmType    string   `json:"arm_type"` // "left" or "right"
+	MotorIDs   []int    `json:"motor_ids"`
+	JointNames []string `json:"joint_names"`
+	Transport  string   `json:"transport"` // 实际使用的传输，如 "http http://host:5260"
+	Status     string   `json:"status"`
+
+	Limits      map[string]map[string]float32 `json:"limits,omitempty"` // 电机ID -> 软限位
+	LimitPolicy string                        `json:"limit_policy"`
+	Owner       *Lease                        `json:"owner,omitempty"` // 当前运动占用者
+	EStop       bool                          `json:"estop_latched"`   // 急停是否锁定
+
+	TelemetryError string `json:"telemetry_error,omitempty"` // 无法订阅电机反馈的原因（实测值和故障不可用）
 }
 
 // JointControl 关节控制参数
@@ -116,7 +165,10 @@ type HandInfo struct {
 	DeviceID   int    `json:"device_id"`
 	DeviceName string `json:"device_name"`
 	HandType   string `json:"hand_type"` // "left" or "right"
+	Transport  string `json:"transport"` // 实际使用的传输
 	Status     string `json:"status"`
+	Owner      *Lease `json:"owner,omitempty"` // 当前运动占用者
+	EStop      bool   `json:"estop_latched"`   // 急停是否锁定
 }
 
 // ControlRequest 控制请求
@@ -130,19 +182,28 @@ type ControlRequest struct {
 	Profile   string         `json:"profile,omitempty"`
 	HandType  string         `json:"hand_type,omitempty"`
 	MotorIDs  []int          `json:"motor_ids,omitempty"` // 用于设置零点时指定电机ID
+	Mode      string         `json:"mode,omitempty"`      // set_mode 的运行模式: mit/pp/velocity/current/csp
+	MIT       MITCommand     `json:"mit,omitempty"`       // set_mit 的运控指令
+	Limit     float32        `json:"limit,omitempty"`     // set_velocity 的电流限制或 set_csp 的速度限制，0为不修改
+	Tolerance float32        `json:"tolerance,omitempty"` // move_and_wait 的到位容差 rad
+	TimeoutMs int            `json:"timeout_ms,omitempty"`
+	Preempt   bool           `json:"preempt,omitempty"` // 抢占占用该接口的任务或点动会话
+	Session   string         `json:"session,omitempty"` // 发出指令的点动会话，会话自己占用的接口不算冲突
 }
 
 // ControlResponse 控制响应
 type ControlResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Data    interface{}  `json:"data,omitempty"`
+	EStop   *EStopStatus `json:"estop,omitempty"` // 急停状态，状态类接口和被急停拒绝的指令返回
 }
 
 // WebServer Web服务器
 type WebServer struct {
 	config      *Config
 	controllers map[string]*BlackArmController
+	transports  *TransportSet
 	mutex       sync.RWMutex
 
 	// 临时角度记录
@@ -152,28 +213,86 @@ type WebServer struct {
 	// 当前角度状态 - 用于实时更新前端显示
 	currentAngles map[string]map[string]float32 // interface -> motor_id -> angle
 	anglesMutex   sync.RWMutex
+
+	// 电机反馈解出的实测状态，启动时按手臂接口创建
+	telemetry map[string]*TelemetryStore
+
+	// 序列执行任务、接口运动占用、急停锁定和双臂姿态
+	jobs    *JobManager
+	leases  *LeaseManager
+	estop   *EStopLatch
+	posture *PostureStore
+
+	// 点动会话
+	jogs    map[string]*JogSession
+	jogMu   sync.Mutex
+	jogNext int
+
+	// 安全关闭：closing 后拒绝新指令，commands 为进行中的指令
+	httpServer *http.Server
+	closing    bool
+	commands   sync.WaitGroup
+	shutdownMu sync.Mutex
 }
 
-// NewWebServer 创建Web服务器
-func NewWebServer(configPath string) (*WebServer, error) {
-	// 读取配置文件
+// loadConfig 读取并解析配置文件
+func loadConfig(configPath string) (*Config, error) {
 	data, err := ioutil.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("读取配置文件失败: %v", err)
 	}
 
 	var config Config
-	err = yaml.Unmarshal(data, &config)
-	if err != nil {
+	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %v", err)
 	}
+	if err := checkArmSides(config.Arms); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// checkArmSides 左臂、右臂各最多一条：按左右查找控制器（序列、关闭策略）时不能有歧义
+func checkArmSides(arms map[string]ArmConfig) error {
+	bySide := make(map[string][]string)
+	for iface, arm := range arms {
+		if side := armSide(arm); side == "left" || side == "right" {
+			bySide[side] = append(bySide[side], iface)
+		}
+	}
+	for _, side := range []string{"left", "right"} {
+		if ifaces := bySide[side]; len(ifaces) > 1 {
+			sort.Strings(ifaces)
+			return fmt.Errorf("配置错误: 接口 %s 都是 %s 臂，请检查 arms 的 arm_type/motor_ids", strings.Join(ifaces, "、"), side)
+		}
+	}
+	return nil
+}
+
+// NewWebServer 创建Web服务器
+func NewWebServer(config *Config) (*WebServer, error) {
+	transports, err := NewTransportSet(config)
+	if err != nil {
+		return nil, fmt.Errorf("创建CAN传输失败: %v", err)
+	}
 
 	server := &WebServer{
-		config:           &config,
+		config:           config,
 		controllers:      make(map[string]*BlackArmController),
+		transports:       transports,
 		tempAngleRecords: make(map[string][]JointAngleSet),
 		currentAngles:    make(map[string]map[string]float32),
+		telemetry:        make(map[string]*TelemetryStore),
+		jogs:             make(map[string]*JogSession),
+	}
+	var handInterfaces []string
+	for _, hand := range config.Hands {
+		handInterfaces = append(handInterfaces, hand.Interface)
 	}
+	server.leases = NewLeaseManager(handInterfaces)
+	server.jobs = NewJobManager(server.leases)
+	server.estop = &EStopLatch{}
+	server.posture = LoadPostureStore(config.PostureFile)
 
 	// 加载序列配置文件
 	err = server.loadSequenceConfig()
@@ -182,14 +301,16 @@ func NewWebServer(configPath string) (*WebServer, error) {
 		// 不返回错误，继续启动服务器
 	}
 
-	// 不再进行自动检测，直接使用配置文件中的设置
-	log.Printf("使用配置文件中的设备配置，跳过自动检测")
+	// 启动时不扫描总线，直接使用配置文件中的设置；电机ID可通过 POST /api/scan 或 -scan 扫描并写回
+	log.Printf("使用配置文件中的设备配置（扫描电机ID: POST /api/scan 或 -scan）")
 
 	// 初始化所有手臂控制器
 	for interfaceName, armConfig := range config.Arms {
-		controller := NewBlackArmController("http://localhost:5260", interfaceName, armConfig.DeviceName)
+		controller := NewBlackArmController(transports.For(interfaceName), interfaceName, armConfig)
 		if controller != nil {
+			controller.Latch = server.estop
 			server.controllers[interfaceName] = controller
+			server.startTelemetry(interfaceName, controller.Transport)
 			log.Printf("初始化手臂控制器: %s (%s)", interfaceName, armConfig.DeviceName)
 		}
 	}
@@ -197,38 +318,27 @@ func NewWebServer(configPath string) (*WebServer, error) {
 	return server, nil
 }
 
-// determineArmType 根据电机ID范围判断臂类型
-func determineArmType(motorIDs []int) string {
-	if len(motorIDs) == 0 {
-		return "unknown"
-	}
-
-	// 检查是否所有电机ID都在51-57范围内（右臂）
-	allInRightRange := true
-	for _, id := range motorIDs {
-		if id < 51 || id > 57 {
-			allInRightRange = false
-			break
+// controllerBySide 查找指定左右的手臂控制器，调用方持有 ws.mutex
+func (ws *WebServer) controllerBySide(side string) *BlackArmController {
+	for _, controller := range ws.controllers {
+		if controller.Side == side {
+			return controller
 		}
 	}
-	if allInRightRange {
-		return "right"
-	}
+	return nil
+}
 
-	// 检查是否所有电机ID都在61-67范围内（左臂）
-	allInLeftRange := true
-	for _, id := range motorIDs {
-		if id < 61 || id > 67 {
-			allInLeftRange = false
-			break
+// initAngleSet 上举序列的初始角度组，新臂（arm_model为new）关节方向相反
+func (b *BlackArmController) initAngleSet(armModel string) JointAngleSet {
+	set := JointAngleSet{Name: "初始角度", Values: make(map[string]float32, len(b.MotorIDs))}
+	for i, motorID := range b.MotorIDs {
+		angle := b.InitPose[i]
+		if armModel == "new" {
+			angle = -angle
 		}
+		set.Values[strconv.Itoa(motorID)] = angle
 	}
-	if allInLeftRange {
-		return "left"
-	}
-
-	// 如果不在预期范围内，返回unknown
-	return "unknown"
+	return set
 }
 
 // ensureJSONDir 确保json目录存在
@@ -276,6 +386,8 @@ func (ws *WebServer) loadSequenceConfig() error {
 			continue
 		}
 
+		checkSequenceSteps(&sequence)
+		flagSequenceLimits(ws.config, &sequence)
 		allSequences = append(allSequences, sequence)
 		log.Printf("加载序列: %s (%s臂, %d 组角度) 从文件 %s", sequence.Name, sequence.ArmType, len(sequence.Angles), file.Name())
 	}
@@ -311,6 +423,17 @@ func (ws *WebServer) Start(port int) error {
 	http.HandleFunc("/api/joint-sequences/merged/", ws.listMergedSequencesHandler)
 	http.HandleFunc("/api/joint-sequences/execute-merged/", ws.executeMergedSequenceHandler)
 	http.HandleFunc("/api/current-angles/", ws.getCurrentAnglesHandler)
+	http.HandleFunc("/api/dryrun/trace", ws.dryRunTraceHandler)
+	http.HandleFunc("/api/params/", ws.paramsHandler)
+	http.HandleFunc("/api/faults", ws.faultsHandler)
+	http.HandleFunc("/api/scan", ws.scanHandler)
+	http.HandleFunc("/api/jobs", ws.jobsHandler)
+	http.HandleFunc("/api/jobs/", ws.jobsHandler)
+	http.HandleFunc("/api/estop", ws.estopHandler)
+	http.HandleFunc("/api/estop/", ws.estopHandler)
+	http.HandleFunc("/api/jog", ws.jogHandler)
+	http.HandleFunc("/api/jog/", ws.jogHandler)
+	http.HandleFunc("/api/posture", ws.postureHandler)
 
 	// 静态文件服务器 - 必须在最后注册，作为默认处理
 	http.Handle("/", http.FileServer(http.FS(staticFS)))
@@ -318,7 +441,17 @@ func (ws *WebServer) Start(port int) error {
 	log.Printf("Web服务器启动在端口 %d", port)
 	log.Printf("已注册API路由: /api/arms, /api/hands, /api/arm/, /api/hand/, /api/joints/, /api/config/update")
 	fmt.Println("🌐 访问地址: http://localhost:8080")
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: ws.withEStopHeader(ws.withShutdownGate(http.DefaultServeMux)),
+	}
+	ws.shutdownMu.Lock()
+	ws.httpServer = httpServer
+	ws.shutdownMu.Unlock()
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
 // getArmsHandler 获取所有手臂信息
@@ -329,14 +462,24 @@ func (ws *WebServer) getArmsHandler(w http.ResponseWriter, r *http.Request) {
 	var arms []ArmInfo
 	for interfaceName, controller := range ws.controllers {
 		motorIDs := controller.GetMotorIDs()
-		armType := determineArmType(motorIDs)
+		armType := controller.Side
 		deviceName := ws.config.Arms[interfaceName].DeviceName
 		arm := ArmInfo{
 			Interface:  interfaceName,
 			DeviceName: deviceName,
 			ArmType:    armType,
 			MotorIDs:   motorIDs,
+			JointNames: controller.JointNames,
+			Transport:  ws.transports.Describe(interfaceName),
 			Status:     "connected",
+
+			Limits:      limitSummary(controller.Limits),
+			LimitPolicy: controller.LimitPolicy,
+			Owner:       ws.leases.ownerOf(interfaceName),
+			EStop:       ws.estop.Check() != nil,
+		}
+		if store, ok := ws.telemetry[interfaceName]; ok {
+			arm.TelemetryError = store.Unavailable()
 		}
 		arms = append(arms, arm)
 
@@ -372,7 +515,10 @@ func (ws *WebServer) getHandsHandler(w http.ResponseWriter, r *http.Request) {
 			DeviceID:   deviceID,
 			DeviceName: deviceName,
 			HandType:   handSide,
+			Transport:  ws.transports.Describe(handConfig.Interface),
 			Status:     "connected",
+			Owner:      ws.leases.ownerOf(handConfig.Interface),
+			EStop:      ws.estop.Check() != nil,
 		}
 		hands = append(hands, hand)
 
@@ -406,6 +552,19 @@ func (ws *WebServer) armControlHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "未找到指定的手臂接口", http.StatusNotFound)
 		return
 	}
+	var claimErr error
+	switch req.Action {
+	case "queryangles":
+	case "disable", "clean_error":
+		// 急停锁定时仍允许失能和清除错误
+		claimErr = ws.claimLease([]string{req.Interface}, req.Preempt, req.Session)
+	default:
+		claimErr = ws.claimMotion([]string{req.Interface}, req.Preempt, req.Session)
+	}
+	if claimErr != nil {
+		ws.writeRefused(w, claimErr)
+		return
+	}
 
 	var response ControlResponse
 
@@ -457,27 +616,20 @@ func (ws *WebServer) armControlHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 	case "clean_error":
-		err := controller.CleanError()
+		results, err := ws.cleanErrors(req.Interface, controller)
 		response.Success = err == nil
 		if err != nil {
 			response.Message = fmt.Sprintf("清除错误失败: %v", err)
 		} else {
-			response.Message = "清除错误成功"
+			response.Message = summarizeFaultClear(results)
 		}
+		response.Data = results
 
 	case "queryangles":
 		log.Printf("收到查询角度请求: interface=%s", req.Interface)
 
-		// 获取CAN桥接URL
-		canBridgeURL := ws.config.CanBridgeURL
-		if canBridgeURL == "" {
-			canBridgeURL = "http://localhost:5260"
-		}
-
-		log.Printf("开始查询角度: interface=%s, canBridgeURL=%s", req.Interface, canBridgeURL)
-
 		// 调用查询函数
-		angles, params, err := QueryCurrentAngles(canBridgeURL, req.Interface, controller.GetMotorIDs())
+		angles, params, err := controller.QueryCurrentAngles()
 
 		if err != nil {
 			log.Printf("查询失败: %v", err)
@@ -539,6 +691,10 @@ func (ws *WebServer) handControlHandler(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "未找到指定的手部接口", http.StatusNotFound)
 		return
 	}
+	if err := ws.claimMotion([]string{req.Interface}, req.Preempt, req.Session); err != nil {
+		ws.writeRefused(w, err)
+		return
+	}
 
 	var response ControlResponse
 
@@ -574,8 +730,11 @@ func (ws *WebServer) handControlHandler(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
-// sendHandCommand 发送手部控制命令
+// sendHandCommand 发送手部控制命令，急停锁定时拒绝
 func (ws *WebServer) sendHandCommand(interfaceName string, deviceID int, hand HandControl) error {
+	if err := ws.estop.Check(); err != nil {
+		return err
+	}
 	// 构建CAN消息数据
 	data := []byte{0x01} // 控制码固定为0x01
 	data = append(data, byte(hand.Thumb))
@@ -591,29 +750,17 @@ func (ws *WebServer) sendHandCommand(interfaceName string, deviceID int, hand Ha
 	// }
 
 	// 构建CAN消息
-	canMessage := map[string]interface{}{
-		"interface": interfaceName,
-		"id":        deviceID,
-		"data":      data,
+	canMessage := CANMessage{
+		Interface: interfaceName,
+		ID:        uint32(deviceID),
+		Data:      data,
 	}
 
 	log.Printf("发送手部控制命令: interface=%s, id=%d, data=%v", interfaceName, deviceID, data)
 
-	// 发送到CAN桥接服务器
-	jsonData, err := json.Marshal(canMessage)
-	if err != nil {
-		return fmt.Errorf("序列化CAN消息失败: %v", err)
-	}
-
-	resp, err := http.Post("http://localhost:5260/api/can", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
+	if err := ws.transports.Send(canMessage); err != nil {
 		return fmt.Errorf("发送CAN消息失败: %v", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("CAN消息发送失败，状态码: %d", resp.StatusCode)
-	}
 
 	log.Printf("手部控制命令发送成功")
 	return nil
@@ -852,23 +999,19 @@ func (ws *WebServer) updateExternalConfig(handType, profile string, values []int
 
 // reloadConfig 重新加载配置文件
 func (ws *WebServer) reloadConfig() error {
-	// 读取配置文件
-	data, err := ioutil.ReadFile("config.yaml")
+	newConfig, err := loadConfig("config.yaml")
 	if err != nil {
-		return fmt.Errorf("读取配置文件失败: %v", err)
-	}
-
-	var newConfig Config
-	err = yaml.Unmarshal(data, &newConfig)
-	if err != nil {
-		return fmt.Errorf("解析配置文件失败: %v", err)
+		return err
 	}
 
-	// 更新配置（保留原有的关节序列配置）
+	// 更新配置（保留原有的关节序列配置和启动时确定的模拟/干运行模式）
 	ws.mutex.Lock()
 	oldSequences := ws.config.JointSequences
-	ws.config = &newConfig
+	simulate, dryRun := ws.config.Simulate, ws.config.DryRun
+	ws.config = newConfig
 	ws.config.JointSequences = oldSequences
+	ws.config.Simulate = simulate
+	ws.config.DryRun = dryRun
 	ws.mutex.Unlock()
 
 	log.Printf("配置文件重新加载成功")
@@ -948,6 +1091,11 @@ func (ws *WebServer) jointControlHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := ws.claimMotion([]string{req.Interface}, req.Preempt, req.Session); err != nil {
+		ws.writeRefused(w, err)
+		return
+	}
+
 	var response ControlResponse
 
 	switch req.Action {
@@ -959,7 +1107,7 @@ func (ws *WebServer) jointControlHandler(w http.ResponseWriter, r *http.Request)
 		} else {
 			response.Message = "设置角度成功"
 			// 更新当前角度状态
-			ws.updateCurrentAngle(req.Interface, strconv.Itoa(req.JointID), req.Value)
+			ws.updateCommandedAngles(req.Interface, controller, req.JointID)
 		}
 
 	case "set_speed":
@@ -1012,17 +1160,91 @@ func (ws *WebServer) jointControlHandler(w http.ResponseWriter, r *http.Request)
 		for _, joint := range req.Joints {
 			angles = append(angles, joint.Angle)
 		}
-		err := controller.SetAngles(angles)
+		dispatch, err := controller.SetAngles(angles)
 		response.Success = err == nil
 		if err != nil {
 			response.Message = fmt.Sprintf("设置所有角度失败: %v", err)
 		} else {
 			response.Message = "设置所有角度成功"
+			response.Data = map[string]interface{}{"dispatch": dispatch}
 			// 更新当前角度状态
 			for _, joint := range req.Joints {
-				ws.updateCurrentAngle(req.Interface, strconv.Itoa(joint.JointID), joint.Angle)
+				ws.updateCommandedAngles(req.Interface, controller, joint.JointID)
 			}
 		}
+	case "move_and_wait":
+		targets := make(map[int]float32, len(req.Joints))
+		for _, joint := range req.Joints {
+			targets[joint.JointID] = joint.Angle
+		}
+		arrival, err := controller.MoveAndWait(targets, req.Tolerance, time.Duration(req.TimeoutMs)*time.Millisecond)
+		response.Success = err == nil
+		if err != nil {
+			response.Message = fmt.Sprintf("移动未完成: %v", err)
+		} else {
+			response.Message = fmt.Sprintf("已到位，最大误差 %.4f rad，用时 %dms", arrival.MaxError, arrival.ElapsedMs)
+		}
+		response.Data = arrival
+		if err == nil || arrival.Errors != nil {
+			for motorID := range targets {
+				ws.updateCommandedAngles(req.Interface, controller, motorID)
+			}
+		}
+
+	case "set_mode":
+		mode, err := parseRunMode(req.Mode)
+		if err == nil {
+			if req.JointID == 0 {
+				err = controller.SetRunModeAll(mode)
+			} else {
+				err = controller.SetRunMode(req.JointID, mode)
+			}
+		}
+		response.Success = err == nil
+		if err != nil {
+			response.Message = fmt.Sprintf("切换运行模式失败: %v", err)
+		} else {
+			response.Message = fmt.Sprintf("已切换到 %s 模式", runModeNames[mode])
+		}
+
+	case "set_mit":
+		err := controller.SetMIT(req.JointID, req.MIT)
+		response.Success = err == nil
+		if err != nil {
+			response.Message = fmt.Sprintf("运控指令失败: %v", err)
+		} else {
+			response.Message = "运控指令成功"
+			ws.updateCommandedAngles(req.Interface, controller, req.JointID)
+		}
+
+	case "set_velocity":
+		err := controller.SetVelocity(req.JointID, req.Value, req.Limit)
+		response.Success = err == nil
+		if err != nil {
+			response.Message = fmt.Sprintf("设置目标速度失败: %v", err)
+		} else {
+			response.Message = "设置目标速度成功"
+		}
+
+	case "set_current":
+		err := controller.SetCurrent(req.JointID, req.Value)
+		response.Success = err == nil
+		if err != nil {
+			response.Message = fmt.Sprintf("设置电流失败: %v", err)
+		} else {
+			response.Message = "设置电流成功"
+		}
+
+	case "set_csp":
+		err := controller.SetCSP(req.JointID, req.Value, req.Limit)
+		response.Success = err == nil
+		if err != nil {
+			response.Message = fmt.Sprintf("CSP设置位置失败: %v", err)
+		} else {
+			response.Message = "CSP设置位置成功"
+			ws.updateCommandedAngles(req.Interface, controller, req.JointID)
+		}
+
 	case "set_down_up_angles":
 		//支持启动我们保存的序列，前端勾选，将json传给后端启动
 		//按照json的left和right,分别并行执行
@@ -1044,9 +1266,13 @@ func (ws *WebServer) tempAngleHandler(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		// 记录当前角度
 		var req struct {
-			Interface string             `json:"interface"`
-			Name      string             `json:"name"`
-			Angles    map[string]float32 `json:"angles"`
+			Interface  string             `json:"interface"`
+			Name       string             `json:"name"`
+			Angles     map[string]float32 `json:"angles"`
+			Profile    string             `json:"profile"`
+			DurationMs int                `json:"duration_ms"`
+			DwellMs    int                `json:"dwell_ms"`
+			Speed      map[string]float32 `json:"speed"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1061,11 +1287,21 @@ func (ws *WebServer) tempAngleHandler(w http.ResponseWriter, r *http.Request) {
 		if !exists {
 			response.Success = false
 			response.Message = "未找到指定的机械臂接口"
+		} else if err := checkProfile(req.Profile); err != nil {
+			response.Success = false
+			response.Message = err.Error()
+		} else if req.DurationMs < 0 || req.DwellMs < 0 {
+			response.Success = false
+			response.Message = "duration_ms 和 dwell_ms 不能为负"
 		} else {
-			// 使用从前端传来的角度数据
+			// 使用从前端传来的角度数据，连同本段的用时、停留和速度
 			angleSet := JointAngleSet{
-				Name:   req.Name,
-				Values: req.Angles,
+				Name:       req.Name,
+				Values:     req.Angles,
+				Profile:    req.Profile,
+				DurationMs: req.DurationMs,
+				DwellMs:    req.DwellMs,
+				Speed:      req.Speed,
 			}
 
 			ws.tempMutex.Lock()
@@ -1142,8 +1378,7 @@ func (ws *WebServer) jointSequenceHandler(w http.ResponseWriter, r *http.Request
 			var armType string
 			ws.mutex.RLock()
 			if controller, exists := ws.controllers[req.Interface]; exists {
-				motorIDs := controller.GetMotorIDs()
-				armType = determineArmType(motorIDs)
+				armType = controller.Side
 			}
 			ws.mutex.RUnlock()
 
@@ -1231,6 +1466,7 @@ func (ws *WebServer) executeSequenceHandler(w http.ResponseWriter, r *http.Reque
 	var req struct {
 		SequenceName string `json:"sequence_name"`
 		Interface    string `json:"interface"`
+		Preempt      bool   `json:"preempt"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1248,8 +1484,7 @@ func (ws *WebServer) executeSequenceHandler(w http.ResponseWriter, r *http.Reque
 		response.Message = "未找到指定的机械臂接口"
 	} else {
 		// 获取当前接口的臂类型
-		motorIDs := controller.GetMotorIDs()
-		currentArmType := determineArmType(motorIDs)
+		currentArmType := controller.Side
 
 		// 查找序列 - 通过name和arm_type匹配
 		var sequence *JointSequence
@@ -1264,11 +1499,24 @@ func (ws *WebServer) executeSequenceHandler(w http.ResponseWriter, r *http.Reque
 		if sequence == nil {
 			response.Success = false
 			response.Message = "未找到指定的序列"
+		} else if err := ws.estop.Check(); err != nil {
+			ws.writeRefused(w, err)
+			return
+		} else if err := ws.posture.CheckMotion(); err != nil {
+			ws.writeRefused(w, err)
+			return
 		} else {
-			// 执行序列
-			go ws.executeSequenceAsync(controller, sequence)
+			// 作为任务执行序列
+			job, err := ws.jobs.Submit("sequence", sequence.Name, []string{req.Interface}, req.Preempt, func(job *Job) error {
+				return ws.executeSequenceJob(controller, sequence, job)
+			})
+			if err != nil {
+				ws.writeRefused(w, err)
+				return
+			}
 			response.Success = true
-			response.Message = fmt.Sprintf("开始执行序列: %s", sequence.Name)
+			response.Message = fmt.Sprintf("开始执行序列: %s（任务 %s）", sequence.Name, job.ID)
+			response.Data = map[string]interface{}{"job": job.Status()}
 		}
 	}
 
@@ -1276,8 +1524,12 @@ func (ws *WebServer) executeSequenceHandler(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(response)
 }
 
-// executeSequenceAsync 异步执行序列
-func (ws *WebServer) executeSequenceAsync(controller *BlackArmController, sequence *JointSequence) {
+// executeSequenceJob 在任务中执行序列
+func (ws *WebServer) executeSequenceJob(controller *BlackArmController, sequence *JointSequence, job *Job) error {
+	// 排队期间姿态可能已变化，开始时再检查一次
+	if err := ws.posture.CheckMotion(); err != nil {
+		return err
+	}
 	log.Printf("开始执行序列: %s", sequence.Name)
 
 	// 确定接口名称
@@ -1291,31 +1543,23 @@ func (ws *WebServer) executeSequenceAsync(controller *BlackArmController, sequen
 	}
 	ws.mutex.RUnlock()
 
-	for i, angleSet := range sequence.Angles {
-		log.Printf("执行第 %d 组角度: %s", i+1, angleSet.Name)
-
-		// 设置每个关节的角度
-		for motorIDStr, angle := range angleSet.Values {
-			motorID, err := strconv.Atoi(motorIDStr)
-			if err != nil {
-				log.Printf("无效的电机ID: %s", motorIDStr)
-				continue
-			}
+	ws.mutex.RLock()
+	traj := ws.config.Trajectory
+	ws.mutex.RUnlock()
 
-			err = controller.SetAngle(motorID, angle)
-			if err != nil {
-				log.Printf("设置电机 %d 角度失败: %v", motorID, err)
-			} else {
-				// 更新当前角度状态
-				ws.updateCurrentAngle(interfaceName, motorIDStr, angle)
-			}
+	// 每组到达后更新当前角度状态
+	err := playSequence(controller, sequence, traj, job, nil, func(i int, targets map[int]float32) {
+		for motorID, angle := range targets {
+			ws.updateCurrentAngle(interfaceName, strconv.Itoa(motorID), angle)
 		}
-
-		time.Sleep(1 * time.Second)
-
+	})
+	if err != nil {
+		log.Printf("序列 %s 中止: %v", sequence.Name, err)
+		return err
 	}
 
 	log.Printf("序列执行完成: %s", sequence.Name)
+	return nil
 }
 
 // updateCurrentAngle 更新当前角度状态
@@ -1329,7 +1573,16 @@ func (ws *WebServer) updateCurrentAngle(interfaceName, motorID string, angle flo
 	ws.currentAngles[interfaceName][motorID] = angle
 }
 
-// getCurrentAnglesHandler 获取当前角度状态
+// updateCommandedAngles 按控制器实际下发的指令角度（clamp 策略下为截断后的值）更新当前角度状态
+func (ws *WebServer) updateCommandedAngles(interfaceName string, controller *BlackArmController, jointIDs ...int) {
+	for _, jointID := range jointIDs {
+		if angle, ok := controller.lastTarget(jointID); ok {
+			ws.updateCurrentAngle(interfaceName, strconv.Itoa(jointID), angle)
+		}
+	}
+}
+
+// getCurrentAnglesHandler 获取当前角度状态：指令角度(commanded)和电机反馈的实测状态(measured)
 func (ws *WebServer) getCurrentAnglesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "只支持GET方法", http.StatusMethodNotAllowed)
@@ -1343,13 +1596,25 @@ func (ws *WebServer) getCurrentAnglesHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	ws.anglesMutex.RLock()
-	angles := ws.currentAngles[interfaceName]
+	angles := make(map[string]float32, len(ws.currentAngles[interfaceName]))
+	for id, angle := range ws.currentAngles[interfaceName] {
+		angles[id] = angle
+	}
 	ws.anglesMutex.RUnlock()
 
+	measured := map[string]MotorTelemetry{}
+	if store, ok := ws.telemetry[interfaceName]; ok {
+		measured = store.Snapshot()
+	}
+
 	response := ControlResponse{
 		Success: true,
 		Message: "获取当前角度成功",
-		Data:    angles,
+		Data: map[string]interface{}{
+			"commanded": angles,
+			"measured":  measured,
+		},
+		EStop: ws.estop.Status(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1397,6 +1662,8 @@ func (ws *WebServer) mergeSequencesHandler(w http.ResponseWriter, r *http.Reques
 		// 创建合并后的序列数组,保留两个独立的序列
 		leftSeq := *sequence1
 		rightSeq := *sequence2
+		leftSeq.LimitViolations = nil
+		rightSeq.LimitViolations = nil
 
 		// 设置 arm_model，优先使用请求中的值，否则使用序列原有值，最后默认 "old"
 		armModel := req.ArmModel
@@ -1415,33 +1682,19 @@ func (ws *WebServer) mergeSequencesHandler(w http.ResponseWriter, r *http.Reques
 		isUpMerge := strings.Contains(strings.ToLower(req.MergedName), "up")
 		isDownMerge := strings.Contains(strings.ToLower(req.MergedName), "down")
 
-		// 区分新老臂（关节运动是反的）
-		Angle2set62 := float32(0.1)
-		Angle2set52 := float32(-0.1)
-		if armModel == "new" {
-			Angle2set62 = -Angle2set62
-			Angle2set52 = -Angle2set52
-		}
-
-		// 如果是up合并,在第一段前添加初始角度，并同时生成down序列
+		// 如果是up合并,在第一段前添加各臂配置的初始角度，并同时生成down序列
 		if isUpMerge {
-			// 左臂添加初始角度 (电机ID 61-67)
-			leftInitAngle := JointAngleSet{
-				Name: "初始角度",
-				Values: map[string]float32{
-					"61": 0, "62": Angle2set62, "63": 0, "64": 0, "65": 0, "66": 0, "67": 0,
-				},
+			ws.mutex.RLock()
+			leftController := ws.controllerBySide(leftSeq.ArmType)
+			rightController := ws.controllerBySide(rightSeq.ArmType)
+			ws.mutex.RUnlock()
+
+			if leftController != nil {
+				leftSeq.Angles = append([]JointAngleSet{leftController.initAngleSet(armModel)}, leftSeq.Angles...)
 			}
-			leftSeq.Angles = append([]JointAngleSet{leftInitAngle}, leftSeq.Angles...)
-
-			// 右臂添加初始角度 (电机ID 51-57)
-			rightInitAngle := JointAngleSet{
-				Name: "初始角度",
-				Values: map[string]float32{
-					"51": 0, "52": Angle2set52, "53": 0, "54": 0, "55": 0, "56": 0, "57": 0,
-				},
+			if rightController != nil {
+				rightSeq.Angles = append([]JointAngleSet{rightController.initAngleSet(armModel)}, rightSeq.Angles...)
 			}
-			rightSeq.Angles = append([]JointAngleSet{rightInitAngle}, rightSeq.Angles...)
 
 			// 保存 UP 序列
 			mergedSequences := []JointSequence{leftSeq, rightSeq}
@@ -1464,24 +1717,10 @@ func (ws *WebServer) mergeSequencesHandler(w http.ResponseWriter, r *http.Reques
 				rightSeqDown.Name = strings.Replace(rightSeq.Name, "up", "down", -1)
 
 				// 反转左臂序列：去掉最后一个，然后反转
-				if len(leftSeqDown.Angles) > 1 {
-					leftAnglesWithoutLast := leftSeqDown.Angles[:len(leftSeqDown.Angles)-1]
-					leftReversed := make([]JointAngleSet, len(leftAnglesWithoutLast))
-					for i, angle := range leftAnglesWithoutLast {
-						leftReversed[len(leftAnglesWithoutLast)-1-i] = angle
-					}
-					leftSeqDown.Angles = leftReversed
-				}
+				leftSeqDown.Angles = reverseForDown(leftSeqDown.Angles)
 
 				// 反转右臂序列：去掉最后一个，然后反转
-				if len(rightSeqDown.Angles) > 1 {
-					rightAnglesWithoutLast := rightSeqDown.Angles[:len(rightSeqDown.Angles)-1]
-					rightReversed := make([]JointAngleSet, len(rightAnglesWithoutLast))
-					for i, angle := range rightAnglesWithoutLast {
-						rightReversed[len(rightAnglesWithoutLast)-1-i] = angle
-					}
-					rightSeqDown.Angles = rightReversed
-				}
+				rightSeqDown.Angles = reverseForDown(rightSeqDown.Angles)
 
 				mergedSequencesDown := []JointSequence{leftSeqDown, rightSeqDown}
 				errDown := ws.saveMergedSequence(downName, mergedSequencesDown)
@@ -1504,24 +1743,10 @@ func (ws *WebServer) mergeSequencesHandler(w http.ResponseWriter, r *http.Reques
 		} else if isDownMerge {
 			// 如果直接合并down序列，按原逻辑处理
 			// 反转左臂序列：去掉最后一个，然后反转
-			if len(leftSeq.Angles) > 1 {
-				leftAnglesWithoutLast := leftSeq.Angles[:len(leftSeq.Angles)-1]
-				leftReversed := make([]JointAngleSet, len(leftAnglesWithoutLast))
-				for i, angle := range leftAnglesWithoutLast {
-					leftReversed[len(leftAnglesWithoutLast)-1-i] = angle
-				}
-				leftSeq.Angles = leftReversed
-			}
+			leftSeq.Angles = reverseForDown(leftSeq.Angles)
 
 			// 反转右臂序列：去掉最后一个，然后反转
-			if len(rightSeq.Angles) > 1 {
-				rightAnglesWithoutLast := rightSeq.Angles[:len(rightSeq.Angles)-1]
-				rightReversed := make([]JointAngleSet, len(rightAnglesWithoutLast))
-				for i, angle := range rightAnglesWithoutLast {
-					rightReversed[len(rightAnglesWithoutLast)-1-i] = angle
-				}
-				rightSeq.Angles = rightReversed
-			}
+			rightSeq.Angles = reverseForDown(rightSeq.Angles)
 
 			mergedSequences := []JointSequence{leftSeq, rightSeq}
 			err := ws.saveMergedSequence(req.MergedName, mergedSequences)
@@ -1736,6 +1961,7 @@ func (ws *WebServer) executeMergedSequenceHandler(w http.ResponseWriter, r *http
 
 	var req struct {
 		FileName string `json:"file_name"`
+		Preempt  bool   `json:"preempt"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1767,17 +1993,8 @@ func (ws *WebServer) executeMergedSequenceHandler(w http.ResponseWriter, r *http
 	//	leftInterface, rightInterface := "", ""
 
 	ws.mutex.RLock()
-	for _, controller := range ws.controllers {
-		motorIDs := controller.GetMotorIDs()
-		if len(motorIDs) > 0 && motorIDs[0] >= 61 && motorIDs[0] <= 67 {
-			leftController = controller
-			//		leftInterface = iface
-		}
-		if len(motorIDs) > 0 && motorIDs[0] >= 51 && motorIDs[0] <= 57 {
-			rightController = controller
-			//	rightInterface = iface
-		}
-	}
+	leftController = ws.controllerBySide("left")
+	rightController = ws.controllerBySide("right")
 	ws.mutex.RUnlock()
 
 	if leftController == nil || rightController == nil {
@@ -1800,21 +2017,54 @@ func (ws *WebServer) executeMergedSequenceHandler(w http.ResponseWriter, r *http
 		http.Error(w, "序列文件中缺少左右臂数据", http.StatusBadRequest)
 		return
 	}
+	ws.mutex.RLock()
+	checkSequenceSteps(leftSeq)
+	checkSequenceSteps(rightSeq)
+	flagSequenceLimits(ws.config, leftSeq)
+	flagSequenceLimits(ws.config, rightSeq)
+	ws.mutex.RUnlock()
 
-	// 异步执行左右臂序列
-	//go ws.executeSequenceAsync(leftController, leftSeq)
-	//go ws.executeSequenceAsync(rightController, rightSeq)
+	if !isUp && !isDown {
+		http.Error(w, "无法从文件名判断是up还是down序列", http.StatusBadRequest)
+		return
+	}
 
 	// 解析手部设备ID
-	leftDeviceID, rightDeviceID := getHandDeviceID(ws.config)
-	if isUp {
-		Sequp(ws.config, leftDeviceID, rightDeviceID, leftController, rightController, leftSeq, rightSeq, isUp, isDown, isSks)
-	} else if isDown {
-		Seqdown(ws.config, leftDeviceID, rightDeviceID, leftController, rightController, leftSeq, rightSeq, isUp, isDown, isSks)
+	ws.mutex.RLock()
+	config := ws.config
+	ws.mutex.RUnlock()
+	leftDeviceID, rightDeviceID := getHandDeviceID(config)
+
+	if err := ws.estop.Check(); err != nil {
+		ws.writeRefused(w, err)
+		return
+	}
+	// 姿态检查：UP需要收起，DOWN需要同一乐器的演奏姿态（任务开始时会再检查一次）
+	if err := ws.posture.Check(isUp, isSks); err != nil {
+		ws.writeRefused(w, err)
+		return
+	}
+
+	// 作为任务异步执行左右臂序列，占用两臂和两手的接口
+	interfaces := []string{leftController.Interface, rightController.Interface, config.Hands["left"].Interface, config.Hands["right"].Interface}
+	job, err := ws.jobs.Submit("merged", req.FileName, interfaces, req.Preempt, func(job *Job) error {
+		if isUp {
+			return Sequp(config, ws.transports, leftDeviceID, rightDeviceID, leftController, rightController, leftSeq, rightSeq, isUp, isDown, isSks, ws.posture, job)
+		}
+		return Seqdown(config, ws.transports, leftDeviceID, rightDeviceID, leftController, rightController, leftSeq, rightSeq, isUp, isDown, isSks, ws.posture, job)
+	})
+	if err != nil {
+		ws.writeRefused(w, err)
+		return
 	}
+
 	response := ControlResponse{
 		Success: true,
-		Message: fmt.Sprintf("开始执行合并序列: %s", req.FileName),
+		Message: fmt.Sprintf("开始执行合并序列: %s（任务 %s）", req.FileName, job.ID),
+		Data:    map[string]interface{}{"job": job.Status()},
+	}
+	if violations := append(leftSeq.LimitViolations, rightSeq.LimitViolations...); len(violations) > 0 {
+		response.Data = map[string]interface{}{"job": job.Status(), "limit_violations": violations}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1838,23 +2088,23 @@ func getHandDeviceID(config *Config) (int, int) {
 	return leftDeviceID, rightDeviceID
 }
 
-// executeSequenceFromFile 从文件执行序列（命令行模式）
-func executeSequenceFromFile(jsonFile string, config *Config) error {
+// loadMergedSequence 读取合并序列文件中的左右臂序列，并做步骤和限位检查
+func loadMergedSequence(jsonFile string, config *Config) (*JointSequence, *JointSequence, error) {
 	// 读取JSON文件
 	data, err := ioutil.ReadFile(jsonFile)
 	if err != nil {
-		return fmt.Errorf("读取序列文件失败: %v", err)
+		return nil, nil, fmt.Errorf("读取序列文件失败: %v", err)
 	}
 
 	var fileData struct {
 		JointSequences []JointSequence `json:"joint_sequences"`
 	}
 	if err := json.Unmarshal(data, &fileData); err != nil {
-		return fmt.Errorf("解析序列文件失败: %v", err)
+		return nil, nil, fmt.Errorf("解析序列文件失败: %v", err)
 	}
 
 	if len(fileData.JointSequences) < 2 {
-		return fmt.Errorf("序列文件必须包含左右臂数据")
+		return nil, nil, fmt.Errorf("序列文件必须包含左右臂数据")
 	}
 
 	// 找到左右臂序列
@@ -1869,27 +2119,62 @@ func executeSequenceFromFile(jsonFile string, config *Config) error {
 	}
 
 	if leftSeq == nil || rightSeq == nil {
-		return fmt.Errorf("序列文件中缺少左右臂数据")
+		return nil, nil, fmt.Errorf("序列文件中缺少左右臂数据")
 	}
+	checkSequenceSteps(leftSeq)
+	checkSequenceSteps(rightSeq)
+	flagSequenceLimits(config, leftSeq)
+	flagSequenceLimits(config, rightSeq)
+	return leftSeq, rightSeq, nil
+}
 
+// sideControllers 按配置创建左右臂控制器（命令行模式）
+func sideControllers(config *Config, transports *TransportSet) (*BlackArmController, *BlackArmController, error) {
 	// 找到左右臂的接口
 	var leftInterface, rightInterface string
 	for iface, armConfig := range config.Arms {
-		if strings.Contains(armConfig.DeviceName, "left") {
+		switch armSide(armConfig) {
+		case "left":
 			leftInterface = iface
-		}
-		if strings.Contains(armConfig.DeviceName, "right") {
+		case "right":
 			rightInterface = iface
 		}
 	}
 
 	if leftInterface == "" || rightInterface == "" {
-		return fmt.Errorf("未找到左右臂接口配置")
+		return nil, nil, fmt.Errorf("未找到左右臂接口配置")
 	}
 
 	// 创建左右臂控制器
-	leftController := NewBlackArmController(config.CanBridgeURL, leftInterface, "left_black_arm")
-	rightController := NewBlackArmController(config.CanBridgeURL, rightInterface, "right_black_arm")
+	leftController := NewBlackArmController(transports.For(leftInterface), leftInterface, config.Arms[leftInterface])
+	rightController := NewBlackArmController(transports.For(rightInterface), rightInterface, config.Arms[rightInterface])
+	return leftController, rightController, nil
+}
+
+// armControllers 为配置中的每条手臂创建控制器（按接口名排序），用于命令行模式的关闭策略
+func armControllers(config *Config, transports *TransportSet) []*BlackArmController {
+	ifaces := make([]string, 0, len(config.Arms))
+	for iface := range config.Arms {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+	controllers := make([]*BlackArmController, len(ifaces))
+	for i, iface := range ifaces {
+		controllers[i] = NewBlackArmController(transports.For(iface), iface, config.Arms[iface])
+	}
+	return controllers
+}
+
+// executeSequenceFromFile 从文件执行序列（命令行模式），job 用于收到信号时在安全点取消
+func executeSequenceFromFile(jsonFile string, config *Config, transports *TransportSet, posture *PostureStore, job *Job) error {
+	leftSeq, rightSeq, err := loadMergedSequence(jsonFile, config)
+	if err != nil {
+		return err
+	}
+	leftController, rightController, err := sideControllers(config, transports)
+	if err != nil {
+		return err
+	}
 
 	fileName := strings.ToLower(jsonFile)
 	isUp := strings.Contains(fileName, "up")
@@ -1901,137 +2186,194 @@ func executeSequenceFromFile(jsonFile string, config *Config) error {
 
 	if isUp {
 		// UP序列执行策略
-		Sequp(config, leftDeviceID, rightDeviceID, leftController, rightController, leftSeq, rightSeq, isUp, isDown, isSks)
-
+		err = Sequp(config, transports, leftDeviceID, rightDeviceID, leftController, rightController, leftSeq, rightSeq, isUp, isDown, isSks, posture, job)
 	} else if isDown {
 		// DOWN序列执行策略
-		Seqdown(config, leftDeviceID, rightDeviceID, leftController, rightController, leftSeq, rightSeq, isUp, isDown, isSks)
+		err = Seqdown(config, transports, leftDeviceID, rightDeviceID, leftController, rightController, leftSeq, rightSeq, isUp, isDown, isSks, posture, job)
+	}
+	if err != nil {
+		return err
 	}
 
 	log.Println("序列执行完成")
 	return nil
 }
 
-// Seqdown 执行DOWN序列（一系列流程）
-func Seqdown(config *Config, leftDeviceID int, rightDeviceID int, leftController *BlackArmController, rightController *BlackArmController, leftSeq *JointSequence, rightSeq *JointSequence, isUp bool, isDown bool, isSks bool) {
-	log.Println("执行DOWN序列策略")
+// runSequenceCLI 命令行模式执行序列文件。收到信号时在安全点取消序列并执行关闭策略；
+// 无论成功、失败还是被中断，返回前都写出干运行帧记录并关闭传输
+func runSequenceCLI(jsonFile, traceFile string, config *Config, sigs <-chan os.Signal) (err error) {
+	transports, err := NewTransportSet(config)
+	if err != nil {
+		return fmt.Errorf("创建CAN传输失败: %v", err)
+	}
+	defer func() {
+		if capture := transports.Capture(); capture != nil {
+			if werr := capture.WriteFile(traceFile); werr != nil {
+				log.Printf("保存帧记录失败: %v", werr)
+				if err == nil {
+					err = werr
+				}
+			} else {
+				log.Printf("dry_run: 共记录 %d 帧，已保存到 %s", len(capture.Frames()), traceFile)
+			}
+		}
+		transports.Close()
+	}()
 
-	// 1. 手指执行防撞动作
-	log.Println("发送左右手防撞预动作")
-	sendHandCommandDirect(config.CanBridgeURL, config.Hands["left"].Interface, leftDeviceID, config.HandsLeft)
-	sendHandCommandDirect(config.CanBridgeURL, config.Hands["right"].Interface, rightDeviceID, config.HandsRight)
-	//time.Sleep(500 * time.Millisecond)
-
-	// 2. 速度设为0.8
-	log.Println("设置左右臂速度为0.8")
-	speeds := []float32{0.8, 0.8, 0.8, 0.8, 0.8, 0.8, 0.8}
-	leftController.SetSpeeds(speeds)
-	rightController.SetSpeeds(speeds)
-	time.Sleep(200 * time.Millisecond)
-
-	// 3. 发送关节角度序列（每组之间等待1ms）
-	log.Println("执行关节角度序列")
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go executeSequenceDirect(leftController, leftSeq, &wg)
-
-	wg.Add(1)
-	go executeSequenceDirect(rightController, rightSeq, &wg)
-	wg.Wait()
-	time.Sleep(500 * time.Millisecond) //每组之间等待500毫秒
-	// 4. 失能
-	log.Println("失能左右臂")
-	leftController.DisableMotor()
-	rightController.DisableMotor()
-	//time.Sleep(200 * time.Millisecond)
-
-	// 5. 清除错误
-	log.Println("清除左右臂错误")
-	leftController.CleanError()
-	rightController.CleanError()
+	posture := LoadPostureStore(config.PostureFile)
+	jobs := NewJobManager(NewLeaseManager(nil))
+	job, err := jobs.Submit("merged", jsonFile, nil, false, func(job *Job) error {
+		return executeSequenceFromFile(jsonFile, config, transports, posture, job)
+	})
+	if err != nil {
+		return fmt.Errorf("执行序列失败: %v", err)
+	}
+	select {
+	case <-job.done:
+	case sig := <-sigs:
+		forceOnSignal(sigs, config, transports)
+		log.Printf("🔻 收到 %v，取消序列", sig)
+		job.Cancel()
+		if !job.Wait(preemptWait) {
+			log.Printf("⚠️ 序列在 %v 内未停止", preemptWait)
+		}
+		if err := runShutdownPolicy(config, transports, armControllers(config, transports), posture); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+		return fmt.Errorf("收到 %v，序列已取消", sig)
+	}
+	if status := job.Status(); status.State != JobDone {
+		return fmt.Errorf("执行序列失败: %s", status.Error)
+	}
+	return nil
 }
 
-// Sequp 执行UP序列（一系列流程）
-func Sequp(config *Config, leftDeviceID int, rightDeviceID int, leftController *BlackArmController, rightController *BlackArmController, leftSeq *JointSequence, rightSeq *JointSequence, isUp bool, isDown bool, isSks bool) {
-	// 解析手部设备ID
-
-	log.Println("执行UP序列策略")
-
-	// 1. 左右手分别执行防撞预动作
-	log.Println("发送左右手防撞预动作")
-	sendHandCommandDirect(config.CanBridgeURL, config.Hands["left"].Interface, leftDeviceID, config.HandsLeft)
-	sendHandCommandDirect(config.CanBridgeURL, config.Hands["right"].Interface, rightDeviceID, config.HandsRight)
-	//time.Sleep(200 * time.Millisecond)
-
-	// 2. 清除错误
-	log.Println("清除左右臂错误")
-	leftController.CleanError()
-	rightController.CleanError()
-	//time.Sleep(100 * time.Millisecond)
-
-	// 3. 使能
-	log.Println("使能左右臂")
-	leftController.EnableMotor("全部关节")
-	rightController.EnableMotor("全部关节")
-	//time.Sleep(200 * time.Millisecond)
-
-	// 4. 速度设置为0.8
-	log.Println("设置左右臂速度为0.8")
-	speeds := []float32{0.8, 0.8, 0.8, 0.8, 0.8, 0.8, 0.8}
-	leftController.SetSpeeds(speeds)
-	rightController.SetSpeeds(speeds)
-	time.Sleep(200 * time.Millisecond)
-
-	// 5. 发送关节角度序列（每组之间等待1ms）
-	log.Println("执行关节角度序列")
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go executeSequenceDirect(leftController, leftSeq, &wg)
-	wg.Add(1)
-	go executeSequenceDirect(rightController, rightSeq, &wg)
-
-	wg.Wait()
-	log.Println("✅ 手臂序列执行完成。")
-
-	time.Sleep(1000 * time.Millisecond)
-	// 6. 根据json名字发送release_profile
-	if isSks {
-		log.Println("发送SKS release_profile")
-		sendHandCommandDirect(config.CanBridgeURL, config.Hands["left"].Interface, leftDeviceID, config.SksLeftReleaseProfile)
-		sendHandCommandDirect(config.CanBridgeURL, config.Hands["right"].Interface, rightDeviceID, config.SksRightReleaseProfile)
-	} else {
-		log.Println("发送SN release_profile")
-		sendHandCommandDirect(config.CanBridgeURL, config.Hands["left"].Interface, leftDeviceID, config.SnLeftReleaseProfile)
-		sendHandCommandDirect(config.CanBridgeURL, config.Hands["right"].Interface, rightDeviceID, config.SnRightReleaseProfile)
+// Seqdown 执行DOWN序列（步骤列表见 downSteps）。job 不为 nil 时每个步骤之前是安全点。
+// 需要姿态为同一乐器的演奏姿态，完成后为 stowed，失败或取消后为 fault；
+// 步骤失败时返回 *SequenceError，报告写入任务状态
+func Seqdown(config *Config, transports *TransportSet, leftDeviceID int, rightDeviceID int, leftController *BlackArmController, rightController *BlackArmController, leftSeq *JointSequence, rightSeq *JointSequence, isUp bool, isDown bool, isSks bool, posture *PostureStore, job *Job) (err error) {
+	log.Println("执行DOWN序列策略")
+	if err := posture.Begin(false, isSks); err != nil {
+		return err
 	}
+	defer func() { posture.Finish(false, isSks, err) }()
+
+	hold := func() error { return bothArms(leftController, rightController, holdArm) }
+	steps := []SequenceStep{
+		// 1. 手指执行防撞动作
+		{Name: "手部防撞预动作", OnError: stepRetry, Retries: 2, Run: func() error {
+			log.Println("发送左右手防撞预动作")
+			return bothHands(config, transports, leftController.Latch, leftDeviceID, rightDeviceID, config.HandsLeft, config.HandsRight)
+		}},
+		// 2. 速度设为默认速度（角度组可用 speed 逐关节覆盖）
+		{Name: "设置速度", OnError: stepRetry, Retries: 2, RecoverName: "两臂停在当前位置", Recover: hold, Run: func() error {
+			log.Printf("设置左右臂速度为%.1f", defaultSequenceSpeed)
+			if err := bothArms(leftController, rightController, defaultSpeedArm); err != nil {
+				return err
+			}
+			return job.Sleep(200 * time.Millisecond)
+		}},
+		// 3. 发送关节角度序列（每组按 duration_ms/dwell_ms 计时），一臂失败时两臂都停在当前位置，不失能
+		{Name: "关节角度序列", OnError: stepAbort, RecoverName: "两臂停在当前位置", Recover: hold, Run: func() error {
+			log.Println("执行关节角度序列")
+			if err := playArms(leftController, rightController, leftSeq, rightSeq, config.Trajectory, job); err != nil {
+				return err
+			}
+			return job.Sleep(500 * time.Millisecond)
+		}},
+		// 4. 失能
+		{Name: "失能", OnError: stepRetry, Retries: 2, Run: func() error {
+			log.Println("失能左右臂")
+			return bothArms(leftController, rightController, disableArm)
+		}},
+		// 5. 清除错误（手臂已收起失能，失败不影响结果，下次UP序列会再清除）
+		{Name: "清除错误", OnError: stepContinue, Run: func() error {
+			log.Println("清除左右臂错误")
+			return bothArms(leftController, rightController, cleanArm)
+		}},
+	}
+	return runSteps(job, leftController.Latch, "DOWN", steps)
 }
 
-// executeSequenceDirect 直接执行序列（不使用goroutine）
-func executeSequenceDirect(controller *BlackArmController, sequence *JointSequence, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for i, angleSet := range sequence.Angles {
-		log.Printf("执行第 %d 组角度: %s", i+1, angleSet.Name)
-
-		// 设置每个关节的角度
-		for motorIDStr, angle := range angleSet.Values {
-			motorID, err := strconv.Atoi(motorIDStr)
-			if err != nil {
-				log.Printf("无效的电机ID: %s", motorIDStr)
-				continue
+// Sequp 执行UP序列（步骤列表见下）。job 不为 nil 时每个步骤之前是安全点。
+// 需要姿态为 stowed，完成后为对应乐器的演奏姿态，失败或取消后为 fault；
+// 步骤失败时返回 *SequenceError，报告写入任务状态
+func Sequp(config *Config, transports *TransportSet, leftDeviceID int, rightDeviceID int, leftController *BlackArmController, rightController *BlackArmController, leftSeq *JointSequence, rightSeq *JointSequence, isUp bool, isDown bool, isSks bool, posture *PostureStore, job *Job) (err error) {
+	log.Println("执行UP序列策略")
+	if err := posture.Begin(true, isSks); err != nil {
+		return err
+	}
+	defer func() { posture.Finish(true, isSks, err) }()
+
+	// 手臂还在收起位置时失败：两臂都失能，避免只有一臂使能
+	disable := func() error { return bothArms(leftController, rightController, disableArm) }
+	// 手臂在运动中失败：两臂停在当前位置，不失能（避免在半空下落）
+	hold := func() error { return bothArms(leftController, rightController, holdArm) }
+	steps := []SequenceStep{
+		// 1. 左右手分别执行防撞预动作
+		{Name: "手部防撞预动作", OnError: stepRetry, Retries: 2, Run: func() error {
+			log.Println("发送左右手防撞预动作")
+			return bothHands(config, transports, leftController.Latch, leftDeviceID, rightDeviceID, config.HandsLeft, config.HandsRight)
+		}},
+		// 2. 清除错误
+		{Name: "清除错误", OnError: stepRetry, Retries: 2, Run: func() error {
+			log.Println("清除左右臂错误")
+			return bothArms(leftController, rightController, cleanArm)
+		}},
+		// 3. 使能
+		{Name: "使能", OnError: stepRetry, Retries: 1, RecoverName: "两臂失能", Recover: disable, Run: func() error {
+			log.Println("使能左右臂")
+			return bothArms(leftController, rightController, enableArm)
+		}},
+		// 4. 速度设置为默认速度（角度组可用 speed 逐关节覆盖）
+		{Name: "设置速度", OnError: stepRetry, Retries: 2, RecoverName: "两臂失能", Recover: disable, Run: func() error {
+			log.Printf("设置左右臂速度为%.1f", defaultSequenceSpeed)
+			if err := bothArms(leftController, rightController, defaultSpeedArm); err != nil {
+				return err
 			}
-
-			err = controller.SetAngle(motorID, angle)
-			if err != nil {
-				log.Printf("设置电机 %d 角度失败: %v", motorID, err)
+			return job.Sleep(200 * time.Millisecond)
+		}},
+		// 5. 发送关节角度序列（每组按 duration_ms/dwell_ms 计时），一臂失败时两臂都停在当前位置
+		{Name: "关节角度序列", OnError: stepAbort, RecoverName: "两臂停在当前位置", Recover: hold, Run: func() error {
+			log.Println("执行关节角度序列")
+			if err := playArms(leftController, rightController, leftSeq, rightSeq, config.Trajectory, job); err != nil {
+				return err
+			}
+			log.Println("✅ 手臂序列执行完成。")
+			return job.Sleep(1000 * time.Millisecond)
+		}},
+		// 6. 根据json名字发送release_profile
+		{Name: "手部松开", OnError: stepRetry, Retries: 2, Run: func() error {
+			if isSks {
+				log.Println("发送SKS release_profile")
+				return bothHands(config, transports, leftController.Latch, leftDeviceID, rightDeviceID, config.SksLeftReleaseProfile, config.SksRightReleaseProfile)
 			}
+			log.Println("发送SN release_profile")
+			return bothHands(config, transports, leftController.Latch, leftDeviceID, rightDeviceID, config.SnLeftReleaseProfile, config.SnRightReleaseProfile)
+		}},
+	}
+	return runSteps(job, leftController.Latch, "UP", steps)
+}
+
+// angleSetTargets 把角度组的 motor_id 字符串键解析为电机ID，跳过无效键
+func angleSetTargets(angleSet JointAngleSet) map[int]float32 {
+	targets := make(map[int]float32, len(angleSet.Values))
+	for motorIDStr, angle := range angleSet.Values {
+		motorID, err := strconv.Atoi(motorIDStr)
+		if err != nil {
+			log.Printf("无效的电机ID: %s", motorIDStr)
+			continue
 		}
-		time.Sleep(1000 * time.Millisecond) //每组之间等待1000毫秒
+		targets[motorID] = angle
 	}
+	return targets
 }
 
-// sendHandCommandDirect 直接发送手部命令
-func sendHandCommandDirect(canBridgeURL, interfaceName string, deviceID int, values []int) error {
+// sendHandCommandDirect 直接发送手部命令，急停锁定时拒绝（急停本身发送的安全姿态 latch 传 nil）
+func sendHandCommandDirect(transports *TransportSet, latch *EStopLatch, interfaceName string, deviceID int, values []int) error {
+	if err := latch.Check(); err != nil {
+		return err
+	}
 	if len(values) < 6 {
 		return fmt.Errorf("手部数据长度不足")
 	}
@@ -2053,26 +2395,15 @@ func sendHandCommandDirect(canBridgeURL, interfaceName string, deviceID int, val
 	data = append(data, byte(hand.Ring))
 	data = append(data, byte(hand.Pinky))
 
-	canMessage := map[string]interface{}{
-		"interface": interfaceName,
-		"id":        uint32(deviceID),
-		"data":      data,
+	canMessage := CANMessage{
+		Interface: interfaceName,
+		ID:        uint32(deviceID),
+		Data:      data,
 	}
 
-	jsonData, err := json.Marshal(canMessage)
-	if err != nil {
-		return fmt.Errorf("序列化CAN消息失败: %v", err)
-	}
-
-	resp, err := http.Post(canBridgeURL+"/api/can", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
+	if err := transports.Send(canMessage); err != nil {
 		return fmt.Errorf("发送CAN消息失败: %v", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("CAN消息发送失败，状态码: %d", resp.StatusCode)
-	}
 
 	return nil
 }
@@ -2080,35 +2411,173 @@ func sendHandCommandDirect(canBridgeURL, interfaceName string, deviceID int, val
 func main() {
 	// 解析命令行参数
 	jsonFile := flag.String("json", "", "要执行的JSON序列文件")
+	simulate := flag.Bool("simulate", false, "启动内置CAN桥接模拟器，使用虚拟电机和虚拟手")
+	dryRun := flag.Bool("dry-run", false, "只记录将要发送的CAN帧，不访问总线（覆盖配置中的dry_run）")
+	traceFile := flag.String("trace", "dryrun_trace.json", "命令行干运行模式下帧记录的保存路径")
+	replayFile := flag.String("replay", "", "按原始时间回放candump -l格式的CAN日志")
+	replayIface := flag.String("replay-iface", "", "回放时只发送该接口的帧")
+	replayID := flag.String("replay-id", "", "回放时只发送该ID的帧（十六进制）")
+	replayRX := flag.Bool("replay-rx", false, "回放时包含接收方向(R)的帧")
+	replaySpeed := flag.Float64("replay-speed", 1, "回放速度倍率")
+	scan := flag.Bool("scan", false, "扫描各手臂接口上的电机ID(1-127)后退出")
+	scanWrite := flag.Bool("scan-write", false, "与 -scan 一起使用，把扫描结果写回 config.yaml 的 arms.motor_ids/arm_type")
+	scanConfirm := flag.Bool("scan-confirm", false, "与 -scan-write 一起使用，扫描结果与当前配置不一致时仍然写回")
+	estop := flag.Bool("estop", false, "急停：向所有电机发送停止帧、手部置于安全姿态，并通知运行中的Web服务器锁定")
+	estopReason := flag.String("estop-reason", "命令行急停", "与 -estop 一起使用，急停原因")
+	estopServer := flag.String("estop-server", "http://localhost:8080", "与 -estop/-replay 一起使用，运行中的Web服务器地址（急停时通知其锁定；服务器运行时拒绝回放）")
 	flag.Parse()
 
 	// 加载配置
-	configData, err := ioutil.ReadFile("config.yaml")
+	config, err := loadConfig("config.yaml")
 	if err != nil {
-		log.Fatal("读取配置文件失败:", err)
+		log.Fatal(err)
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(configData, &config); err != nil {
-		log.Fatal("解析配置文件失败:", err)
+	if *simulate {
+		config.Simulate = true
+	}
+	if *dryRun {
+		config.DryRun = true
+	}
+	if config.Simulate && !config.DryRun {
+		sim := NewCANSimulator(config)
+		if err := sim.Start(simulatorAddr(config.CanBridgeURL)); err != nil {
+			log.Fatal(err)
+		}
 	}
 
+	// 急停：先直接发送停止帧，再通知Web服务器锁定并取消任务
+	if *estop {
+		transports, err := NewTransportSet(config)
+		if err != nil {
+			log.Fatal("创建CAN传输失败:", err)
+		}
+		defer transports.Close()
+		report := sendEStopFrames(config, transports)
+		for iface, motorIDs := range report.Stopped {
+			fmt.Printf("🛑 %s: 已停止电机 %v\n", iface, motorIDs)
+		}
+		for _, iface := range report.Hands {
+			fmt.Printf("🛑 %s: 手部已置于安全姿态\n", iface)
+		}
+		for iface, e := range report.Errors {
+			fmt.Printf("❌ %s: %s\n", iface, e)
+		}
+		if status, err := requestRemoteEStop(*estopServer, *estopReason); err != nil {
+			fmt.Printf("未能通知Web服务器 %s 锁定: %v\n", *estopServer, err)
+		} else if status != nil && status.Latched {
+			fmt.Printf("Web服务器已锁定急停（%s），解除: POST %s/api/estop/reset\n", status.Reason, *estopServer)
+		}
+		if len(report.Errors) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 回放CAN日志
+	if *replayFile != "" {
+		opts := ReplayOptions{Interface: *replayIface, ID: -1, IncludeRX: *replayRX, SpeedScale: *replaySpeed}
+		if *replayID != "" {
+			id, err := strconv.ParseUint(strings.TrimPrefix(*replayID, "0x"), 16, 32)
+			if err != nil {
+				log.Fatal("无效的回放ID:", *replayID)
+			}
+			opts.ID = int64(id)
+		}
+		// 回放不经过服务器的占用和急停：服务器运行时拒绝回放（干运行不发到总线，不受限制）
+		if !config.DryRun && replayServerRunning(*estopServer) {
+			log.Fatalf("Web服务器 %s 正在运行，回放会与其任务、点动和单条指令同时向总线发帧；请先停止服务器，或加 -dry-run 只查看", *estopServer)
+		}
+		// 回放本身不再写入帧日志，避免日志自我复制
+		config.CanLog.Enabled = false
+		transports, err := NewTransportSet(config)
+		if err != nil {
+			log.Fatal("创建CAN传输失败:", err)
+		}
+		defer transports.Close()
+
+		// 回放中途服务器启动时停止回放
+		opts.Latch = &EStopLatch{}
+		stop := make(chan struct{})
+		if !config.DryRun {
+			guardReplay(*estopServer, opts.Latch, 200*time.Millisecond, stop)
+		}
+		err = ReplayCANLog(*replayFile, transports, opts)
+		close(stop)
+		if err != nil {
+			transports.Close()
+			log.Fatal("回放失败:", err)
+		}
+		return
+	}
+
+	// 扫描电机ID
+	if *scan {
+		transports, err := NewTransportSet(config)
+		if err != nil {
+			log.Fatal("创建CAN传输失败:", err)
+		}
+		defer transports.Close()
+
+		var interfaces []string
+		configured := make(map[string][]int)
+		sides := make(map[string]string)
+		for iface, arm := range config.Arms {
+			interfaces = append(interfaces, iface)
+			configured[iface] = armMotorIDs(arm)
+			sides[iface] = armSide(arm)
+		}
+		results := ScanArms(transports, interfaces, configured, sides)
+		for _, r := range results {
+			switch {
+			case r.Error != "":
+				fmt.Printf("%s: 扫描失败: %s\n", r.Interface, r.Error)
+			case r.Matches:
+				fmt.Printf("%s: 电机 %v (%s臂, %d自由度)，与当前配置一致\n", r.Interface, r.MotorIDs, r.Side, r.DoF)
+			default:
+				fmt.Printf("%s: 电机 %v (%s臂, %d自由度)，当前使用 %v\n", r.Interface, r.MotorIDs, r.Side, r.DoF, r.Configured)
+			}
+		}
+		if *scanWrite {
+			if err := writeArmMotorIDs("config.yaml", results, *scanConfirm); err != nil {
+				transports.Close()
+				log.Fatal(err)
+			}
+			log.Printf("扫描结果已写回 config.yaml")
+		}
+		return
+	}
+
+	// 收到 SIGINT/SIGTERM 时安全关闭，关闭过程中再次收到则急停退出
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
 	// 如果指定了JSON文件，执行序列
 	if *jsonFile != "" {
 		log.Printf("命令行模式: 执行序列文件 %s", *jsonFile)
-		if err := executeSequenceFromFile(*jsonFile, &config); err != nil {
-			log.Fatal("执行序列失败:", err)
+		if err := runSequenceCLI(*jsonFile, *traceFile, config, sigs); err != nil {
+			log.Fatal(err)
 		}
 		return
 	}
 
 	// 否则启动Web服务器
-	server, err := NewWebServer("config.yaml")
+	server, err := NewWebServer(config)
 	if err != nil {
 		log.Fatal("创建Web服务器失败:", err)
 	}
 
 	// 启动服务器
-	log.Fatal(server.Start(8080))
+	errc := make(chan error, 1)
+	go func() { errc <- server.Start(8080) }()
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case sig := <-sigs:
+		forceOnSignal(sigs, config, server.transports)
+		server.Shutdown(fmt.Sprintf("收到 %v", sig))
+		<-errc
+		server.transports.Close()
+	}
 
 }
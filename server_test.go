@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestCheckArmSides(t *testing.T) {
+	tests := []struct {
+		name    string
+		arms    map[string]ArmConfig
+		wantErr bool
+	}{
+		{"左右各一", map[string]ArmConfig{"can2": {ArmType: "left"}, "can3": {ArmType: "right"}}, false},
+		{"只有一条手臂", map[string]ArmConfig{"can2": {ArmType: "left"}}, false},
+		{"左右未知的手臂不计", map[string]ArmConfig{"can2": {ArmType: "left"}, "can4": {DeviceName: "arm"}, "can5": {DeviceName: "arm2"}}, false},
+		{"两条左臂", map[string]ArmConfig{"can2": {ArmType: "left"}, "can3": {ArmType: "left"}}, true},
+		{"按电机ID推断出两条右臂", map[string]ArmConfig{"can2": {MotorIDs: []int{51, 52}}, "can3": {ArmType: "right"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkArmSides(tt.arms); (err != nil) != tt.wantErr {
+				t.Errorf("checkArmSides() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 关闭策略：收到 SIGINT/SIGTERM 并取消任务后如何处理双臂
+const (
+	shutdownHold    = "hold"    // 以实测位置为目标停在当前位置
+	shutdownDown    = "down"    // 按当前演奏姿态执行对应的DOWN序列，无法执行时改为 hold
+	shutdownDisable = "disable" // 失能并清除错误
+)
+
+// defaultDrainTimeout 等待进行中的指令和HTTP请求完成的默认时间
+const defaultDrainTimeout = 5 * time.Second
+
+// ShutdownConfig 收到 SIGINT/SIGTERM 后的处理
+type ShutdownConfig struct {
+	Policy         string            `yaml:"policy"`           // hold（默认）/ down / disable
+	DrainTimeoutMs int               `yaml:"drain_timeout_ms"` // 等待进行中的请求，默认5000
+	DownSequences  map[string]string `yaml:"down_sequences"`   // 演奏姿态 -> DOWN序列文件，如 playing-sn: sndown.json
+}
+
+// policy 配置的关闭策略，未配置或无效时为 hold
+func (c ShutdownConfig) policy() string {
+	switch c.Policy {
+	case "", shutdownHold:
+		return shutdownHold
+	case shutdownDown, shutdownDisable:
+		return c.Policy
+	}
+	log.Printf("⚠️ 无效的关闭策略 %q（可选 hold/down/disable），使用 hold", c.Policy)
+	return shutdownHold
+}
+
+// drainTimeout 等待进行中的请求的时间
+func (c ShutdownConfig) drainTimeout() time.Duration {
+	if c.DrainTimeoutMs > 0 {
+		return time.Duration(c.DrainTimeoutMs) * time.Millisecond
+	}
+	return defaultDrainTimeout
+}
+
+// runShutdownPolicy 任务取消后按 shutdown.policy 处理所有手臂。
+// down 只在姿态为演奏姿态且配置了对应DOWN序列时对左右臂执行，否则或执行失败时改为 hold；
+// hold/disable 作用于每条手臂（包括左右未知的）
+func runShutdownPolicy(config *Config, transports *TransportSet, controllers []*BlackArmController, posture *PostureStore) error {
+	policy := config.Shutdown.policy()
+	log.Printf("关闭策略: %s", policy)
+	if policy == shutdownDown {
+		err := runShutdownDown(config, transports, sideController(controllers, "left"), sideController(controllers, "right"), posture)
+		if err == nil {
+			return nil
+		}
+		log.Printf("⚠️ 关闭时未完成DOWN序列: %v，改为 hold", err)
+		policy = shutdownHold
+	}
+
+	var failed []string
+	for _, controller := range controllers {
+		var err error
+		if policy == shutdownDisable {
+			if err = controller.DisableMotor(); err == nil {
+				err = controller.CleanError()
+			}
+		} else {
+			err = controller.Hold()
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", controller.Interface, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("关闭策略 %s 失败: %s", policy, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// sideController 按左右查找控制器，没有时返回nil
+func sideController(controllers []*BlackArmController, side string) *BlackArmController {
+	for _, controller := range controllers {
+		if controller.Side == side {
+			return controller
+		}
+	}
+	return nil
+}
+
+// runShutdownDown 按当前演奏姿态执行 shutdown.down_sequences 中的DOWN序列
+func runShutdownDown(config *Config, transports *TransportSet, left, right *BlackArmController, posture *PostureStore) error {
+	if left == nil || right == nil {
+		return fmt.Errorf("未找到左右臂控制器")
+	}
+	state := posture.Get().State
+	if state != PosturePlayingSKS && state != PosturePlayingSN {
+		return fmt.Errorf("当前姿态为 %s，不执行DOWN序列", state)
+	}
+	file := config.Shutdown.DownSequences[string(state)]
+	if file == "" {
+		return fmt.Errorf("shutdown.down_sequences 未配置 %s 的DOWN序列", state)
+	}
+	leftSeq, rightSeq, err := loadMergedSequence(file, config)
+	if err != nil {
+		return err
+	}
+	log.Printf("关闭时执行DOWN序列: %s", file)
+	leftDeviceID, rightDeviceID := getHandDeviceID(config)
+	return Seqdown(config, transports, leftDeviceID, rightDeviceID, left, right, leftSeq, rightSeq, false, true, state == PosturePlayingSKS, posture, nil)
+}
+
+// forceOnSignal 关闭过程中再次收到信号时发送急停帧并立即退出
+func forceOnSignal(sigs <-chan os.Signal, config *Config, transports *TransportSet) {
+	go func() {
+		sig := <-sigs
+		log.Printf("🛑 关闭过程中再次收到 %v，急停并立即退出", sig)
+		sendEStopFrames(config, transports)
+		os.Exit(1)
+	}()
+}
+
+// waitTimeout 等待 WaitGroup，超时返回 false
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// withShutdownGate 关闭开始后拒绝新的API指令（GET查询仍可用），并记录进行中的指令以便等待其完成。
+// 急停不受限制：关闭策略（如DOWN序列）执行期间操作员仍可急停，急停也不计入等待的指令
+func (ws *WebServer) withShutdownGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.Method == "GET" || isEStopPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ws.shutdownMu.Lock()
+		if ws.closing {
+			ws.shutdownMu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(ControlResponse{Success: false, Message: "服务器正在关闭，不再接受指令"})
+			return
+		}
+		ws.commands.Add(1)
+		ws.shutdownMu.Unlock()
+		defer ws.commands.Done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isEStopPath /api/estop 和 /api/estop/reset
+func isEStopPath(path string) bool {
+	return path == "/api/estop" || strings.HasPrefix(path, "/api/estop/")
+}
+
+// Shutdown 安全关闭：拒绝新指令，取消所有任务并结束点动会话，等待进行中的指令和任务停止，
+// 按关闭策略处理双臂（急停锁定时不再运动），最后等待HTTP请求完成并关闭服务器
+func (ws *WebServer) Shutdown(reason string) {
+	log.Printf("🔻 开始关闭（%s），不再接受指令", reason)
+	ws.shutdownMu.Lock()
+	ws.closing = true
+	httpServer := ws.httpServer
+	ws.shutdownMu.Unlock()
+
+	ws.mutex.RLock()
+	config := ws.config
+	ifaces := make([]string, 0, len(ws.controllers))
+	for iface := range ws.controllers {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+	controllers := make([]*BlackArmController, len(ifaces))
+	for i, iface := range ifaces {
+		controllers[i] = ws.controllers[iface]
+	}
+	ws.mutex.RUnlock()
+	drain := config.Shutdown.drainTimeout()
+
+	cancelled := ws.jobs.CancelAll()
+	ws.closeAllJogs("服务器关闭")
+	for _, id := range cancelled {
+		if job := ws.jobs.Get(id); job != nil && !job.Wait(preemptWait) {
+			log.Printf("⚠️ 任务 %s 在 %v 内未停止", id, preemptWait)
+		}
+	}
+	if !waitTimeout(&ws.commands, drain) {
+		log.Printf("⚠️ 仍有指令在 %v 内未完成", drain)
+	}
+
+	if err := ws.estop.Check(); err != nil {
+		log.Printf("急停已锁定，不执行关闭策略")
+	} else if err := runShutdownPolicy(config, ws.transports, controllers, ws.posture); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+
+	if httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), drain)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Printf("⚠️ 等待HTTP请求完成失败: %v", err)
+		}
+	}
+	log.Printf("🔻 已关闭")
+}
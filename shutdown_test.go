@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunShutdownPolicyActsOnEveryArm(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   int // 每条手臂应下发的帧数（每个电机）
+	}{
+		{shutdownDisable, 2}, // 失能 + 清除错误
+		{shutdownDown, 1},    // 姿态为 stowed，改为 hold：读取位置（干运行没有反馈，不下发角度）
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			capture := NewCaptureTransport()
+			config := &Config{Shutdown: ShutdownConfig{Policy: tt.policy}}
+			controllers := []*BlackArmController{
+				NewBlackArmController(capture, "can2", ArmConfig{ArmType: "left", MotorIDs: []int{61}}),
+				NewBlackArmController(capture, "can3", ArmConfig{ArmType: "right", MotorIDs: []int{51}}),
+				NewBlackArmController(capture, "can4", ArmConfig{DeviceName: "arm", MotorIDs: []int{11}}),
+			}
+			posture := &PostureStore{path: t.TempDir() + "/posture.json", state: PostureState{State: PostureStowed}}
+
+			if err := runShutdownPolicy(config, nil, controllers, posture); err != nil {
+				t.Fatal(err)
+			}
+			counts := make(map[string]int)
+			for _, f := range capture.Frames() {
+				counts[f.Interface]++
+			}
+			for _, c := range controllers {
+				if counts[c.Interface] != tt.want {
+					t.Errorf("%s 下发 %d 帧，want %d", c.Interface, counts[c.Interface], tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestShutdownGateAllowsEStop(t *testing.T) {
+	transports, err := NewTransportSet(&Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leases := NewLeaseManager(nil)
+	ws := &WebServer{
+		config:     &Config{},
+		transports: transports,
+		leases:     leases,
+		jobs:       NewJobManager(leases),
+		estop:      &EStopLatch{},
+		jogs:       make(map[string]*JogSession),
+		closing:    true,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/estop", ws.estopHandler)
+	mux.HandleFunc("/api/arm/", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("关闭期间不应执行运动指令")
+	})
+	handler := ws.withShutdownGate(mux)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/arm/can2/enable", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("关闭期间运动指令状态码 = %d, want 503", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/estop", strings.NewReader(`{"reason":"关闭时急停"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("关闭期间急停状态码 = %d, want 200", rec.Code)
+	}
+	if err := ws.estop.Check(); err == nil {
+		t.Error("关闭期间急停后 latch 未锁定")
+	}
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 模拟器参数
+const (
+	simTickInterval  = 10 * time.Millisecond
+	simFeedbackTicks = 5    // 每5个周期(50ms)主动上报一次反馈帧
+	simBufferSize    = 32   // 每个ID保留的最近帧数
+	simTimeConstant  = 0.15 // 一阶响应时间常数(秒)
+	simDefaultSpeed  = 1.0  // 未设置0x7024时的默认速度(rad/s)
+	simIdleTempC     = 30.0 // 空闲温度
+	simRunMode       = 0x02 // 反馈帧模式位：运行
+	simRunModePP     = 1    // 0x7005 运行模式：PP
+	simHandFrameCode = 0x01
+)
+
+// simKey 虚拟设备键
+type simKey struct {
+	iface string
+	id    uint32
+}
+
+// simMotor 虚拟电机
+type simMotor struct {
+	ID       int                `json:"id"`
+	Enabled  bool               `json:"enabled"`
+	Position float64            `json:"position"`
+	Velocity float64            `json:"velocity"`
+	Target   float64            `json:"target"`
+	Faults   uint8              `json:"faults"` // 反馈帧故障位，清除错误后归零
+	Params   map[uint16]float32 `json:"-"`
+}
+
+// speed 当前PP速度上限
+func (m *simMotor) speed() float64 {
+	if v, ok := m.Params[idxSpeedLimitPP]; ok && v > 0 {
+		return float64(v)
+	}
+	return simDefaultSpeed
+}
+
+// simHand 虚拟灵巧手
+type simHand struct {
+	ID      uint32    `json:"id"`
+	Fingers []int     `json:"fingers"`
+	Updated time.Time `json:"updated"`
+}
+
+// simFrame 桥接缓存中的一帧
+type simFrame struct {
+	ID        uint32   `json:"id"`
+	HexData   []string `json:"hex_data"`
+	Timestamp float64  `json:"timestamp"`
+}
+
+// CANSimulator 模拟CAN桥接服务器，接口契约与 localhost:5260 一致，背后是虚拟电机和虚拟手
+type CANSimulator struct {
+	mu      sync.Mutex
+	motors  map[simKey]*simMotor
+	hands   map[simKey]*simHand
+	buffers map[simKey][]simFrame
+	totals  map[simKey]uint64                     // 每个ID累计发出的帧数
+	streams map[string]map[chan simFrame]struct{} // 接口 -> SSE连接
+}
+
+// NewCANSimulator 按配置中的手臂/手部创建虚拟设备
+func NewCANSimulator(config *Config) *CANSimulator {
+	sim := &CANSimulator{
+		motors:  make(map[simKey]*simMotor),
+		hands:   make(map[simKey]*simHand),
+		buffers: make(map[simKey][]simFrame),
+		totals:  make(map[simKey]uint64),
+		streams: make(map[string]map[chan simFrame]struct{}),
+	}
+
+	for iface, arm := range config.Arms {
+		for _, id := range armMotorIDs(arm) {
+			sim.motors[simKey{iface, uint32(id)}] = &simMotor{
+				ID: id,
+				Params: map[uint16]float32{
+					idxRunMode: simRunModePP,
+					idxLocKp:   30,
+					idxSpdKp:   2,
+					idxSpdKi:   0.021,
+				},
+			}
+		}
+	}
+	for _, hand := range config.Hands {
+		id, err := strconv.ParseUint(strings.TrimPrefix(hand.ID, "0x"), 16, 32)
+		if err != nil {
+			continue
+		}
+		sim.hands[simKey{hand.Interface, uint32(id)}] = &simHand{ID: uint32(id)}
+	}
+
+	log.Printf("模拟器: %d 个虚拟电机, %d 只虚拟手", len(sim.motors), len(sim.hands))
+	return sim
+}
+
+// simulatorAddr 从桥接URL推导模拟器监听地址。只取端口，始终监听本机回环地址，
+// 不对外暴露虚拟设备
+func simulatorAddr(bridgeURL string) string {
+	if bridgeURL == "" {
+		bridgeURL = defaultCanBridgeURL
+	}
+	u, err := url.Parse(bridgeURL)
+	if err != nil || u.Port() == "" {
+		return "127.0.0.1:5260"
+	}
+	return "127.0.0.1:" + u.Port()
+}
+
+// simulatorURL 模拟模式下所有接口使用的桥接URL：本机模拟器，忽略配置中的主机，
+// 避免 -simulate 时把帧发到配置里的真实桥接
+func simulatorURL(bridgeURL string) string {
+	return "http://" + simulatorAddr(bridgeURL)
+}
+
+// Start 在指定地址启动模拟桥接服务，返回时已开始监听
+func (s *CANSimulator) Start(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/can", s.canHandler)
+	mux.HandleFunc("/api/can/batch", s.canBatchHandler)
+	mux.HandleFunc("/api/capabilities", s.capabilitiesHandler)
+	mux.HandleFunc("/api/messages/", s.messagesHandler)
+	mux.HandleFunc("/api/stream/", s.streamHandler)
+	mux.HandleFunc("/api/sim/state", s.stateHandler)
+	mux.HandleFunc("/api/sim/fault", s.faultHandler)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("模拟器监听 %s 失败: %v", addr, err)
+	}
+
+	go s.run()
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Printf("模拟器服务退出: %v", err)
+		}
+	}()
+
+	log.Printf("🧪 CAN桥接模拟器启动在 %s", addr)
+	return nil
+}
+
+// run 按固定周期推进电机一阶响应，并周期性上报反馈帧
+func (s *CANSimulator) run() {
+	ticker := time.NewTicker(simTickInterval)
+	defer ticker.Stop()
+	dt := simTickInterval.Seconds()
+
+	for tick := 1; ; tick++ {
+		<-ticker.C
+		report := tick%simFeedbackTicks == 0
+		s.mu.Lock()
+		for key, m := range s.motors {
+			if report {
+				s.emitFeedback(key.iface, m)
+			}
+			if !m.Enabled {
+				m.Velocity = 0
+				continue
+			}
+			v := (m.Target - m.Position) / simTimeConstant
+			limit := m.speed()
+			if v > limit {
+				v = limit
+			} else if v < -limit {
+				v = -limit
+			}
+			m.Velocity = v
+			m.Position += v * dt
+		}
+		s.mu.Unlock()
+	}
+}
+
+// canHandler 处理 POST /api/can
+func (s *CANSimulator) canHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "只支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var msg CANMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "解析请求失败", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Deliver(msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp CANResponse
+	resp.Status = "success"
+	resp.Data.Count = 1
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// canBatchHandler 处理 POST /api/can/batch
+func (s *CANSimulator) canBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "只支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "解析请求失败", http.StatusBadRequest)
+		return
+	}
+
+	var resp batchResponse
+	for i, msg := range req.Frames {
+		if err := s.Deliver(msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ts := float64(time.Now().UnixNano()) / 1e9
+		if i == 0 {
+			resp.Data.FirstTS = ts
+		}
+		resp.Data.LastTS = ts
+	}
+	resp.Status = "success"
+	resp.Data.Count = len(req.Frames)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// capabilitiesHandler 处理 GET /api/capabilities
+func (s *CANSimulator) capabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"data":   bridgeCapabilities{Batch: true, Stream: true},
+	})
+}
+
+// messagesHandler 处理 GET /api/messages/{iface}?id=
+func (s *CANSimulator) messagesHandler(w http.ResponseWriter, r *http.Request) {
+	iface := strings.TrimPrefix(r.URL.Path, "/api/messages/")
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if iface == "" || err != nil {
+		http.Error(w, "缺少interface或id参数", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	frames := append([]simFrame(nil), s.buffers[simKey{iface, uint32(id)}]...)
+	total := s.totals[simKey{iface, uint32(id)}]
+	s.mu.Unlock()
+
+	resp := map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"messages": frames,
+			"count":    len(frames),
+			"total":    total,
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// streamHandler 处理 GET /api/stream/{iface}，以SSE推送接口上设备发出的每一帧
+func (s *CANSimulator) streamHandler(w http.ResponseWriter, r *http.Request) {
+	iface := strings.TrimPrefix(r.URL.Path, "/api/stream/")
+	flusher, ok := w.(http.Flusher)
+	if iface == "" || !ok {
+		http.Error(w, "缺少interface参数", http.StatusBadRequest)
+		return
+	}
+
+	ch := make(chan simFrame, 256)
+	s.mu.Lock()
+	if s.streams[iface] == nil {
+		s.streams[iface] = make(map[chan simFrame]struct{})
+	}
+	s.streams[iface][ch] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams[iface], ch)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case f := <-ch:
+			data, _ := json.Marshal(f)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+// faultHandler 处理 POST /api/sim/fault {"interface":"can2","motor_id":62,"bits":4}，给虚拟电机注入故障位
+func (s *CANSimulator) faultHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "只支持POST方法", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Interface string `json:"interface"`
+		MotorID   int    `json:"motor_id"`
+		Bits      uint8  `json:"bits"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "解析请求失败", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	m, ok := s.motors[simKey{req.Interface, uint32(req.MotorID)}]
+	if ok {
+		m.Faults = req.Bits
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "没有该虚拟电机", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "faults": decodeFaults(req.Bits)})
+}
+
+// stateHandler 返回虚拟设备状态，便于排查
+func (s *CANSimulator) stateHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	motors := make(map[string][]simMotor)
+	for k, m := range s.motors {
+		motors[k.iface] = append(motors[k.iface], *m)
+	}
+	hands := make(map[string][]simHand)
+	for k, h := range s.hands {
+		hands[k.iface] = append(hands[k.iface], *h)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"motors": motors, "hands": hands})
+}
+
+// Deliver 把主机发出的一帧交给虚拟设备处理
+func (s *CANSimulator) Deliver(msg CANMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !msg.Extended {
+		return s.handleHandFrame(msg)
+	}
+
+	frameType := (msg.ID >> 24) & 0x1F
+	motorID := msg.ID & 0xFF
+	m, ok := s.motors[simKey{msg.Interface, motorID}]
+	if !ok {
+		// 总线上没有该电机，真实桥接同样不会报错
+		return nil
+	}
+
+	data := make([]byte, 8)
+	copy(data, msg.Data)
+
+	switch frameType {
+	case typeMotorEnable:
+		m.Enabled = true
+		m.Target = m.Position
+		s.emitFeedback(msg.Interface, m)
+
+	case typeMotorStop:
+		m.Enabled = false
+		if data[0] == 0x01 {
+			m.Faults = 0
+		}
+		s.emitFeedback(msg.Interface, m)
+
+	case typeSetZero:
+		if data[0] == 0x01 {
+			m.Position = 0
+			m.Target = 0
+		}
+		s.emitFeedback(msg.Interface, m)
+
+	case typeWriteSingle:
+		idx := binary.LittleEndian.Uint16(data[0:2])
+		m.Params[idx] = float32(decodeParamValue(idx, binary.LittleEndian.Uint32(data[4:8])))
+		if idx == idxLocRef && m.Enabled {
+			m.Target = float64(m.Params[idx])
+		}
+		s.emitFeedback(msg.Interface, m)
+
+	case typeMITControl:
+		if m.Enabled {
+			m.Target = decodeRange(binary.BigEndian.Uint16(data[0:2]), feedbackPosRange)
+		}
+		s.emitFeedback(msg.Interface, m)
+
+	case typeReadSingle:
+		idx := binary.LittleEndian.Uint16(data[0:2])
+		var value float32
+		switch idx {
+		case idxMechPos:
+			value = float32(m.Position)
+		case idxLocRef:
+			value = float32(m.Target)
+		default:
+			value = m.Params[idx]
+		}
+		resp := make([]byte, 8)
+		if p, ok := lookupParam(idx); ok {
+			resp = p.encode(float64(value))
+		} else {
+			binary.LittleEndian.PutUint16(resp[0:2], idx)
+			binary.LittleEndian.PutUint32(resp[4:8], math.Float32bits(value))
+		}
+		s.emit(msg.Interface, buildReadRespID(defaultHostID, uint8(motorID)), resp)
+	}
+	return nil
+}
+
+// handleHandFrame 处理灵巧手帧（0x01 + 6个手指值）
+func (s *CANSimulator) handleHandFrame(msg CANMessage) error {
+	h, ok := s.hands[simKey{msg.Interface, msg.ID}]
+	if !ok {
+		return nil
+	}
+	if len(msg.Data) < 7 || msg.Data[0] != simHandFrameCode {
+		return fmt.Errorf("无效的手部帧: id=0x%X data=%v", msg.ID, msg.Data)
+	}
+	h.Fingers = make([]int, 6)
+	for i := range h.Fingers {
+		h.Fingers[i] = int(msg.Data[i+1])
+	}
+	h.Updated = time.Now()
+	return nil
+}
+
+// emitFeedback 生成电机反馈帧（类型0x02）
+func (s *CANSimulator) emitFeedback(iface string, m *simMotor) {
+	var mode uint32
+	if m.Enabled {
+		mode = simRunMode
+	}
+	id := uint32(typeMotorFeedback)<<24 | mode<<22 | uint32(m.Faults&0x3F)<<16 | uint32(m.ID)<<8 | defaultHostID
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint16(data[0:2], encodeRange(m.Position, feedbackPosRange))
+	binary.BigEndian.PutUint16(data[2:4], encodeRange(m.Velocity, feedbackVelRange))
+	binary.BigEndian.PutUint16(data[4:6], encodeRange(0, feedbackTorqueRange))
+	binary.BigEndian.PutUint16(data[6:8], uint16(simIdleTempC*10))
+	s.emit(iface, id, data)
+}
+
+// emit 把设备发出的帧放入桥接缓存并推送给SSE连接
+func (s *CANSimulator) emit(iface string, id uint32, data []byte) {
+	hex := make([]string, len(data))
+	for i, b := range data {
+		hex[i] = fmt.Sprintf("%02x", b)
+	}
+	key := simKey{iface, id}
+	frame := simFrame{
+		ID:        id,
+		HexData:   hex,
+		Timestamp: float64(time.Now().UnixNano()) / 1e9,
+	}
+	buf := append(s.buffers[key], frame)
+	if len(buf) > simBufferSize {
+		buf = buf[len(buf)-simBufferSize:]
+	}
+	s.buffers[key] = buf
+	s.totals[key]++
+
+	for ch := range s.streams[iface] {
+		select {
+		case ch <- frame:
+		default:
+		}
+	}
+}
+
+// encodeRange 把 [-r, r] 的值线性映射到 uint16
+func encodeRange(v, r float64) uint16 {
+	if v > r {
+		v = r
+	} else if v < -r {
+		v = -r
+	}
+	return uint16((v + r) / (2 * r) * 65535)
+}
@@ -0,0 +1,270 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// SocketCAN 相关常量（linux/can.h）
+const (
+	canRaw      = 1
+	canEFFFlag  = 0x80000000
+	canRTRFlag  = 0x40000000
+	canErrFlag  = 0x20000000
+	canFrameLen = 16
+)
+
+// sockaddrCAN 对应 struct sockaddr_can
+type sockaddrCAN struct {
+	Family  uint16
+	_       [2]byte
+	Ifindex int32
+	Addr    [16]byte
+}
+
+// SocketCANTransport 通过原生 AF_CAN 原始套接字收发帧，每个接口一个套接字
+type SocketCANTransport struct {
+	mu      sync.Mutex
+	sockets map[string]*canSocket
+	subs    *subscriberSet
+}
+
+// canSocket 单个接口的原始套接字
+type canSocket struct {
+	fd     int
+	iface  string
+	closed chan struct{}
+	wmu    sync.Mutex
+}
+
+// NewSocketCANTransport 创建SocketCAN传输，套接字在首次使用接口时打开
+func NewSocketCANTransport() (CANTransport, error) {
+	return &SocketCANTransport{
+		sockets: make(map[string]*canSocket),
+		subs:    newSubscriberSet(),
+	}, nil
+}
+
+// socket 获取（必要时打开）接口的套接字
+func (t *SocketCANTransport) socket(iface string) (*canSocket, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.sockets[iface]; ok {
+		return s, nil
+	}
+
+	netIf, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("查找CAN接口 %s 失败: %v", iface, err)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_CAN, syscall.SOCK_RAW, canRaw)
+	if err != nil {
+		return nil, fmt.Errorf("创建CAN套接字失败: %v", err)
+	}
+
+	addr := sockaddrCAN{Family: syscall.AF_CAN, Ifindex: int32(netIf.Index)}
+	_, _, errno := syscall.Syscall(syscall.SYS_BIND, uintptr(fd), uintptr(unsafe.Pointer(&addr)), unsafe.Sizeof(addr))
+	if errno != 0 {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("绑定CAN接口 %s 失败: %v", iface, errno)
+	}
+
+	// 读超时用于周期性检查关闭标志
+	tv := syscall.NsecToTimeval(int64(200 * time.Millisecond))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("设置CAN套接字超时失败: %v", err)
+	}
+
+	// 接收时间取内核收到帧的时间，不受读取协程调度延迟影响
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TIMESTAMP, 1); err != nil {
+		log.Printf("⚠️ SocketCAN: 接口 %s 无法启用内核接收时间戳，使用读取时间: %v", iface, err)
+	}
+
+	s := &canSocket{fd: fd, iface: iface, closed: make(chan struct{})}
+	t.sockets[iface] = s
+	go t.readLoop(s)
+
+	log.Printf("SocketCAN: 已打开接口 %s (ifindex=%d)", iface, netIf.Index)
+	return s, nil
+}
+
+// readLoop 持续读取接口上的帧并分发给订阅者
+func (t *SocketCANTransport) readLoop(s *canSocket) {
+	buf := make([]byte, canFrameLen)
+	oob := make([]byte, syscall.CmsgSpace(int(unsafe.Sizeof(syscall.Timeval{}))))
+	for {
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+
+		n, at, err := recvFrame(s.fd, buf, oob)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+			select {
+			case <-s.closed:
+			default:
+				log.Printf("SocketCAN: 读取接口 %s 失败: %v", s.iface, err)
+			}
+			return
+		}
+		if n < canFrameLen {
+			continue
+		}
+
+		rawID := binary.LittleEndian.Uint32(buf[0:4])
+		if rawID&(canRTRFlag|canErrFlag) != 0 {
+			continue
+		}
+		dlc := int(buf[4])
+		if dlc > 8 {
+			dlc = 8
+		}
+		data := make([]byte, dlc)
+		copy(data, buf[8:8+dlc])
+
+		msg := CANMessage{Interface: s.iface, Data: data, Timestamp: at}
+		if rawID&canEFFFlag != 0 {
+			msg.ID = rawID & canEFFMask
+			msg.Extended = true
+		} else {
+			msg.ID = rawID & canSFFMask
+		}
+		t.subs.dispatch(msg)
+	}
+}
+
+// recvFrame 读取一帧及其内核接收时间（SO_TIMESTAMP），没有时间戳时为读取时间
+func recvFrame(fd int, buf, oob []byte) (int, time.Time, error) {
+	n, oobn, _, _, err := syscall.Recvmsg(fd, buf, oob, 0)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if at, ok := kernelTimestamp(oob[:oobn]); ok {
+		return n, at, nil
+	}
+	return n, time.Now(), nil
+}
+
+// kernelTimestamp 从辅助数据中取出 SCM_TIMESTAMP
+func kernelTimestamp(oob []byte) (time.Time, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, m := range msgs {
+		if m.Header.Level != syscall.SOL_SOCKET || m.Header.Type != syscall.SCM_TIMESTAMP || len(m.Data) < int(unsafe.Sizeof(syscall.Timeval{})) {
+			continue
+		}
+		tv := (*syscall.Timeval)(unsafe.Pointer(&m.Data[0]))
+		return time.Unix(tv.Unix()), true
+	}
+	return time.Time{}, false
+}
+
+// Send 发送一帧
+func (t *SocketCANTransport) Send(msg CANMessage) error {
+	if len(msg.Data) > 8 {
+		return fmt.Errorf("CAN帧数据超过8字节: %d", len(msg.Data))
+	}
+	s, err := t.socket(msg.Interface)
+	if err != nil {
+		return err
+	}
+
+	s.wmu.Lock()
+	_, err = syscall.Write(s.fd, encodeCANFrame(msg))
+	s.wmu.Unlock()
+	if err != nil {
+		return fmt.Errorf("写入CAN接口 %s 失败: %v", msg.Interface, err)
+	}
+	return nil
+}
+
+// encodeCANFrame 编码为 struct can_frame
+func encodeCANFrame(msg CANMessage) []byte {
+	frame := make([]byte, canFrameLen)
+	id := msg.ID & canSFFMask
+	if msg.Extended {
+		id = (msg.ID & canEFFMask) | canEFFFlag
+	}
+	binary.LittleEndian.PutUint32(frame[0:4], id)
+	frame[4] = byte(len(msg.Data))
+	copy(frame[8:], msg.Data)
+	return frame
+}
+
+// SendBatch 预先编码整组帧，持有写锁紧凑循环写入，避免与其他发送交错
+func (t *SocketCANTransport) SendBatch(msgs []CANMessage) (BatchResult, error) {
+	var res BatchResult
+	if len(msgs) == 0 {
+		return res, nil
+	}
+	frames := make([][]byte, len(msgs))
+	for i, msg := range msgs {
+		if len(msg.Data) > 8 {
+			return res, fmt.Errorf("CAN帧数据超过8字节: %d", len(msg.Data))
+		}
+		if msg.Interface != msgs[0].Interface {
+			// 跨接口的组退化为逐帧发送
+			return sendEach(t, msgs)
+		}
+		frames[i] = encodeCANFrame(msg)
+	}
+
+	s, err := t.socket(msgs[0].Interface)
+	if err != nil {
+		return res, err
+	}
+
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	res.Batched = true
+	for i, frame := range frames {
+		if _, err := syscall.Write(s.fd, frame); err != nil {
+			return res, fmt.Errorf("写入CAN接口 %s 失败: %v", s.iface, err)
+		}
+		now := time.Now()
+		if i == 0 {
+			res.FirstAt = now
+		}
+		res.LastAt = now
+		res.Count++
+	}
+	res.Skew = res.LastAt.Sub(res.FirstAt)
+	return res, nil
+}
+
+// Subscribe 订阅接口上匹配过滤器的帧
+func (t *SocketCANTransport) Subscribe(iface string, filter CANFilter) (*Subscription, error) {
+	if _, err := t.socket(iface); err != nil {
+		return nil, err
+	}
+	return t.subs.add(iface, filter), nil
+}
+
+// Close 关闭所有套接字
+func (t *SocketCANTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for iface, s := range t.sockets {
+		close(s.closed)
+		syscall.Close(s.fd)
+		delete(t.sockets, iface)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestRecvFrameUsesKernelTimestamp(t *testing.T) {
+	// 用 AF_UNIX 数据报套接字对验证：内核在收到时打时间戳，读取晚于收到
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+	if err := syscall.SetsockoptInt(fds[1], syscall.SOL_SOCKET, syscall.SO_TIMESTAMP, 1); err != nil {
+		t.Skip(err)
+	}
+
+	sent := time.Now()
+	if _, err := syscall.Write(fds[0], make([]byte, canFrameLen)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	buf := make([]byte, canFrameLen)
+	oob := make([]byte, syscall.CmsgSpace(int(unsafe.Sizeof(syscall.Timeval{}))))
+	n, at, err := recvFrame(fds[1], buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != canFrameLen {
+		t.Fatalf("读取 %d 字节，want %d", n, canFrameLen)
+	}
+	if d := at.Sub(sent); d < -time.Millisecond || d > 20*time.Millisecond {
+		t.Errorf("接收时间比发送晚 %v，应为内核收到的时间而不是读取时间", d)
+	}
+}
+
+func TestKernelTimestampMissing(t *testing.T) {
+	if _, ok := kernelTimestamp(nil); ok {
+		t.Error("没有辅助数据时 kernelTimestamp() ok = true")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// NewSocketCANTransport SocketCAN 仅在 Linux 上可用
+func NewSocketCANTransport() (CANTransport, error) {
+	return nil, fmt.Errorf("SocketCAN 仅支持 Linux")
+}
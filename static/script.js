@@ -9,8 +9,67 @@ let tempRecordCounter = 1; // 临时记录计数器
 // 页面加载时初始化
 document.addEventListener('DOMContentLoaded', function() {
     loadAllDevices();
+    refreshEStop();
+    setInterval(refreshEStop, 2000);
 });
 
+// ========== 急停 ==========
+
+// 急停：停止所有电机、手部置于安全姿态、取消所有任务并锁定
+async function emergencyStop() {
+    try {
+        const response = await fetch('/api/estop', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ reason: '网页急停按钮' })
+        });
+        const result = await response.json();
+        showNotification(result.message, result.success ? 'warning' : 'error');
+        updateEStopState(result.estop);
+    } catch (error) {
+        showNotification('急停请求失败: ' + error.message, 'error');
+    }
+}
+
+// 解除急停锁定，必须填写原因
+async function resetEStop() {
+    const reason = prompt('请输入解除急停的原因：');
+    if (!reason) return;
+    try {
+        const response = await fetch('/api/estop/reset', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ reason: reason })
+        });
+        const result = await response.json();
+        showNotification(result.message, result.success ? 'success' : 'error');
+        updateEStopState(result.estop);
+    } catch (error) {
+        showNotification('解除急停失败: ' + error.message, 'error');
+    }
+}
+
+// 查询急停状态
+async function refreshEStop() {
+    try {
+        const response = await fetch('/api/estop');
+        const result = await response.json();
+        updateEStopState(result.estop);
+    } catch (error) {
+        console.error('查询急停状态失败:', error);
+    }
+}
+
+// 显示急停锁定状态
+function updateEStopState(estop) {
+    if (!estop) return;
+    const state = document.getElementById('estopState');
+    const resetBtn = document.getElementById('estopResetBtn');
+    state.style.display = estop.latched ? 'inline' : 'none';
+    resetBtn.style.display = estop.latched ? 'inline-block' : 'none';
+    state.textContent = estop.latched ? `急停已锁定：${estop.reason}` : '';
+}
+
 // 加载所有设备
 async function loadAllDevices() {
     try {
@@ -144,6 +203,11 @@ function createArmPanel(arm) {
                 <button class="btn btn-danger control-btn" onclick="clearTempRecords('${arm.interface}')">清除</button>
                 <button class="btn btn-success control-btn" onclick="showSaveSequenceDialog('${arm.interface}')">保存</button>
             </div>
+            <div class="sequence-buttons-row">
+                <input type="number" id="recordDuration-${arm.interface}" class="speed-input" min="0" step="100" placeholder="用时ms" title="从上一组到达本组的用时(ms)，空为1000">
+                <input type="number" id="recordDwell-${arm.interface}" class="speed-input" min="0" step="100" placeholder="停留ms" title="到达后停留的时间(ms)">
+                <label title="记录速度滑动条的值作为本段各关节速度"><input type="checkbox" id="recordSpeed-${arm.interface}">速度</label>
+            </div>
             <div class="temp-record-list" id="tempRecordList-${arm.interface}"></div>
         </div>
         
@@ -283,7 +347,7 @@ function createJointSliders(arm) {
     <!-- 角度控制 -->
     <div class="joint-control-panel" id="anglePanel${index}-${arm.interface}">
         <div class="joint-controls-row-compact">
-            <span class="joint-label-compact">关节${index + 1} (ID:${motorID})</span>
+            <span class="joint-label-compact">${(arm.joint_names && arm.joint_names[index]) || `关节${index + 1}`} (ID:${motorID})</span>
             <div class="slider-container">
                 <input type="range" class="slider" id="joint${index}Slider-${arm.interface}" 
                        min="-3.14" max="3.14" value="0" step="0.01">
@@ -307,7 +371,7 @@ function createJointSliders(arm) {
     <!-- 速度控制 -->
     <div class="joint-control-panel display-none" id="speedPanel${index}-${arm.interface}">
         <div class="joint-controls-row-compact">
-            <span class="joint-label-compact">关节${index + 1} (ID:${motorID})</span>
+            <span class="joint-label-compact">${(arm.joint_names && arm.joint_names[index]) || `关节${index + 1}`} (ID:${motorID})</span>
             <div class="slider-container">
                 <input type="range" class="slider" id="speed${index}Slider-${arm.interface}" 
                        min="0" max="10" value="1" step="0.1">
@@ -777,6 +841,7 @@ async function setAllJointAngle(interfaceName, jointMap) {
                 'Content-Type': 'application/json',
             },
             body: JSON.stringify({
+                session: jogSessionId(interfaceName),
                 interface: interfaceName,
                 action: 'set_all_angles',
                 joints: joints
@@ -812,23 +877,108 @@ async function setAllJointAngle(interfaceName, jointMap) {
     }
 }
 
+// ========== 点动会话 ==========
+// 滑动条经点动会话下发：打开会话后周期发送心跳，页面卡住时服务器按超时停止该接口；
+// 停止拖动一段时间后结束会话，释放对接口的占用
+const jogSessions = {}; // interface -> {id, ready, heartbeat, idleTimer}
+const JOG_HEARTBEAT_MS = 250;
+const JOG_IDLE_CLOSE_MS = 3000;
+
+// 获取接口的点动会话，没有时打开
+function ensureJogSession(interfaceName) {
+    let session = jogSessions[interfaceName];
+    if (!session) {
+        session = { id: null };
+        session.ready = fetch('/api/jog', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ interface: interfaceName })
+        }).then(response => response.json()).then(result => {
+            if (!result.success) {
+                throw new Error(result.message);
+            }
+            session.id = result.data.id;
+            session.heartbeat = setInterval(() => sendJogHeartbeat(interfaceName), JOG_HEARTBEAT_MS);
+            return session.id;
+        }).catch(error => {
+            dropJogSession(interfaceName);
+            showNotification(error.message, 'error');
+            throw error;
+        });
+        jogSessions[interfaceName] = session;
+    }
+    clearTimeout(session.idleTimer);
+    session.idleTimer = setTimeout(() => closeJogSession(interfaceName), JOG_IDLE_CLOSE_MS);
+    return session.ready;
+}
+
+// 会话内的一条点动指令
+async function jogMove(interfaceName, body) {
+    const id = await ensureJogSession(interfaceName);
+    const response = await fetch(`/api/jog/${id}/move`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(body)
+    });
+    if (response.status === 404 || response.status === 410) {
+        // 会话已超时或被抢占，下次拖动重新打开
+        dropJogSession(interfaceName);
+    }
+    return response.json();
+}
+
+// 发送心跳
+async function sendJogHeartbeat(interfaceName) {
+    const session = jogSessions[interfaceName];
+    if (!session || !session.id) return;
+    try {
+        const response = await fetch(`/api/jog/${session.id}/heartbeat`, { method: 'POST' });
+        if (response.status === 404 || response.status === 410) {
+            const result = await response.json().catch(() => ({}));
+            dropJogSession(interfaceName);
+            showNotification(result.message || '点动会话已结束', 'warning');
+        }
+    } catch (error) {
+        console.error('点动心跳失败:', error);
+    }
+}
+
+// 接口当前的点动会话ID，随其他指令一起发送，避免与自己的会话冲突
+function jogSessionId(interfaceName) {
+    const session = jogSessions[interfaceName];
+    return session && session.id ? session.id : undefined;
+}
+
+// 停止本地的心跳和空闲计时
+function dropJogSession(interfaceName) {
+    const session = jogSessions[interfaceName];
+    if (!session) return;
+    clearInterval(session.heartbeat);
+    clearTimeout(session.idleTimer);
+    delete jogSessions[interfaceName];
+}
+
+// 结束会话，释放占用
+async function closeJogSession(interfaceName) {
+    const session = jogSessions[interfaceName];
+    if (!session) return;
+    dropJogSession(interfaceName);
+    if (session.id) {
+        await fetch(`/api/jog/${session.id}`, { method: 'DELETE' }).catch(() => {});
+    }
+}
+
 // 设置关节角度
 async function setJointAngle(interfaceName, jointID, angle) {
     try {
-const response = await fetch('/api/joints/', {
-    method: 'POST',
-    headers: {
-'Content-Type': 'application/json',
-    },
-    body: JSON.stringify({
-interface: interfaceName,
-action: 'set_angle',
-joint_id: jointID,
-value: angle
-    })
+const result = await jogMove(interfaceName, {
+    joint_id: jointID,
+    angle: angle
 });
-
-const result = await response.json();
 if (!result.success) {
     console.error(`设置角度失败: ${result.message}`);
     return false;
@@ -849,6 +999,7 @@ async function setJointSpeed(interfaceName, jointID, speed) {
                 'Content-Type': 'application/json',
             },
             body: JSON.stringify({
+                session: jogSessionId(interfaceName),
                 interface: interfaceName,
                 action: 'set_speed',
                 joint_id: jointID,
@@ -904,19 +1055,9 @@ if (slider) {
 
 console.log(`发送手部控制命令: ${fingerKey}=${value}, 完整数据:`, handData);
 
-const response = await fetch('/api/hand/', {
-    method: 'POST',
-    headers: {
-'Content-Type': 'application/json',
-    },
-    body: JSON.stringify({
-interface: interfaceName,
-action: 'set_fingers',
-hand: handData
-    })
+const result = await jogMove(interfaceName, {
+    hand: handData
 });
-
-const result = await response.json();
 if (!result.success) {
     console.error(`设置手指失败: ${result.message}`);
 }
@@ -948,6 +1089,7 @@ const response = await fetch('/api/joints/', {
 'Content-Type': 'application/json',
     },
     body: JSON.stringify({
+session: jogSessionId(interfaceName),
 interface: interfaceName,
 action: actionMap[paramType],
 joint_id: arm.motor_ids[0],
@@ -976,6 +1118,7 @@ const response = await fetch('/api/hand/', {
 'Content-Type': 'application/json',
     },
     body: JSON.stringify({
+session: jogSessionId(interfaceName),
 interface: interfaceName,
 action: 'set_profile',
 hand_type: handType,
@@ -1020,6 +1163,7 @@ const response = await fetch('/api/hand/', {
 'Content-Type': 'application/json',
     },
     body: JSON.stringify({
+session: jogSessionId(interfaceName),
 interface: interfaceName,
 action: 'set_fingers',
 hand: testHandData
@@ -1058,6 +1202,7 @@ const response = await fetch('/api/hand/', {
 'Content-Type': 'application/json',
     },
     body: JSON.stringify({
+session: jogSessionId(interfaceName),
 interface: interfaceName,
 action: 'set_fingers',
 hand: resetHandData
@@ -1287,6 +1432,7 @@ const response = await fetch('/api/arm/', {
 'Content-Type': 'application/json',
     },
     body: JSON.stringify({
+session: jogSessionId(interfaceName),
 interface: interfaceName,
 action: action
     })
@@ -1458,6 +1604,20 @@ currentAngles[motorID.toString()] = parseFloat(slider.value);
     }
 });
 
+// 本段的用时、停留和各关节速度（可选）
+const durationMs = parseInt(document.getElementById(`recordDuration-${interfaceName}`).value) || 0;
+const dwellMs = parseInt(document.getElementById(`recordDwell-${interfaceName}`).value) || 0;
+let speeds = null;
+if (document.getElementById(`recordSpeed-${interfaceName}`).checked) {
+    speeds = {};
+    arm.motor_ids.forEach((motorID, index) => {
+const slider = document.getElementById(`speed${index}Slider-${interfaceName}`);
+if (slider) {
+    speeds[motorID.toString()] = parseFloat(slider.value);
+}
+    });
+}
+
 const response = await fetch('/api/joint-sequences/temp/', {
     method: 'POST',
     headers: {
@@ -1466,7 +1626,10 @@ const response = await fetch('/api/joint-sequences/temp/', {
     body: JSON.stringify({
 interface: interfaceName,
 name: name,
-angles: currentAngles
+angles: currentAngles,
+duration_ms: durationMs,
+dwell_ms: dwellMs,
+speed: speeds
     })
 });
 
@@ -1520,6 +1683,11 @@ if (result.success && result.data && result.data.length > 0) {
 const item = document.createElement('div');
 item.className = 'temp-record-item';
 item.textContent = record.name;
+if (record.duration_ms || record.dwell_ms || record.speed) {
+    item.textContent += ` (${record.duration_ms || 1000}ms` +
+(record.dwell_ms ? ` +停留${record.dwell_ms}ms` : '') +
+(record.speed ? ' 含速度' : '') + ')';
+}
 container.appendChild(item);
     });
     } else {
@@ -1781,7 +1949,8 @@ const response = await fetch(`/api/current-angles/?interface=${interfaceName}`);
 const result = await response.json();
 
 if (result.success && result.data) {
-    const angles = result.data;
+    const angles = result.data.commanded || {};
+    const measured = result.data.measured || {};
     const arm = devices.arms.find(a => a.interface === interfaceName);
     
     if (arm) {
@@ -1804,6 +1973,15 @@ arm.motor_ids.forEach((motorID, index) => {
             valueInput.title = `当前值: ${angle.toFixed(2)}`;
         }
     }
+
+    // 显示电机反馈的实测位置，便于对比指令值
+    const feedback = measured[motorIDStr];
+    const valueInput = document.getElementById(`joint${index}Input-${interfaceName}`);
+    if (feedback && valueInput) {
+        const commanded = angles[motorIDStr] !== undefined ? angles[motorIDStr].toFixed(2) : '-';
+        valueInput.title = `指令: ${commanded}  实测: ${feedback.position.toFixed(2)} rad  ` +
+            `速度: ${feedback.velocity.toFixed(2)}  力矩: ${feedback.torque.toFixed(2)}  温度: ${feedback.temperature.toFixed(1)}℃`;
+    }
 });
 
 isUpdating = false;
@@ -2126,6 +2304,7 @@ async function queryCurrentAngles(interfaceName) {
                 'Content-Type': 'application/json',
             },
             body: JSON.stringify({
+                session: jogSessionId(interfaceName),
                 interface: interfaceName,
                 action: 'queryangles'
             })
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 步骤失败时的处理
+const (
+	stepAbort    = "abort"    // 执行本步骤的恢复动作后中止流程
+	stepRetry    = "retry"    // 重试 Retries 次，仍失败时按 abort 处理
+	stepContinue = "continue" // 记录失败后继续下一步
+)
+
+// stepRetryDelay 重试前的等待
+const stepRetryDelay = 200 * time.Millisecond
+
+// SequenceStep 上举/下放流程中的一个步骤，Run 同时作用于两臂（或两手），
+// 任一侧失败即为整个步骤失败
+type SequenceStep struct {
+	Name        string
+	OnError     string // abort / retry / continue
+	Retries     int    // retry 时的重试次数
+	Run         func() error
+	RecoverName string       // 中止时的恢复动作说明
+	Recover     func() error // 中止时的恢复动作，nil 表示无需恢复
+}
+
+// StepResult 失败步骤的记录
+type StepResult struct {
+	Index         int    `json:"index"` // 第几步（从1开始）
+	Step          string `json:"step"`
+	Policy        string `json:"policy"`
+	Attempts      int    `json:"attempts"`
+	Error         string `json:"error"`
+	Recovery      string `json:"recovery,omitempty"`       // 已执行的恢复动作
+	RecoveryError string `json:"recovery_error,omitempty"` // 恢复动作失败的原因
+}
+
+// SequenceReport 上举/下放流程的执行报告，出现在任务状态的 report 中
+type SequenceReport struct {
+	Sequence  string       `json:"sequence"`            // UP / DOWN
+	Completed []string     `json:"completed"`           // 已成功完成的步骤
+	Continued []StepResult `json:"continued,omitempty"` // 失败后按 continue 继续的步骤
+	Failed    *StepResult  `json:"failed,omitempty"`    // 导致中止的步骤
+}
+
+// SequenceError 流程因某一步骤失败而中止
+type SequenceError struct {
+	Report SequenceReport
+}
+
+func (e *SequenceError) Error() string {
+	f := e.Report.Failed
+	msg := fmt.Sprintf("%s序列第 %d 步(%s)失败（尝试 %d 次）: %s", e.Report.Sequence, f.Index, f.Step, f.Attempts, f.Error)
+	if f.Recovery != "" {
+		msg += "；已" + f.Recovery
+		if f.RecoveryError != "" {
+			msg += "（失败: " + f.RecoveryError + "）"
+		}
+	}
+	return msg
+}
+
+// runSteps 依次执行步骤，每个步骤之前是任务的安全点。步骤失败时按其 OnError 处理；
+// 任务被取消时直接返回 errJobCancelled，不执行恢复动作（手臂已在安全点停止）。
+// 急停锁定导致的失败不论 OnError 都直接中止：不重试、不继续，也不执行恢复动作
+// （急停已停止各关节，恢复动作的运动指令同样会被拒绝）。报告写入任务状态
+func runSteps(job *Job, latch *EStopLatch, sequence string, steps []SequenceStep) error {
+	report := SequenceReport{Sequence: sequence, Completed: []string{}}
+	defer job.SetReport(&report)
+
+	for i, step := range steps {
+		if err := job.SetStep(step.Name); err != nil {
+			return err
+		}
+		attempts := 1
+		if step.OnError == stepRetry {
+			attempts += step.Retries
+		}
+		var err error
+		n := 0
+		for n < attempts {
+			n++
+			if err = step.Run(); err == nil || errors.Is(err, errJobCancelled) || estopped(latch, err) {
+				break
+			}
+			if n < attempts {
+				log.Printf("⚠️ %s序列步骤 %s 失败: %v，重试(%d/%d)", sequence, step.Name, err, n, step.Retries)
+				if err := job.Sleep(stepRetryDelay); err != nil {
+					return err
+				}
+			}
+		}
+		if err == nil {
+			report.Completed = append(report.Completed, step.Name)
+			continue
+		}
+		if errors.Is(err, errJobCancelled) {
+			return err
+		}
+
+		result := StepResult{Index: i + 1, Step: step.Name, Policy: step.OnError, Attempts: n, Error: err.Error()}
+		if estopped(latch, err) {
+			log.Printf("❌ %s序列步骤 %s 失败: %v，急停锁定，中止（不执行恢复动作）", sequence, step.Name, err)
+			report.Failed = &result
+			return &SequenceError{Report: report}
+		}
+		if step.OnError == stepContinue {
+			log.Printf("⚠️ %s序列步骤 %s 失败: %v，继续", sequence, step.Name, err)
+			report.Continued = append(report.Continued, result)
+			continue
+		}
+
+		log.Printf("❌ %s序列步骤 %s 失败: %v，中止", sequence, step.Name, err)
+		if step.Recover != nil {
+			result.Recovery = step.RecoverName
+			log.Printf("恢复动作: %s", step.RecoverName)
+			if rerr := step.Recover(); rerr != nil {
+				log.Printf("恢复动作 %s 失败: %v", step.RecoverName, rerr)
+				result.RecoveryError = rerr.Error()
+			}
+		}
+		report.Failed = &result
+		return &SequenceError{Report: report}
+	}
+	return nil
+}
+
+// estopped 步骤失败是否因为急停：错误本身是 EStopError，或急停已锁定
+// （bothArms 等合并的错误不再是 EStopError，以锁定状态为准）
+func estopped(latch *EStopLatch, err error) bool {
+	var latched *EStopError
+	return errors.As(err, &latched) || latch.Check() != nil
+}
+
+// bothArms 对两臂执行同一操作。两臂都会执行（一侧失败不跳过另一侧），返回合并的错误
+func bothArms(left, right *BlackArmController, op func(*BlackArmController) error) error {
+	var failed []string
+	for _, controller := range []*BlackArmController{left, right} {
+		if err := op(controller); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", controller.Interface, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// bothHands 向两手发送姿态（急停锁定时拒绝），两手都会发送，返回合并的错误
+func bothHands(config *Config, transports *TransportSet, latch *EStopLatch, leftDeviceID, rightDeviceID int, leftPose, rightPose []int) error {
+	var failed []string
+	for _, hand := range []struct {
+		side     string
+		deviceID int
+		pose     []int
+	}{{"left", leftDeviceID, leftPose}, {"right", rightDeviceID, rightPose}} {
+		iface := config.Hands[hand.side].Interface
+		if err := sendHandCommandDirect(transports, latch, iface, hand.deviceID, hand.pose); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", iface, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// 两臂操作，用于步骤和恢复动作
+func enableArm(b *BlackArmController) error  { return b.EnableMotor("全部关节") }
+func disableArm(b *BlackArmController) error { return b.DisableMotor() }
+func holdArm(b *BlackArmController) error    { return b.Hold() }
+func cleanArm(b *BlackArmController) error   { return b.CleanError() }
+func defaultSpeedArm(b *BlackArmController) error {
+	return b.SetSpeeds(uniformSpeeds(len(b.MotorIDs), defaultSequenceSpeed))
+}
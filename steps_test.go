@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// stepLog 记录测试步骤的执行顺序
+type stepLog struct{ calls []string }
+
+// step 构造测试步骤：Run 依次返回 results 中的错误，用完后返回nil
+func (l *stepLog) step(name, policy string, retries int, results ...error) SequenceStep {
+	n := 0
+	return SequenceStep{Name: name, OnError: policy, Retries: retries, Run: func() error {
+		l.calls = append(l.calls, name)
+		n++
+		if n <= len(results) {
+			return results[n-1]
+		}
+		return nil
+	}}
+}
+
+// recover 为步骤加上恢复动作
+func (l *stepLog) recover(step SequenceStep, err error) SequenceStep {
+	step.RecoverName = "恢复" + step.Name
+	step.Recover = func() error {
+		l.calls = append(l.calls, step.RecoverName)
+		return err
+	}
+	return step
+}
+
+func TestRunSteps(t *testing.T) {
+	fail := errors.New("失败")
+	estop := &EStopError{Reason: "测试"}
+	latched := &EStopLatch{}
+	latched.Engage("测试")
+	tests := []struct {
+		name       string
+		latch      *EStopLatch
+		steps      func(l *stepLog, job *Job) []SequenceStep
+		wantErr    error // nil 为成功；errJobCancelled；其他表示 *SequenceError
+		wantCalls  []string
+		wantReport SequenceReport
+	}{
+		{
+			name: "全部成功",
+			steps: func(l *stepLog, job *Job) []SequenceStep {
+				return []SequenceStep{l.step("a", stepAbort, 0), l.step("b", stepAbort, 0)}
+			},
+			wantCalls:  []string{"a", "b"},
+			wantReport: SequenceReport{Sequence: "UP", Completed: []string{"a", "b"}},
+		},
+		{
+			name: "continue 失败后继续",
+			steps: func(l *stepLog, job *Job) []SequenceStep {
+				return []SequenceStep{l.step("a", stepContinue, 0, fail), l.step("b", stepAbort, 0)}
+			},
+			wantCalls: []string{"a", "b"},
+			wantReport: SequenceReport{Sequence: "UP", Completed: []string{"b"},
+				Continued: []StepResult{{Index: 1, Step: "a", Policy: stepContinue, Attempts: 1, Error: "失败"}}},
+		},
+		{
+			name: "retry 重试后成功",
+			steps: func(l *stepLog, job *Job) []SequenceStep {
+				return []SequenceStep{l.step("a", stepRetry, 2, fail), l.step("b", stepAbort, 0)}
+			},
+			wantCalls:  []string{"a", "a", "b"},
+			wantReport: SequenceReport{Sequence: "UP", Completed: []string{"a", "b"}},
+		},
+		{
+			name: "retry 用完后按 abort 执行恢复动作",
+			steps: func(l *stepLog, job *Job) []SequenceStep {
+				return []SequenceStep{l.step("a", stepAbort, 0), l.recover(l.step("b", stepRetry, 1, fail, fail), nil), l.step("c", stepAbort, 0)}
+			},
+			wantErr:   fail,
+			wantCalls: []string{"a", "b", "b", "恢复b"},
+			wantReport: SequenceReport{Sequence: "UP", Completed: []string{"a"},
+				Failed: &StepResult{Index: 2, Step: "b", Policy: stepRetry, Attempts: 2, Error: "失败", Recovery: "恢复b"}},
+		},
+		{
+			name: "恢复动作失败也记录",
+			steps: func(l *stepLog, job *Job) []SequenceStep {
+				return []SequenceStep{l.recover(l.step("a", stepAbort, 0, fail), errors.New("恢复失败"))}
+			},
+			wantErr:   fail,
+			wantCalls: []string{"a", "恢复a"},
+			wantReport: SequenceReport{Sequence: "UP", Completed: []string{},
+				Failed: &StepResult{Index: 1, Step: "a", Policy: stepAbort, Attempts: 1, Error: "失败", Recovery: "恢复a", RecoveryError: "恢复失败"}},
+		},
+		{
+			name: "取消时在下一步之前返回，不执行恢复动作",
+			steps: func(l *stepLog, job *Job) []SequenceStep {
+				a := l.step("a", stepAbort, 0)
+				run := a.Run
+				a.Run = func() error { job.Cancel(); return run() }
+				return []SequenceStep{a, l.recover(l.step("b", stepAbort, 0), nil)}
+			},
+			wantErr:    errJobCancelled,
+			wantCalls:  []string{"a"},
+			wantReport: SequenceReport{Sequence: "UP", Completed: []string{"a"}},
+		},
+		{
+			name: "步骤返回取消时不重试",
+			steps: func(l *stepLog, job *Job) []SequenceStep {
+				return []SequenceStep{l.recover(l.step("a", stepRetry, 3, errJobCancelled), nil)}
+			},
+			wantErr:    errJobCancelled,
+			wantCalls:  []string{"a"},
+			wantReport: SequenceReport{Sequence: "UP", Completed: []string{}},
+		},
+		{
+			name: "急停时 retry 不重试，不执行恢复动作",
+			steps: func(l *stepLog, job *Job) []SequenceStep {
+				return []SequenceStep{l.recover(l.step("a", stepRetry, 3, estop, estop, estop, estop), nil), l.step("b", stepAbort, 0)}
+			},
+			wantErr:   estop,
+			wantCalls: []string{"a"},
+			wantReport: SequenceReport{Sequence: "UP", Completed: []string{},
+				Failed: &StepResult{Index: 1, Step: "a", Policy: stepRetry, Attempts: 1, Error: estop.Error()}},
+		},
+		{
+			name:  "急停锁定时 continue 也中止（合并后的错误）",
+			latch: latched,
+			steps: func(l *stepLog, job *Job) []SequenceStep {
+				return []SequenceStep{l.step("a", stepContinue, 0, fail), l.step("b", stepAbort, 0)}
+			},
+			wantErr:   fail,
+			wantCalls: []string{"a"},
+			wantReport: SequenceReport{Sequence: "UP", Completed: []string{},
+				Failed: &StepResult{Index: 1, Step: "a", Policy: stepContinue, Attempts: 1, Error: "失败"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &stepLog{}
+			jobs := NewJobManager(NewLeaseManager(nil))
+			var err error
+			job, serr := jobs.Submit("merged", tt.name, nil, false, func(job *Job) error {
+				err = runSteps(job, tt.latch, "UP", tt.steps(l, job))
+				return err
+			})
+			if serr != nil {
+				t.Fatal(serr)
+			}
+			<-job.done
+
+			var seqErr *SequenceError
+			switch {
+			case tt.wantErr == nil && err != nil, tt.wantErr == errJobCancelled && err != errJobCancelled:
+				t.Fatalf("runSteps() error = %v, want %v", err, tt.wantErr)
+			case tt.wantErr != nil && tt.wantErr != errJobCancelled && !errors.As(err, &seqErr):
+				t.Fatalf("runSteps() error = %v, want *SequenceError", err)
+			}
+			if !reflect.DeepEqual(l.calls, tt.wantCalls) {
+				t.Errorf("执行顺序 = %v, want %v", l.calls, tt.wantCalls)
+			}
+			report := job.Status().Report
+			if report == nil || !reflect.DeepEqual(*report, tt.wantReport) {
+				t.Errorf("报告 = %+v, want %+v", report, tt.wantReport)
+			}
+		})
+	}
+}
+
+func TestBothHandsRefusedWhileLatched(t *testing.T) {
+	config := &Config{
+		DryRun: true,
+		Hands: map[string]HandConfigNew{
+			"left":  {Interface: "can0"},
+			"right": {Interface: "can1"},
+		},
+	}
+	transports, err := NewTransportSet(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transports.Close()
+	pose := []int{1, 2, 3, 4, 5, 6}
+
+	latched := &EStopLatch{}
+	latched.Engage("测试")
+	tests := []struct {
+		name    string
+		latch   *EStopLatch
+		wantErr bool
+		frames  int
+	}{
+		{"未锁定", &EStopLatch{}, false, 2},
+		{"没有急停锁", nil, false, 2},
+		{"急停锁定时拒绝", latched, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transports.Capture().Reset()
+			err := bothHands(config, transports, tt.latch, 1, 2, pose, pose)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("bothHands() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n := len(transports.Capture().Frames()); n != tt.frames {
+				t.Errorf("发送了 %d 帧，want %d", n, tt.frames)
+			}
+		})
+	}
+}
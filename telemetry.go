@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 反馈帧ID中的模式（bit22-23）
+var feedbackModes = map[uint32]string{
+	0: "reset",
+	1: "calibration",
+	2: "run",
+}
+
+// feedbackFilter 匹配发给本机的所有反馈帧：类型0x02，低8位为主机ID，中间的模式/故障/电机ID任意
+var feedbackFilter = CANFilter{
+	ID:   uint32(typeMotorFeedback)<<24 | defaultHostID,
+	Mask: 0x1F<<24 | 0xFF,
+}
+
+// MotorTelemetry 电机反馈帧（类型0x02）解出的实时状态
+type MotorTelemetry struct {
+	MotorID     int       `json:"motor_id"`
+	Position    float64   `json:"position"`    // rad
+	Velocity    float64   `json:"velocity"`    // rad/s
+	Torque      float64   `json:"torque"`      // Nm
+	Temperature float64   `json:"temperature"` // ℃
+	Mode        string    `json:"mode"`
+	FaultBits   uint8     `json:"fault_bits"` // ID bit16-21
+	Updated     time.Time `json:"updated"`
+}
+
+// decodeFeedback 解析反馈帧，ID: 类型<<24 | 模式<<22 | 故障<<16 | 电机ID<<8 | 主机ID，
+// 数据为大端的位置、速度、力矩和温度×10
+func decodeFeedback(msg CANMessage) (MotorTelemetry, bool) {
+	if !msg.Extended || (msg.ID>>24)&0x1F != typeMotorFeedback || len(msg.Data) < 8 {
+		return MotorTelemetry{}, false
+	}
+
+	mode, ok := feedbackModes[(msg.ID>>22)&0x03]
+	if !ok {
+		mode = "unknown"
+	}
+	t := MotorTelemetry{
+		MotorID:     int((msg.ID >> 8) & 0xFF),
+		Position:    decodeRange(binary.BigEndian.Uint16(msg.Data[0:2]), feedbackPosRange),
+		Velocity:    decodeRange(binary.BigEndian.Uint16(msg.Data[2:4]), feedbackVelRange),
+		Torque:      decodeRange(binary.BigEndian.Uint16(msg.Data[4:6]), feedbackTorqueRange),
+		Temperature: float64(binary.BigEndian.Uint16(msg.Data[6:8])) / 10,
+		Mode:        mode,
+		FaultBits:   uint8((msg.ID >> 16) & 0x3F),
+		Updated:     msg.Timestamp,
+	}
+	if t.Updated.IsZero() {
+		t.Updated = time.Now()
+	}
+	return t, true
+}
+
+// decodeRange 把 uint16 线性映射回 [-r, r]
+func decodeRange(u uint16, r float64) float64 {
+	return float64(u)/65535*2*r - r
+}
+
+// TelemetryStore 一个接口上各电机最新的反馈及故障记录
+type TelemetryStore struct {
+	mu          sync.RWMutex
+	motors      map[int]MotorTelemetry
+	faults      map[int]map[string]*FaultRecord // 电机ID -> 故障名 -> 记录
+	unavailable string                          // 无法订阅反馈的原因，为空表示反馈可用
+}
+
+// NewTelemetryStore 创建反馈存储
+func NewTelemetryStore() *TelemetryStore {
+	return &TelemetryStore{
+		motors: make(map[int]MotorTelemetry),
+		faults: make(map[int]map[string]*FaultRecord),
+	}
+}
+
+// update 记录一帧反馈
+func (s *TelemetryStore) update(t MotorTelemetry) {
+	s.mu.Lock()
+	s.motors[t.MotorID] = t
+	s.recordFaults(t)
+	s.mu.Unlock()
+}
+
+// setUnavailable 记录无法订阅反馈的原因
+func (s *TelemetryStore) setUnavailable(reason string) {
+	s.mu.Lock()
+	s.unavailable = reason
+	s.mu.Unlock()
+}
+
+// Unavailable 无法订阅反馈的原因，反馈可用时为空
+func (s *TelemetryStore) Unavailable() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.unavailable
+}
+
+// Get 获取单个电机最新的反馈
+func (s *TelemetryStore) Get(motorID int) (MotorTelemetry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.motors[motorID]
+	return t, ok
+}
+
+// Snapshot 以电机ID字符串为键返回所有电机的反馈（与 currentAngles 的键一致）
+func (s *TelemetryStore) Snapshot() map[string]MotorTelemetry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]MotorTelemetry, len(s.motors))
+	for id, t := range s.motors {
+		out[strconv.Itoa(id)] = t
+	}
+	return out
+}
+
+// startTelemetry 订阅接口上的反馈帧并持续更新存储。无法订阅时（如只能轮询精确ID的旧桥接）
+// 记录原因，由 /api/arms 和 /api/faults 报告实测值和故障不可用
+func (ws *WebServer) startTelemetry(iface string, transport CANTransport) {
+	store := NewTelemetryStore()
+	ws.telemetry[iface] = store
+
+	sub, err := transport.Subscribe(iface, feedbackFilter)
+	if err != nil {
+		log.Printf("⚠️ 接口 %s 无法订阅电机反馈，实测值和故障不可用: %v", iface, err)
+		store.setUnavailable(err.Error())
+		return
+	}
+	go func() {
+		for msg := range sub.C {
+			if t, ok := decodeFeedback(msg); ok {
+				store.update(t)
+			}
+		}
+	}()
+}
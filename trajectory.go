@@ -0,0 +1,439 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 关键帧之间的插值曲线
+const (
+	profileStep      = "step"      // 直接下发关键帧，由电机PP规划（原有行为）
+	profileLinear    = "linear"    // 匀速
+	profileCubic     = "cubic"     // 三次多项式，起止速度为0
+	profileTrapezoid = "trapezoid" // 梯形速度：加速、匀速、减速
+)
+
+// 插值参数
+const (
+	defaultTrajectoryRate = 50.0            // 默认流式下发频率 Hz
+	maxTrajectoryRate     = 200.0           // 下发频率上限 Hz
+	sequenceStepInterval  = 1 * time.Second // 角度组未指定 duration_ms 时的到达用时
+	defaultSequenceSpeed  = 0.8             // 序列执行的默认PP速度 rad/s，角度组未指定 speed 的关节使用该值
+	trapezoidAccelRatio   = 0.25            // 梯形曲线加速段、减速段各占的时间比例
+)
+
+// TrajectoryConfig 插值配置（config.yaml 的 trajectory）
+type TrajectoryConfig struct {
+	Profile string  `yaml:"profile"` // 序列和角度组都未指定时使用的曲线，默认 step
+	RateHz  float64 `yaml:"rate_hz"` // 中间点下发频率，默认 50Hz
+}
+
+// rate 下发频率
+func (c TrajectoryConfig) rate() float64 {
+	if c.RateHz <= 0 {
+		return defaultTrajectoryRate
+	}
+	return math.Min(c.RateHz, maxTrajectoryRate)
+}
+
+// checkProfile 检查曲线名称，空字符串表示未指定
+func checkProfile(profile string) error {
+	switch profile {
+	case "", profileStep, profileLinear, profileCubic, profileTrapezoid:
+		return nil
+	}
+	return fmt.Errorf("未知插值曲线: %s（可选 step/linear/cubic/trapezoid）", profile)
+}
+
+// stepProfile 角度组使用的曲线：角度组 > 序列 > 配置 > step，无效名称按 step 处理
+func stepProfile(set JointAngleSet, seq *JointSequence, traj TrajectoryConfig) string {
+	for _, p := range []string{set.Profile, seq.Profile, traj.Profile} {
+		if p == "" {
+			continue
+		}
+		if checkProfile(p) != nil {
+			return profileStep
+		}
+		return p
+	}
+	return profileStep
+}
+
+// checkSequenceSteps 加载序列时检查插值曲线名称和时间参数，无效的曲线按 step 执行，负的时间按默认值
+func checkSequenceSteps(seq *JointSequence) {
+	if err := checkProfile(seq.Profile); err != nil {
+		log.Printf("⚠️ 序列 %s: %v", seq.Name, err)
+	}
+	for i, set := range seq.Angles {
+		if err := checkProfile(set.Profile); err != nil {
+			log.Printf("⚠️ 序列 %s 第 %d 组(%s): %v", seq.Name, i+1, set.Name, err)
+		}
+		if set.DurationMs < 0 || set.DwellMs < 0 {
+			log.Printf("⚠️ 序列 %s 第 %d 组(%s): duration_ms=%d dwell_ms=%d 不能为负", seq.Name, i+1, set.Name, set.DurationMs, set.DwellMs)
+		}
+	}
+}
+
+// duration 到达本组的用时
+func (s JointAngleSet) duration() time.Duration {
+	if s.DurationMs <= 0 {
+		return sequenceStepInterval
+	}
+	return time.Duration(s.DurationMs) * time.Millisecond
+}
+
+// dwell 到达本组后的停留时间
+func (s JointAngleSet) dwell() time.Duration {
+	if s.DwellMs <= 0 {
+		return 0
+	}
+	return time.Duration(s.DwellMs) * time.Millisecond
+}
+
+// applyStepSpeeds 下发本组指定的关节速度；之前改过速度而本组未指定的关节恢复为 defaultSequenceSpeed。
+// applied 记录本次执行中已下发的速度
+func applyStepSpeeds(controller *BlackArmController, set JointAngleSet, applied map[int]float32) error {
+	speeds := make(map[int]float32, len(set.Speed))
+	for motorIDStr, speed := range set.Speed {
+		motorID, err := strconv.Atoi(motorIDStr)
+		if err != nil {
+			return fmt.Errorf("无效的电机ID: %s", motorIDStr)
+		}
+		speeds[motorID] = speed
+	}
+	for motorID := range applied {
+		if _, ok := speeds[motorID]; !ok {
+			speeds[motorID] = defaultSequenceSpeed
+		}
+	}
+
+	motorIDs := make([]int, 0, len(speeds))
+	for motorID := range speeds {
+		motorIDs = append(motorIDs, motorID)
+	}
+	sort.Ints(motorIDs)
+	for _, motorID := range motorIDs {
+		speed := speeds[motorID]
+		if last, ok := applied[motorID]; ok && last == speed {
+			continue
+		}
+		if err := controller.SetSpeed(motorID, speed); err != nil {
+			return err
+		}
+		if speed == defaultSequenceSpeed {
+			delete(applied, motorID)
+		} else {
+			applied[motorID] = speed
+		}
+	}
+	return nil
+}
+
+// uniformSpeeds 每个关节相同的速度
+func uniformSpeeds(n int, speed float32) []float32 {
+	speeds := make([]float32, n)
+	for i := range speeds {
+		speeds[i] = speed
+	}
+	return speeds
+}
+
+// profileProgress 曲线在归一化时间 t∈[0,1] 处的归一化位移
+func profileProgress(profile string, t float64) float64 {
+	if t <= 0 {
+		return 0
+	}
+	if t >= 1 {
+		return 1
+	}
+	switch profile {
+	case profileLinear:
+		return t
+	case profileCubic:
+		return t * t * (3 - 2*t)
+	case profileTrapezoid:
+		ta := trapezoidAccelRatio
+		v := 1 / (1 - ta) // 匀速段速度，使总位移为1
+		switch {
+		case t < ta:
+			return 0.5 * v / ta * t * t
+		case t <= 1-ta:
+			return v * (t - ta/2)
+		default:
+			r := 1 - t
+			return 1 - 0.5*v/ta*r*r
+		}
+	}
+	return 1
+}
+
+// MoveProfile 在 duration 内按曲线从上一次指令角度流式下发中间点到 targets，最后一点为 targets 本身。
+// 没有上一次指令角度的关节从实测位置开始，读不到实测位置时返回错误而不是直接跳到目标
+// （干运行没有反馈，这些关节直接下发目标）。每个插值点之前都是安全点：任务取消或 abort 关闭时停在已下发的点上返回，
+// 暂停时停在已下发的点上等待，恢复后从下一点继续（暂停的时间不计入插值）。
+// 返回实际下发的最后一点（clamp 策略下为截断后的目标），到位检查应以它为准
+func (b *BlackArmController) MoveProfile(targets map[int]float32, profile string, duration time.Duration, rate float64, job *Job, abort <-chan struct{}) (map[int]float32, error) {
+	if err := armCheckpoint(job, abort); err != nil {
+		return nil, err
+	}
+	if profile == profileStep || duration <= 0 {
+		final := copyTargets(targets)
+		if _, err := b.SetAngleGroup(final); err != nil {
+			return nil, err
+		}
+		return final, nil
+	}
+
+	motorIDs := make([]int, 0, len(targets))
+	for motorID := range targets {
+		motorIDs = append(motorIDs, motorID)
+	}
+	sort.Ints(motorIDs)
+	if err := b.seedTargets(motorIDs); err != nil {
+		return nil, fmt.Errorf("插值起点未知: %v", err)
+	}
+	from := make(map[int]float32, len(targets))
+	for motorID, angle := range targets {
+		if last, ok := b.lastTarget(motorID); ok {
+			from[motorID] = last
+		} else {
+			from[motorID] = angle
+		}
+	}
+
+	period := time.Duration(float64(time.Second) / rate)
+	steps := int(duration / period)
+	if steps < 1 {
+		steps = 1
+	}
+	start := time.Now()
+	var point map[int]float32
+	for i := 1; i <= steps; i++ {
+		if i > 1 {
+			paused := time.Now()
+			if err := armCheckpoint(job, abort); err != nil {
+				return nil, err
+			}
+			start = start.Add(time.Since(paused))
+		}
+		s := profileProgress(profile, float64(i)/float64(steps))
+		point = make(map[int]float32, len(targets))
+		for motorID, angle := range targets {
+			point[motorID] = from[motorID] + float32(s)*(angle-from[motorID])
+		}
+		if i == steps {
+			point = copyTargets(targets)
+		}
+		if _, err := b.sendAngleGroup(point); err != nil {
+			return nil, fmt.Errorf("插值第 %d/%d 点: %v", i, steps, err)
+		}
+		if err := armSleep(job, abort, time.Until(start.Add(time.Duration(i)*period))); err != nil {
+			return nil, err
+		}
+	}
+	return point, nil
+}
+
+// copyTargets 复制一组目标角度（SetAngleGroup 在 clamp 策略下会修改传入的 map）
+func copyTargets(targets map[int]float32) map[int]float32 {
+	out := make(map[int]float32, len(targets))
+	for k, v := range targets {
+		out[k] = v
+	}
+	return out
+}
+
+// playSequence 依次执行序列的角度组：先下发本组的关节速度，再按曲线在 duration_ms（默认1秒）内到达，
+// 然后停留 dwell_ms；step 曲线下发后等待 duration_ms。wait_arrival 的组以实测到位代替固定等待，
+// 超时未到位时中止序列并返回错误；速度或角度下发失败同样中止。onStep 在每组成功到达后调用。
+// 每组开始前是任务的安全点：暂停时在此等待，取消时在此返回；abort 关闭（另一条手臂失败）时同样在此返回
+func playSequence(controller *BlackArmController, sequence *JointSequence, traj TrajectoryConfig, job *Job, abort <-chan struct{}, onStep func(i int, targets map[int]float32)) error {
+	rate := traj.rate()
+	applied := make(map[int]float32)
+	job.SetTotal(controller.Interface, len(sequence.Angles))
+	defer func() {
+		if len(applied) > 0 {
+			applyStepSpeeds(controller, JointAngleSet{}, applied)
+		}
+	}()
+
+	for i, angleSet := range sequence.Angles {
+		if armAborted(abort) {
+			return errArmAborted
+		}
+		if err := job.AngleCheckpoint(controller.Interface, i); err != nil {
+			return err
+		}
+		profile := stepProfile(angleSet, sequence, traj)
+		duration := angleSet.duration()
+		log.Printf("执行第 %d 组角度: %s (%s, %v, 停留 %v)", i+1, angleSet.Name, profile, duration, angleSet.dwell())
+
+		if err := applyStepSpeeds(controller, angleSet, applied); err != nil {
+			log.Printf("设置第 %d 组速度失败: %v", i+1, err)
+			return fmt.Errorf("设置第 %d 组(%s)速度失败: %v", i+1, angleSet.Name, err)
+		}
+
+		start := time.Now()
+		targets, err := controller.MoveProfile(angleSetTargets(angleSet), profile, duration, rate, job, abort)
+		if err != nil {
+			if err == errJobCancelled || err == errArmAborted {
+				return err
+			}
+			log.Printf("设置第 %d 组角度失败: %v", i+1, err)
+			return fmt.Errorf("设置第 %d 组(%s)角度失败: %v", i+1, angleSet.Name, err)
+		}
+		if waitForStep(angleSet, sequence) {
+			timeout := time.Duration(angleSet.TimeoutMs) * time.Millisecond
+			res, err := controller.WaitArrival(targets, angleSet.Tolerance, timeout, job, abort)
+			if err == errJobCancelled || err == errArmAborted {
+				return err
+			}
+			if err != nil {
+				log.Printf("第 %d 组(%s) 未到位: %v", i+1, angleSet.Name, err)
+				return fmt.Errorf("第 %d 组(%s) 未到位: %v", i+1, angleSet.Name, err)
+			}
+			log.Printf("第 %d 组到位: 最大误差 %.4f rad (关节 %d)，等待 %dms", i+1, res.MaxError, res.Worst, res.ElapsedMs)
+		}
+		if onStep != nil {
+			onStep(i, targets)
+		}
+
+		wait := duration - time.Since(start)
+		if waitForStep(angleSet, sequence) {
+			wait = 0
+		}
+		if err := armSleep(job, abort, wait+angleSet.dwell()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errArmAborted 另一条手臂的序列失败，本臂在安全点停止
+var errArmAborted = errors.New("另一条手臂的序列失败，已在安全点停止")
+
+// armAborted abort 是否已关闭
+func armAborted(abort <-chan struct{}) bool {
+	select {
+	case <-abort:
+		return true
+	default:
+		return false
+	}
+}
+
+// armCheckpoint 安全点：另一条手臂失败时返回 errArmAborted，否则同 job.Checkpoint
+func armCheckpoint(job *Job, abort <-chan struct{}) error {
+	if armAborted(abort) {
+		return errArmAborted
+	}
+	return job.Checkpoint()
+}
+
+// armStopped 不阻塞地检查任务是否已取消、另一条手臂是否已失败（暂停不算）
+func armStopped(job *Job, abort <-chan struct{}) error {
+	if armAborted(abort) {
+		return errArmAborted
+	}
+	if job != nil {
+		select {
+		case <-job.cancelCh:
+			return errJobCancelled
+		default:
+		}
+	}
+	return nil
+}
+
+// armSleep 可被任务取消或另一条手臂失败打断的等待
+func armSleep(job *Job, abort <-chan struct{}, d time.Duration) error {
+	if abort == nil {
+		return job.Sleep(d)
+	}
+	if armAborted(abort) {
+		return errArmAborted
+	}
+	if d <= 0 {
+		return nil
+	}
+	var cancelled <-chan struct{}
+	if job != nil {
+		cancelled = job.cancelCh
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-cancelled:
+		return errJobCancelled
+	case <-abort:
+		return errArmAborted
+	}
+}
+
+// playArms 左右臂并行执行各自的序列，等待两臂都结束。一条手臂失败时另一条在下一个安全点停止，
+// 返回失败手臂的错误；两臂都未失败而任务被取消时返回 errJobCancelled
+func playArms(left, right *BlackArmController, leftSeq, rightSeq *JointSequence, traj TrajectoryConfig, job *Job) error {
+	errs := make([]error, 2)
+	abort := make(chan struct{})
+	var once sync.Once
+	var wg sync.WaitGroup
+	for i, arm := range []struct {
+		controller *BlackArmController
+		sequence   *JointSequence
+	}{{left, leftSeq}, {right, rightSeq}} {
+		wg.Add(1)
+		go func(i int, controller *BlackArmController, sequence *JointSequence) {
+			defer wg.Done()
+			err := playSequence(controller, sequence, traj, job, abort, nil)
+			switch err {
+			case nil:
+			case errJobCancelled:
+				errs[i] = err
+			case errArmAborted:
+				log.Printf("%s 序列 %s: %v", controller.Interface, sequence.Name, err)
+				errs[i] = err
+			default:
+				log.Printf("%s 序列 %s 中止: %v", controller.Interface, sequence.Name, err)
+				errs[i] = fmt.Errorf("%s: %v", controller.Interface, err)
+				once.Do(func() { close(abort) })
+			}
+		}(i, arm.controller, arm.sequence)
+	}
+	wg.Wait()
+	var cancelled error
+	for _, err := range errs {
+		switch err {
+		case nil, errArmAborted:
+		case errJobCancelled:
+			cancelled = err
+		default:
+			return err
+		}
+	}
+	return cancelled
+}
+
+// reverseForDown 由上举序列的角度组生成下放序列：去掉最后一组（演奏姿态）后倒序。
+// 用时、曲线和速度描述的是到达某组的那一段，倒序后随段移动：下放到第k组使用原第k+1组的设置，停留留在原组
+func reverseForDown(angles []JointAngleSet) []JointAngleSet {
+	if len(angles) <= 1 {
+		return angles
+	}
+	n := len(angles) - 1
+	reversed := make([]JointAngleSet, n)
+	for k := 0; k < n; k++ {
+		set := angles[k]
+		next := angles[k+1]
+		set.DurationMs = next.DurationMs
+		set.Profile = next.Profile
+		set.Speed = next.Speed
+		reversed[n-1-k] = set
+	}
+	return reversed
+}
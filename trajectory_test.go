@@ -0,0 +1,184 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProfileProgress(t *testing.T) {
+	tests := []struct {
+		profile string
+		t       float64
+		want    float64
+	}{
+		{profileLinear, -0.5, 0},
+		{profileLinear, 0, 0},
+		{profileLinear, 0.3, 0.3},
+		{profileLinear, 1, 1},
+		{profileLinear, 1.5, 1},
+		{profileCubic, 0.5, 0.5},
+		{profileCubic, 0.25, 0.15625},
+		{profileTrapezoid, 0.25, 1.0 / 6},
+		{profileTrapezoid, 0.5, 0.5},
+		{profileTrapezoid, 0.75, 5.0 / 6},
+		{profileStep, 0.5, 1},
+	}
+	for _, tt := range tests {
+		if got := profileProgress(tt.profile, tt.t); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("profileProgress(%s, %g) = %g, want %g", tt.profile, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestProfileProgressMonotonic(t *testing.T) {
+	for _, profile := range []string{profileLinear, profileCubic, profileTrapezoid} {
+		prev := 0.0
+		for i := 1; i <= 100; i++ {
+			got := profileProgress(profile, float64(i)/100)
+			if got < prev {
+				t.Fatalf("%s 在 t=%g 处回退: %g < %g", profile, float64(i)/100, got, prev)
+			}
+			prev = got
+		}
+		if prev != 1 {
+			t.Errorf("%s 终点为 %g，应为1", profile, prev)
+		}
+	}
+}
+
+func TestReverseForDown(t *testing.T) {
+	up := []JointAngleSet{
+		{Name: "a", DurationMs: 100, Profile: profileStep, DwellMs: 1},
+		{Name: "b", DurationMs: 200, Profile: profileLinear, DwellMs: 2},
+		{Name: "c", DurationMs: 300, Profile: profileCubic, DwellMs: 3},
+	}
+	tests := []struct {
+		name string
+		in   []JointAngleSet
+		want []JointAngleSet
+	}{
+		{"空序列", nil, nil},
+		{"只有演奏姿态", up[:1], up[:1]},
+		{
+			"去掉演奏姿态后倒序，段设置随段移动",
+			up,
+			[]JointAngleSet{
+				{Name: "b", DurationMs: 300, Profile: profileCubic, DwellMs: 2},
+				{Name: "a", DurationMs: 200, Profile: profileLinear, DwellMs: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reverseForDown(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reverseForDown() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveProfileStopsOnAbort(t *testing.T) {
+	capture := NewCaptureTransport()
+	controller := NewBlackArmController(capture, "can2", ArmConfig{ArmType: "left", MotorIDs: []int{61}})
+	controller.recordTargets(map[int]float32{61: 0})
+
+	tests := []struct {
+		name       string
+		abortAfter time.Duration // <0 表示开始前已中止
+		maxFrames  int
+	}{
+		{"开始前已中止不下发", -1, 0},
+		{"插值中途中止", 60 * time.Millisecond, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture.Reset()
+			abort := make(chan struct{})
+			if tt.abortAfter < 0 {
+				close(abort)
+			} else {
+				time.AfterFunc(tt.abortAfter, func() { close(abort) })
+			}
+
+			start := time.Now()
+			_, err := controller.MoveProfile(map[int]float32{61: 1}, profileLinear, time.Second, 50, nil, abort)
+			if err != errArmAborted {
+				t.Fatalf("MoveProfile() error = %v, want errArmAborted", err)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("中止后 %v 才返回", elapsed)
+			}
+			if n := len(capture.Frames()); n > tt.maxFrames {
+				t.Errorf("下发了 %d 帧，应不超过 %d", n, tt.maxFrames)
+			}
+		})
+	}
+}
+
+func TestMoveProfileReturnsClampedTargets(t *testing.T) {
+	max := float32(0.5)
+	arm := ArmConfig{ArmType: "left", MotorIDs: []int{61, 62}, LimitPolicy: limitClamp, Limits: map[int]JointLimit{61: {Max: &max}}}
+	tests := []struct {
+		name    string
+		profile string
+	}{
+		{"step", profileStep},
+		{"linear", profileLinear},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewBlackArmController(NewCaptureTransport(), "can2", arm)
+			controller.recordTargets(map[int]float32{61: 0, 62: 0})
+			targets := map[int]float32{61: 1, 62: 0.2}
+
+			got, err := controller.MoveProfile(targets, tt.profile, 40*time.Millisecond, 100, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[int]float32{61: 0.5, 62: 0.2}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("MoveProfile() = %v, want %v", got, want)
+			}
+			if targets[61] != 1 {
+				t.Errorf("传入的目标被修改: %v", targets)
+			}
+		})
+	}
+}
+
+func TestMoveProfileStartsFromMeasured(t *testing.T) {
+	tests := []struct {
+		name      string
+		pos       map[uint8]float32 // 实测位置，nil 表示电机不响应
+		wantFirst float32           // 第一个插值点
+		wantErr   bool
+	}{
+		{"没有指令角度时从实测位置开始", map[uint8]float32{61: 0.2}, 0.4, false},
+		{"读不到实测位置时不下发", nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newPositionTransport(tt.pos)
+			controller := NewBlackArmController(transport, "can0", ArmConfig{ArmType: "left", MotorIDs: []int{61}})
+			defer controller.Replies.Close()
+
+			// 40ms、100Hz 共4个点，线性曲线第一点为 1/4 处
+			_, err := controller.MoveProfile(map[int]float32{61: 1}, profileLinear, 40*time.Millisecond, 100, nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MoveProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			sent := transport.locRefs()
+			if tt.wantErr {
+				if len(sent) != 0 {
+					t.Errorf("起点未知时仍下发了 %v", sent)
+				}
+				return
+			}
+			if len(sent) != 4 || math.Abs(float64(sent[0]-tt.wantFirst)) > 1e-6 || sent[3] != 1 {
+				t.Errorf("下发 %v, want 从 %v 开始的4个点", sent, tt.wantFirst)
+			}
+		})
+	}
+}
@@ -0,0 +1,791 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 传输方式名称（arms/hands 配置中的 transport 字段）
+const (
+	transportHTTP      = "http"
+	transportSocketCAN = "socketcan"
+
+	defaultCanBridgeURL = "http://localhost:5260"
+
+	canSFFMask = 0x000007FF // 标准帧ID掩码
+	canEFFMask = 0x1FFFFFFF // 扩展帧ID掩码
+)
+
+// CANFilter 帧过滤器，语义与SocketCAN一致：收到的ID & Mask == ID & Mask 即匹配
+type CANFilter struct {
+	ID   uint32
+	Mask uint32
+}
+
+// ExactID 精确匹配单个ID的过滤器
+func ExactID(id uint32) CANFilter {
+	return CANFilter{ID: id, Mask: canEFFMask}
+}
+
+// Match 判断帧ID是否匹配
+func (f CANFilter) Match(id uint32) bool {
+	return id&f.Mask == f.ID&f.Mask
+}
+
+// CANTransport CAN帧收发接口
+type CANTransport interface {
+	// Send 发送一帧
+	Send(msg CANMessage) error
+	// Subscribe 订阅指定接口上匹配过滤器的帧
+	Subscribe(iface string, filter CANFilter) (*Subscription, error)
+	// Close 释放底层资源
+	Close() error
+}
+
+// BatchSender 支持一次调用发送多帧的传输
+type BatchSender interface {
+	SendBatch(msgs []CANMessage) (BatchResult, error)
+}
+
+// BatchResult 一组帧的发送结果
+type BatchResult struct {
+	Count   int           `json:"count"`
+	FirstAt time.Time     `json:"first_at"` // 第一帧离开的时间
+	LastAt  time.Time     `json:"last_at"`  // 最后一帧离开的时间
+	Skew    time.Duration `json:"skew_ns"`  // LastAt - FirstAt
+	Batched bool          `json:"batched"`  // 是否由传输一次性下发
+}
+
+// sendBatch 一次调用发送一组帧，传输不支持批量时逐帧发送
+func sendBatch(t CANTransport, msgs []CANMessage) (BatchResult, error) {
+	if bs, ok := t.(BatchSender); ok {
+		return bs.SendBatch(msgs)
+	}
+	return sendEach(t, msgs)
+}
+
+// sendEach 逐帧发送并记录首末帧时间
+func sendEach(t CANTransport, msgs []CANMessage) (BatchResult, error) {
+	var res BatchResult
+	for i, msg := range msgs {
+		if err := t.Send(msg); err != nil {
+			return res, err
+		}
+		now := time.Now()
+		if i == 0 {
+			res.FirstAt = now
+		}
+		res.LastAt = now
+		res.Count++
+	}
+	res.Skew = res.LastAt.Sub(res.FirstAt)
+	return res, nil
+}
+
+// Subscription 帧订阅，C 上依次收到匹配的帧，用完必须 Close
+type Subscription struct {
+	C <-chan CANMessage
+
+	once   sync.Once
+	cancel func()
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.once.Do(s.cancel)
+}
+
+// subscriber 订阅者
+type subscriber struct {
+	iface  string
+	filter CANFilter
+	ch     chan CANMessage
+}
+
+// subscriberSet 订阅者集合，负责把收到的帧分发给匹配的订阅者
+type subscriberSet struct {
+	mu   sync.RWMutex
+	subs map[*subscriber]struct{}
+}
+
+func newSubscriberSet() *subscriberSet {
+	return &subscriberSet{subs: make(map[*subscriber]struct{})}
+}
+
+// add 注册订阅者
+func (s *subscriberSet) add(iface string, filter CANFilter) *Subscription {
+	sub := &subscriber{iface: iface, filter: filter, ch: make(chan CANMessage, 256)}
+	s.mu.Lock()
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+
+	return &Subscription{
+		C: sub.ch,
+		cancel: func() {
+			s.mu.Lock()
+			delete(s.subs, sub)
+			s.mu.Unlock()
+			close(sub.ch)
+		},
+	}
+}
+
+// dispatch 把一帧分发给所有匹配的订阅者，订阅者缓冲满时丢弃该帧
+func (s *subscriberSet) dispatch(msg CANMessage) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for sub := range s.subs {
+		if sub.iface != msg.Interface || !sub.filter.Match(msg.ID) {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+		}
+	}
+}
+
+// ----------------------------------HTTP桥接----------------------------------
+
+// HTTPBridgeTransport 通过CAN桥接服务器（/api/can、/api/messages）收发帧
+type HTTPBridgeTransport struct {
+	BaseURL      string
+	Client       *http.Client
+	PollInterval time.Duration
+
+	capsOnce sync.Once
+	caps     bridgeCapabilities
+
+	streamMu sync.Mutex
+	streams  map[string]chan struct{} // 接口 -> 流首次连接完成信号
+	subs     *subscriberSet           // 流式订阅者
+	done     chan struct{}
+}
+
+// bridgeCapabilities 桥接通过 GET /api/capabilities 声明的能力，旧桥接没有该接口时全部为零值
+type bridgeCapabilities struct {
+	Batch          bool `json:"batch"`            // 支持 POST /api/can/batch
+	MaxBatchFrames int  `json:"max_batch_frames"` // 单次批量的最大帧数，0为不限
+	Stream         bool `json:"stream"`           // 支持 GET /api/stream/{iface}（SSE推送接口上的所有帧）
+}
+
+// streamFrame SSE流中每个 data: 行的内容
+type streamFrame struct {
+	ID       uint32   `json:"id"`
+	HexData  []string `json:"hex_data"`
+	Extended *bool    `json:"extended,omitempty"`
+}
+
+// batchRequest POST /api/can/batch 请求体
+type batchRequest struct {
+	Frames []CANMessage `json:"frames"`
+}
+
+// batchResponse POST /api/can/batch 响应，时间戳为桥接写入总线时的Unix秒
+type batchResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		Count   int     `json:"count"`
+		FirstTS float64 `json:"first_ts"`
+		LastTS  float64 `json:"last_ts"`
+	} `json:"data"`
+}
+
+// NewHTTPBridgeTransport 创建HTTP桥接传输
+func NewHTTPBridgeTransport(baseURL string) *HTTPBridgeTransport {
+	return &HTTPBridgeTransport{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		Client:       &http.Client{Timeout: 50 * time.Second},
+		PollInterval: 80 * time.Millisecond,
+		streams:      make(map[string]chan struct{}),
+		subs:         newSubscriberSet(),
+		done:         make(chan struct{}),
+	}
+}
+
+// Send 发送一帧
+func (t *HTTPBridgeTransport) Send(msg CANMessage) error {
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("序列化命令失败: %v", err)
+	}
+
+	resp, err := t.Client.Post(t.BaseURL+"/api/can", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("发送HTTP请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP请求失败，状态码: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// capabilities 协商桥接能力（只查询一次）
+func (t *HTTPBridgeTransport) capabilities() bridgeCapabilities {
+	t.capsOnce.Do(func() {
+		resp, err := t.Client.Get(t.BaseURL + "/api/capabilities")
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return
+		}
+		var body struct {
+			Data bridgeCapabilities `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+			t.caps = body.Data
+		}
+		log.Printf("CAN桥接 %s 能力: batch=%v max_batch_frames=%d stream=%v",
+			t.BaseURL, t.caps.Batch, t.caps.MaxBatchFrames, t.caps.Stream)
+	})
+	return t.caps
+}
+
+// SendBatch 通过 /api/can/batch 一次下发一组帧，桥接不支持时逐帧POST
+func (t *HTTPBridgeTransport) SendBatch(msgs []CANMessage) (BatchResult, error) {
+	caps := t.capabilities()
+	if !caps.Batch || (caps.MaxBatchFrames > 0 && len(msgs) > caps.MaxBatchFrames) {
+		return sendEach(t, msgs)
+	}
+
+	jsonData, err := json.Marshal(batchRequest{Frames: msgs})
+	if err != nil {
+		return BatchResult{}, fmt.Errorf("序列化命令失败: %v", err)
+	}
+
+	start := time.Now()
+	resp, err := t.Client.Post(t.BaseURL+"/api/can/batch", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return BatchResult{}, fmt.Errorf("发送HTTP请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	end := time.Now()
+
+	if resp.StatusCode != http.StatusOK {
+		return BatchResult{}, fmt.Errorf("HTTP请求失败，状态码: %d", resp.StatusCode)
+	}
+
+	var br batchResponse
+	json.NewDecoder(resp.Body).Decode(&br)
+
+	res := BatchResult{Count: len(msgs), Batched: true}
+	if br.Data.FirstTS > 0 && br.Data.LastTS >= br.Data.FirstTS {
+		res.FirstAt = unixSeconds(br.Data.FirstTS)
+		res.LastAt = unixSeconds(br.Data.LastTS)
+	} else {
+		// 桥接未报告时间戳时只能以请求往返时间作为上界
+		res.FirstAt, res.LastAt = start, end
+	}
+	res.Skew = res.LastAt.Sub(res.FirstAt)
+	return res, nil
+}
+
+// unixSeconds 把浮点Unix秒转换为时间
+func unixSeconds(ts float64) time.Time {
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9))
+}
+
+// Subscribe 订阅接口上的帧：桥接支持流式推送时共用每个接口的SSE连接，
+// 否则轮询 /api/messages/{iface}?id=，此时只支持精确ID
+func (t *HTTPBridgeTransport) Subscribe(iface string, filter CANFilter) (*Subscription, error) {
+	if t.capabilities().Stream {
+		sub := t.subs.add(iface, filter)
+		t.ensureStream(iface)
+		return sub, nil
+	}
+	return t.subscribePoll(iface, filter)
+}
+
+// ensureStream 为接口建立SSE连接（每个接口只建立一次），等到首次连接完成后返回，
+// 保证调用方随后发出的请求的响应不会丢失
+func (t *HTTPBridgeTransport) ensureStream(iface string) {
+	t.streamMu.Lock()
+	ready, ok := t.streams[iface]
+	if !ok {
+		ready = make(chan struct{})
+		t.streams[iface] = ready
+		go t.streamLoop(iface, ready)
+	}
+	t.streamMu.Unlock()
+
+	select {
+	case <-ready:
+	case <-time.After(2 * time.Second):
+		log.Printf("等待CAN桥接流 %s 建立超时", iface)
+	}
+}
+
+// streamLoop 保持接口的SSE连接，断开后重连
+func (t *HTTPBridgeTransport) streamLoop(iface string, ready chan struct{}) {
+	// 流是长连接，不能使用带整体超时的 Client
+	client := &http.Client{Transport: t.Client.Transport}
+	url := fmt.Sprintf("%s/api/stream/%s", t.BaseURL, iface)
+	var once sync.Once
+	markReady := func() { once.Do(func() { close(ready) }) }
+	for {
+		if err := t.readStream(client, url, iface, markReady); err != nil {
+			log.Printf("CAN桥接流 %s 断开: %v", url, err)
+		}
+		// 首次连接失败也不再让订阅方等待
+		markReady()
+		select {
+		case <-t.done:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// readStream 读取一次SSE连接，直到连接断开或传输关闭
+func (t *HTTPBridgeTransport) readStream(client *http.Client, url, iface string, connected func()) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+	connected()
+
+	// 传输关闭时中断阻塞中的读取
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-t.done:
+			resp.Body.Close()
+		case <-stop:
+		}
+	}()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var f streamFrame
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line[5:])), &f); err != nil {
+			continue
+		}
+		data := make([]byte, len(f.HexData))
+		for i, h := range f.HexData {
+			data[i] = parseHexByte(h)
+		}
+		extended := f.ID > canSFFMask
+		if f.Extended != nil {
+			extended = *f.Extended
+		}
+		t.subs.dispatch(CANMessage{Interface: iface, ID: f.ID, Data: data, Extended: extended, Timestamp: time.Now()})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// subscribePoll 轮询 /api/messages/{iface}?id= 订阅单个ID。桥接返回的是最近帧的缓存，
+// 订阅时先同步拉取一次作为基线，之后只转发基线之后新出现的帧。
+// 基线拉取失败时返回错误：没有基线就无法区分缓存中的旧帧（旧桥接的帧没有时间戳，会被当作刚收到）
+func (t *HTTPBridgeTransport) subscribePoll(iface string, filter CANFilter) (*Subscription, error) {
+	if filter.Mask&canEFFMask != canEFFMask {
+		return nil, fmt.Errorf("HTTP桥接仅支持精确ID订阅: id=0x%X mask=0x%X", filter.ID, filter.Mask)
+	}
+
+	url := fmt.Sprintf("%s/api/messages/%s?id=%d", t.BaseURL, iface, filter.ID)
+	prev, err := t.poll(url, iface, filter.ID)
+	if err != nil {
+		return nil, fmt.Errorf("拉取 %s 的帧缓存基线失败: %v", iface, err)
+	}
+	ch := make(chan CANMessage, 256)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(ch)
+		warned := false
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(t.PollInterval):
+			}
+
+			cur, err := t.poll(url, iface, filter.ID)
+			if err != nil {
+				continue
+			}
+			if !warned && !cur.stamped() && cur.total == 0 {
+				warned = true
+				log.Printf("⚠️ CAN桥接 %s 的 %s 缓存没有时间戳和累计帧数，缓存填满后无法识别与之前完全相同的新帧", t.BaseURL, iface)
+			}
+			for _, f := range newPolledFrames(prev, cur) {
+				select {
+				case ch <- f.msg:
+				case <-done:
+					return
+				}
+			}
+			prev = cur
+		}
+	}()
+
+	return &Subscription{C: ch, cancel: func() { close(done) }}, nil
+}
+
+// polledFrame 轮询得到的一帧
+type polledFrame struct {
+	msg CANMessage
+	ts  float64 // 桥接记录的时间戳，旧桥接为0
+	key string  // 数据内容，用于没有时间戳时比对
+}
+
+// polledBatch 一次轮询得到的缓存内容
+type polledBatch struct {
+	frames []polledFrame
+	total  uint64 // 桥接累计收到的该ID帧数，旧桥接为0
+}
+
+// stamped 缓存中的帧是否都带有桥接时间戳
+func (b *polledBatch) stamped() bool {
+	if len(b.frames) == 0 {
+		return false
+	}
+	for _, f := range b.frames {
+		if f.ts <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// newPolledFrames 找出本次轮询相对上一次新增的帧（prev 为nil表示没有基线，无法判断，不返回任何帧）。
+// 依次按桥接时间戳、累计帧数判断；两者都没有时把上一次的尾部与本次的头部对齐（缓存是滑动的环形缓冲），
+// 此时缓存填满后到达的与缓存内容完全相同的帧无法识别
+func newPolledFrames(prev, cur *polledBatch) []polledFrame {
+	if prev == nil {
+		return nil
+	}
+	if cur.stamped() {
+		var last float64
+		for _, f := range prev.frames {
+			if f.ts > last {
+				last = f.ts
+			}
+		}
+		var fresh []polledFrame
+		for _, f := range cur.frames {
+			if f.ts > last {
+				fresh = append(fresh, f)
+			}
+		}
+		return fresh
+	}
+
+	if cur.total > 0 && prev.total > 0 {
+		if cur.total <= prev.total {
+			return nil
+		}
+		n := cur.total - prev.total
+		if n >= uint64(len(cur.frames)) {
+			return cur.frames
+		}
+		return cur.frames[len(cur.frames)-int(n):]
+	}
+
+	p, c := prev.frames, cur.frames
+	n := len(p)
+	if len(c) < n {
+		n = len(c)
+	}
+	for k := n; k > 0; k-- {
+		match := true
+		for i := 0; i < k; i++ {
+			if p[len(p)-k+i].key != c[i].key {
+				match = false
+				break
+			}
+		}
+		if match {
+			return c[k:]
+		}
+	}
+	return c
+}
+
+// poll 拉取一次桥接缓存的帧。
+// 帧时间使用桥接记录的时间戳（与本机时钟需同步），旧桥接没有时间戳时为拉取时间
+func (t *HTTPBridgeTransport) poll(url, iface string, id uint32) (*polledBatch, error) {
+	resp, err := t.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	var lr listenResponse
+	if err := json.Unmarshal(body, &lr); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	now := time.Now()
+	batch := &polledBatch{frames: make([]polledFrame, 0, len(lr.Data.Messages)), total: lr.Data.Total}
+	for _, m := range lr.Data.Messages {
+		data := make([]byte, len(m.HexData))
+		for i, h := range m.HexData {
+			data[i] = parseHexByte(h)
+		}
+		at := now
+		if m.Timestamp > 0 {
+			at = time.Unix(0, int64(m.Timestamp*1e9))
+		}
+		batch.frames = append(batch.frames, polledFrame{
+			msg: CANMessage{
+				Interface: iface,
+				ID:        id,
+				Data:      data,
+				Extended:  id > canSFFMask,
+				Timestamp: at,
+			},
+			ts:  m.Timestamp,
+			key: strings.Join(m.HexData, ""),
+		})
+	}
+	return batch, nil
+}
+
+// DeliveryLatency 订阅收到帧相对帧上总线的最大额外延迟：轮询订阅为一个轮询周期，流式订阅为0
+func (t *HTTPBridgeTransport) DeliveryLatency() time.Duration {
+	if t.capabilities().Stream {
+		return 0
+	}
+	return t.PollInterval
+}
+
+// replyTimeout 读取请求等待响应的时限。轮询桥接下响应最晚要到请求之后的下一次轮询才能取到，
+// 在 readParamTimeout 之上再加两个轮询周期（一个周期加上轮询请求本身的往返）
+func replyTimeout(t CANTransport) time.Duration {
+	if r, ok := t.(*RecordingTransport); ok {
+		t = r.inner
+	}
+	if h, ok := t.(*HTTPBridgeTransport); ok {
+		return readParamTimeout + 2*h.DeliveryLatency()
+	}
+	return readParamTimeout
+}
+
+// Close 关闭所有SSE连接
+func (t *HTTPBridgeTransport) Close() error {
+	t.streamMu.Lock()
+	defer t.streamMu.Unlock()
+	select {
+	case <-t.done:
+	default:
+		close(t.done)
+	}
+	return nil
+}
+
+// ----------------------------------按接口选择----------------------------------
+
+// TransportSet 按CAN接口选择传输方式
+type TransportSet struct {
+	fallback    *HTTPBridgeTransport
+	defaultTr   CANTransport // 未配置接口使用的传输
+	byInterface map[string]CANTransport
+	describe    map[string]string // 接口 -> 传输描述，用于日志和冲突检查
+	bridges     map[string]*HTTPBridgeTransport
+	capture     *CaptureTransport // dry_run 时所有接口共用的记录传输
+	recorder    *CANLogger        // can_log 启用时记录所有收发帧
+	owned       []CANTransport
+}
+
+// NewTransportSet 根据配置为每个手臂/手部接口创建传输
+func NewTransportSet(config *Config) (*TransportSet, error) {
+	defaultURL := config.CanBridgeURL
+	if defaultURL == "" {
+		defaultURL = defaultCanBridgeURL
+	}
+	if config.Simulate {
+		defaultURL = simulatorURL(config.CanBridgeURL)
+	}
+
+	set := &TransportSet{
+		byInterface: make(map[string]CANTransport),
+		describe:    make(map[string]string),
+		bridges:     make(map[string]*HTTPBridgeTransport),
+	}
+	set.fallback = set.bridge(defaultURL)
+	set.defaultTr = set.fallback
+
+	if config.CanLog.Enabled {
+		recorder, err := NewCANLogger(config.CanLog)
+		if err != nil {
+			return nil, err
+		}
+		set.recorder = recorder
+	}
+
+	if config.DryRun {
+		// 干运行：所有帧只记录不发送
+		set.capture = NewCaptureTransport()
+		set.defaultTr = set.capture
+		log.Printf("dry_run 已启用: 所有CAN帧只记录不发送")
+		set.wrapRecording()
+		return set, nil
+	}
+
+	var socketCAN CANTransport
+	choose := func(iface, kind, bridgeURL string) error {
+		if config.Simulate {
+			// 模拟模式下所有接口都经本机模拟器桥接，不使用接口或全局配置的桥接地址
+			kind = transportHTTP
+			bridgeURL = defaultURL
+		}
+		if bridgeURL == "" {
+			bridgeURL = defaultURL
+		}
+
+		var tr CANTransport
+		var desc string
+		switch kind {
+		case "", transportHTTP:
+			tr = set.bridge(bridgeURL)
+			desc = transportHTTP + " " + strings.TrimRight(bridgeURL, "/")
+		case transportSocketCAN:
+			if socketCAN == nil {
+				t, err := NewSocketCANTransport()
+				if err != nil {
+					return err
+				}
+				socketCAN = t
+				set.owned = append(set.owned, t)
+			}
+			tr = socketCAN
+			desc = transportSocketCAN
+		default:
+			return fmt.Errorf("接口 %s 的传输方式无效: %s", iface, kind)
+		}
+
+		// 同一接口被多个条目引用时（如手臂与手部共用总线）必须指向同一传输
+		if prev, ok := set.describe[iface]; ok && prev != desc {
+			return fmt.Errorf("接口 %s 的传输配置冲突: %s 与 %s", iface, prev, desc)
+		}
+		set.byInterface[iface] = tr
+		set.describe[iface] = desc
+		log.Printf("CAN接口 %s 使用传输: %s", iface, desc)
+		return nil
+	}
+
+	for iface, arm := range config.Arms {
+		if err := choose(iface, arm.Transport, arm.BridgeURL); err != nil {
+			set.Close()
+			return nil, err
+		}
+	}
+	for _, hand := range config.Hands {
+		if hand.Interface == "" {
+			continue
+		}
+		if err := choose(hand.Interface, hand.Transport, hand.BridgeURL); err != nil {
+			set.Close()
+			return nil, err
+		}
+	}
+
+	set.wrapRecording()
+	return set, nil
+}
+
+// wrapRecording 启用帧记录时，为每个底层传输套上记录层（同一传输只套一次）
+func (t *TransportSet) wrapRecording() {
+	if t.recorder == nil {
+		return
+	}
+	wrapped := make(map[CANTransport]CANTransport)
+	wrap := func(tr CANTransport) CANTransport {
+		if w, ok := wrapped[tr]; ok {
+			return w
+		}
+		w := NewRecordingTransport(tr, t.recorder)
+		wrapped[tr] = w
+		return w
+	}
+	for iface, tr := range t.byInterface {
+		t.byInterface[iface] = wrap(tr)
+	}
+	t.defaultTr = wrap(t.defaultTr)
+}
+
+// bridge 获取（必要时创建）指定URL的HTTP桥接传输，同一URL共用一个实例
+func (t *TransportSet) bridge(bridgeURL string) *HTTPBridgeTransport {
+	key := strings.TrimRight(bridgeURL, "/")
+	if b, ok := t.bridges[key]; ok {
+		return b
+	}
+	b := NewHTTPBridgeTransport(key)
+	t.bridges[key] = b
+	t.owned = append(t.owned, b)
+	return b
+}
+
+// Describe 获取接口的传输描述
+func (t *TransportSet) Describe(iface string) string {
+	if t.capture != nil {
+		return transportDryRun
+	}
+	if desc, ok := t.describe[iface]; ok {
+		return desc
+	}
+	return transportHTTP + " " + t.fallback.BaseURL
+}
+
+// For 获取指定接口的传输，未配置的接口使用默认HTTP桥接（can_bridge_url）
+func (t *TransportSet) For(iface string) CANTransport {
+	if tr, ok := t.byInterface[iface]; ok {
+		return tr
+	}
+	return t.defaultTr
+}
+
+// Capture 获取干运行记录传输，未启用 dry_run 时为 nil
+func (t *TransportSet) Capture() *CaptureTransport {
+	return t.capture
+}
+
+// Send 按帧的接口选择传输并发送
+func (t *TransportSet) Send(msg CANMessage) error {
+	return t.For(msg.Interface).Send(msg)
+}
+
+// Close 关闭所有传输
+func (t *TransportSet) Close() {
+	for _, tr := range t.owned {
+		tr.Close()
+	}
+	if t.recorder != nil {
+		t.recorder.Close()
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// frames 按内容构造轮询帧，ts 为0表示旧桥接没有时间戳
+func frames(keys []string, ts []float64) []polledFrame {
+	out := make([]polledFrame, len(keys))
+	for i, k := range keys {
+		out[i] = polledFrame{key: k}
+		if ts != nil {
+			out[i].ts = ts[i]
+		}
+	}
+	return out
+}
+
+func keysOf(fs []polledFrame) []string {
+	out := []string{}
+	for _, f := range fs {
+		out = append(out, f.key)
+	}
+	return out
+}
+
+func TestNewPolledFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		prev *polledBatch
+		cur  *polledBatch
+		want []string
+	}{
+		{
+			name: "没有基线时不返回任何帧",
+			prev: nil,
+			cur:  &polledBatch{frames: frames([]string{"a", "b"}, nil)},
+			want: []string{},
+		},
+		{
+			name: "按时间戳只取上次最新帧之后的帧",
+			prev: &polledBatch{frames: frames([]string{"a", "b"}, []float64{1, 2})},
+			cur:  &polledBatch{frames: frames([]string{"b", "c", "d"}, []float64{2, 3, 4})},
+			want: []string{"c", "d"},
+		},
+		{
+			name: "时间戳相同的相同内容不是新帧",
+			prev: &polledBatch{frames: frames([]string{"a", "a"}, []float64{1, 2})},
+			cur:  &polledBatch{frames: frames([]string{"a", "a"}, []float64{1, 2})},
+			want: []string{},
+		},
+		{
+			name: "有时间戳时填满的缓存中重复的相同帧仍能识别",
+			prev: &polledBatch{frames: frames([]string{"a", "a", "a"}, []float64{1, 2, 3})},
+			cur:  &polledBatch{frames: frames([]string{"a", "a", "a"}, []float64{2, 3, 4})},
+			want: []string{"a"},
+		},
+		{
+			name: "没有时间戳时按累计帧数取尾部",
+			prev: &polledBatch{frames: frames([]string{"a", "a", "a"}, nil), total: 10},
+			cur:  &polledBatch{frames: frames([]string{"a", "a", "a"}, nil), total: 12},
+			want: []string{"a", "a"},
+		},
+		{
+			name: "累计帧数超过缓存长度时全部为新帧",
+			prev: &polledBatch{frames: frames([]string{"a", "a"}, nil), total: 10},
+			cur:  &polledBatch{frames: frames([]string{"b", "c"}, nil), total: 20},
+			want: []string{"b", "c"},
+		},
+		{
+			name: "累计帧数未变时没有新帧",
+			prev: &polledBatch{frames: frames([]string{"a", "b"}, nil), total: 7},
+			cur:  &polledBatch{frames: frames([]string{"a", "b"}, nil), total: 7},
+			want: []string{},
+		},
+		{
+			name: "旧桥接按内容对齐滑动的缓存",
+			prev: &polledBatch{frames: frames([]string{"a", "b", "c"}, nil)},
+			cur:  &polledBatch{frames: frames([]string{"b", "c", "d"}, nil)},
+			want: []string{"d"},
+		},
+		{
+			name: "旧桥接缓存未满时增长的相同帧可识别",
+			prev: &polledBatch{frames: frames([]string{"a", "a"}, nil)},
+			cur:  &polledBatch{frames: frames([]string{"a", "a", "a"}, nil)},
+			want: []string{"a"},
+		},
+		{
+			name: "旧桥接缓存内容无重叠时全部为新帧",
+			prev: &polledBatch{frames: frames([]string{"a", "b"}, nil)},
+			cur:  &polledBatch{frames: frames([]string{"x", "y"}, nil)},
+			want: []string{"x", "y"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := keysOf(newPolledFrames(tt.prev, tt.cur))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newPolledFrames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplyTimeout(t *testing.T) {
+	polled := NewHTTPBridgeTransport("http://127.0.0.1:0")
+	polled.capsOnce.Do(func() {}) // 不查询能力，按旧桥接（轮询）处理
+	streamed := NewHTTPBridgeTransport("http://127.0.0.1:0")
+	streamed.capsOnce.Do(func() { streamed.caps.Stream = true })
+
+	tests := []struct {
+		name      string
+		transport CANTransport
+		want      time.Duration
+	}{
+		{"轮询桥接", polled, readParamTimeout + 2*polled.PollInterval},
+		{"记录层下的轮询桥接", NewRecordingTransport(polled, nil), readParamTimeout + 2*polled.PollInterval},
+		{"流式桥接", streamed, readParamTimeout},
+		{"干运行", NewCaptureTransport(), readParamTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replyTimeout(tt.transport); got != tt.want {
+				t.Errorf("replyTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}